@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,6 +26,23 @@ type Catalog struct {
 	db       *sql.DB
 	path     string
 	readOnly bool
+
+	// rootMu guards roots, rootPolicy and the path mappings
+	rootMu     sync.Mutex
+	roots      *rootIndex
+	rootPolicy RootFolderPolicy
+	// pathMappings are set by SetPathMappings; rootMappings are found
+	// through relativePathFromCatalog
+	pathMappings []PathMapping
+	rootMappings []PathMapping
+}
+
+// dbExecutor is implemented by both *sql.DB and *sql.Tx so that internal
+// helpers can run either standalone or as part of a larger transaction.
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 // CatalogOptions contains options for creating or opening a catalog
@@ -95,6 +113,17 @@ func OpenCatalog(path string, opts *CatalogOptions) (*Catalog, error) {
 		readOnly: opts.ReadOnly,
 	}
 
+	if !opts.ReadOnly {
+		if err := catalog.upgradeSchema(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to upgrade schema: %w", err)
+		}
+	}
+	if err := catalog.resolveRootMappings(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return catalog, nil
 }
 
@@ -145,6 +174,20 @@ func (c *Catalog) initSchema() error {
 	return tx.Commit()
 }
 
+// upgradeSchema creates any tables missing from catalogs written by older
+// versions and fills in data those versions left out
+func (c *Catalog) upgradeSchema() error {
+	for _, stmt := range schemaUpgrades {
+		if _, err := c.db.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to execute schema upgrade: %w\nStatement: %s", err, stmt)
+		}
+	}
+	if err := c.backfillFolderParents(); err != nil {
+		return fmt.Errorf("failed to backfill folder parents: %w", err)
+	}
+	return nil
+}
+
 // GetDBVersion returns the Adobe database version from the catalog
 func (c *Catalog) GetDBVersion() (string, error) {
 	var version string
@@ -173,9 +216,10 @@ func FromLightroomTimestamp(ts float64) time.Time {
 	return LightroomEpoch.Add(time.Duration(ts * float64(time.Second)))
 }
 
-// FormatCaptureTime formats a time for Lightroom's captureTime field
+// FormatCaptureTime formats a time for Lightroom's captureTime field.
+// Sub-second precision is included when present (e.g. "2024-06-15T14:30:00.25").
 func FormatCaptureTime(t time.Time) string {
-	return t.Format("2006-01-02T15:04:05")
+	return t.Format("2006-01-02T15:04:05.99")
 }
 
 // ImageCount returns the total number of images in the catalog
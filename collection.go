@@ -3,6 +3,7 @@ package lrcat
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -30,17 +31,22 @@ type Collection struct {
 
 // AddCollection adds a new collection to the catalog
 func (c *Catalog) AddCollection(name string, collectionType CollectionType, parentID *int64) (*Collection, error) {
+	return c.addCollection(c.db, name, collectionType, parentID)
+}
+
+// addCollection inserts a collection using the given executor
+func (c *Catalog) addCollection(db dbExecutor, name string, collectionType CollectionType, parentID *int64) (*Collection, error) {
 	// Build genealogy
 	genealogy := ""
 	if parentID != nil {
-		parent, err := c.GetCollection(*parentID)
+		parent, err := c.getCollection(db, *parentID)
 		if err != nil {
 			return nil, fmt.Errorf("parent collection not found: %w", err)
 		}
 		genealogy = parent.Genealogy
 	}
 
-	result, err := c.db.Exec(
+	result, err := db.Exec(
 		`INSERT INTO AgLibraryCollection (creationId, name, parent, genealogy, systemOnly)
 		 VALUES (?, ?, ?, ?, ?)`,
 		string(collectionType), name, parentID, genealogy, "",
@@ -61,7 +67,7 @@ func (c *Catalog) AddCollection(name string, collectionType CollectionType, pare
 	}
 	newGenealogy += fmt.Sprintf("%d", id)
 
-	_, err = c.db.Exec(`UPDATE AgLibraryCollection SET genealogy = ? WHERE id_local = ?`, newGenealogy, id)
+	_, err = db.Exec(`UPDATE AgLibraryCollection SET genealogy = ? WHERE id_local = ?`, newGenealogy, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update genealogy: %w", err)
 	}
@@ -77,12 +83,17 @@ func (c *Catalog) AddCollection(name string, collectionType CollectionType, pare
 
 // GetCollection retrieves a collection by its ID
 func (c *Catalog) GetCollection(id int64) (*Collection, error) {
+	return c.getCollection(c.db, id)
+}
+
+// getCollection retrieves a collection by its ID using the given executor
+func (c *Catalog) getCollection(db dbExecutor, id int64) (*Collection, error) {
 	coll := &Collection{}
 	var parentID sql.NullInt64
 	var imageCount sql.NullInt64
 	var creationID string
 
-	err := c.db.QueryRow(
+	err := db.QueryRow(
 		`SELECT id_local, name, creationId, parent, genealogy, imageCount
 		 FROM AgLibraryCollection WHERE id_local = ?`,
 		id,
@@ -137,6 +148,52 @@ func (c *Catalog) GetCollectionByName(name string) (*Collection, error) {
 	return coll, nil
 }
 
+// GetOrCreateCollectionPath resolves a path such as "Travel/Italy", creating
+// collection sets for the leading parts and a standard collection for the last part
+func (c *Catalog) GetOrCreateCollectionPath(path string) (*Collection, error) {
+	return c.getOrCreateCollectionPath(c.db, path)
+}
+
+// getOrCreateCollectionPath resolves a collection path using the given executor
+func (c *Catalog) getOrCreateCollectionPath(db dbExecutor, path string) (*Collection, error) {
+	var parts []string
+	for _, part := range strings.Split(path, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty collection path")
+	}
+
+	var parentID *int64
+	var coll *Collection
+	for i, name := range parts {
+		collectionType := CollectionTypeGroup
+		if i == len(parts)-1 {
+			collectionType = CollectionTypeStandard
+		}
+
+		var id int64
+		err := db.QueryRow(
+			`SELECT id_local FROM AgLibraryCollection
+			 WHERE name = ? AND creationId = ? AND parent IS ?`,
+			name, string(collectionType), parentID,
+		).Scan(&id)
+		switch {
+		case err == nil:
+			coll, err = c.getCollection(db, id)
+		case err == sql.ErrNoRows:
+			coll, err = c.addCollection(db, name, collectionType, parentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		parentID = &coll.ID
+	}
+	return coll, nil
+}
+
 // ListCollections returns all collections in the catalog
 func (c *Catalog) ListCollections() ([]*Collection, error) {
 	rows, err := c.db.Query(
@@ -175,9 +232,14 @@ func (c *Catalog) ListCollections() ([]*Collection, error) {
 
 // AddImageToCollection adds an image to a collection
 func (c *Catalog) AddImageToCollection(imageID, collectionID int64) error {
+	return c.addImageToCollection(c.db, imageID, collectionID)
+}
+
+// addImageToCollection adds an image to a collection using the given executor
+func (c *Catalog) addImageToCollection(db dbExecutor, imageID, collectionID int64) error {
 	// Get current max position
 	var maxPos sql.NullFloat64
-	err := c.db.QueryRow(
+	err := db.QueryRow(
 		`SELECT MAX(positionInCollection) FROM AgLibraryCollectionImage WHERE collection = ?`,
 		collectionID,
 	).Scan(&maxPos)
@@ -190,7 +252,7 @@ func (c *Catalog) AddImageToCollection(imageID, collectionID int64) error {
 		position = maxPos.Float64 + 1.0
 	}
 
-	_, err = c.db.Exec(
+	_, err = db.Exec(
 		`INSERT OR IGNORE INTO AgLibraryCollectionImage (collection, image, pick, positionInCollection)
 		 VALUES (?, ?, 0, ?)`,
 		collectionID, imageID, position,
@@ -200,7 +262,7 @@ func (c *Catalog) AddImageToCollection(imageID, collectionID int64) error {
 	}
 
 	// Update image count
-	return c.updateCollectionImageCount(collectionID)
+	return c.updateCollectionImageCount(db, collectionID)
 }
 
 // RemoveImageFromCollection removes an image from a collection
@@ -213,12 +275,12 @@ func (c *Catalog) RemoveImageFromCollection(imageID, collectionID int64) error {
 		return err
 	}
 
-	return c.updateCollectionImageCount(collectionID)
+	return c.updateCollectionImageCount(c.db, collectionID)
 }
 
 // updateCollectionImageCount updates the imageCount field for a collection
-func (c *Catalog) updateCollectionImageCount(collectionID int64) error {
-	_, err := c.db.Exec(
+func (c *Catalog) updateCollectionImageCount(db dbExecutor, collectionID int64) error {
+	_, err := db.Exec(
 		`UPDATE AgLibraryCollection SET imageCount = (
 			SELECT COUNT(*) FROM AgLibraryCollectionImage WHERE collection = ?
 		) WHERE id_local = ?`,
@@ -282,3 +282,37 @@ func TestCollectionImageOrder(t *testing.T) {
 		}
 	}
 }
+
+func TestGetOrCreateCollectionPath(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	collection, err := catalog.GetOrCreateCollectionPath("Clients/2024/Smith")
+	if err != nil {
+		t.Fatalf("Failed to create collection path: %v", err)
+	}
+	if collection.Name != "Smith" || collection.CreationID != CollectionTypeStandard {
+		t.Errorf("Expected standard collection 'Smith', got %s (%s)", collection.Name, collection.CreationID)
+	}
+
+	parent, err := catalog.GetCollection(*collection.ParentID)
+	if err != nil {
+		t.Fatalf("Failed to get parent: %v", err)
+	}
+	if parent.Name != "2024" || parent.CreationID != CollectionTypeGroup {
+		t.Errorf("Expected collection set '2024', got %s (%s)", parent.Name, parent.CreationID)
+	}
+
+	again, err := catalog.GetOrCreateCollectionPath("Clients/2024/Smith")
+	if err != nil {
+		t.Fatalf("Failed to get collection path: %v", err)
+	}
+	if again.ID != collection.ID {
+		t.Errorf("Expected existing collection %d, got %d", collection.ID, again.ID)
+	}
+
+	collections, _ := catalog.ListCollections()
+	if len(collections) != 3 {
+		t.Errorf("Expected 3 collections, got %d", len(collections))
+	}
+}
@@ -0,0 +1,782 @@
+package lrcat
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoEXIF is returned when a file does not contain readable EXIF metadata
+var ErrNoEXIF = errors.New("no EXIF metadata found")
+
+// EXIFData contains the metadata harvested from a file's EXIF block.
+// Optional values are nil when the corresponding tag is absent.
+type EXIFData struct {
+	Make         string
+	Model        string
+	LensModel    string
+	SerialNumber string
+	// DateTimeOriginal includes SubSecTimeOriginal and, when OffsetTimeOriginal
+	// is present, a fixed time zone for the recorded offset
+	DateTimeOriginal time.Time
+	FNumber          *float64
+	ExposureTime     *float64
+	ISO              *int
+	FocalLength      *float64
+	FlashFired       *bool
+	Orientation      *int
+	Width            *int
+	Height           *int
+	GPS              *GPSCoordinates
+}
+
+// GPSCoordinates contains a decimal-degree GPS position
+type GPSCoordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// TIFF/EXIF tag identifiers used by the reader
+const (
+	tagNewSubFileType     = 0x00FE
+	tagImageWidth         = 0x0100
+	tagImageLength        = 0x0101
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagSubIFDs            = 0x014A
+	tagExposureTime       = 0x829A
+	tagFNumber            = 0x829D
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagFlash              = 0x9209
+	tagFocalLength        = 0x920A
+	tagSubSecTimeOriginal = 0x9291
+	tagPixelXDimension    = 0xA002
+	tagPixelYDimension    = 0xA003
+	tagBodySerialNumber   = 0xA431
+	tagLensModel          = 0xA434
+	tagDNGCameraSerial    = 0xC62F
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+	maxIFDEntries         = 1024
+	maxTIFFValueSize      = 1 << 20
+	exifDateTimeLayout    = "2006:01:02 15:04:05"
+	maxJPEGSegmentsToScan = 64
+)
+
+// tiffTypeSizes maps TIFF field types to their size in bytes
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// ReadEXIFFile reads EXIF metadata from the file at path.
+// JPEG, TIFF, DNG and TIFF-based raw formats (CR2, NEF, ARW, ORF, PEF) are supported.
+func ReadEXIFFile(path string) (*EXIFData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadEXIF(f, info.Size())
+}
+
+// ReadEXIF reads EXIF metadata from r, which holds size bytes of file content
+func ReadEXIF(r io.ReaderAt, size int64) (*EXIFData, error) {
+	header := make([]byte, 4)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, ErrNoEXIF
+	}
+
+	switch {
+	case header[0] == 0xFF && header[1] == 0xD8:
+		return readJPEGEXIF(r, size)
+	case isTIFFHeader(header):
+		data := &EXIFData{}
+		if err := parseTIFF(io.NewSectionReader(r, 0, size), data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	default:
+		return nil, ErrNoEXIF
+	}
+}
+
+// isTIFFHeader reports whether the bytes start a TIFF structure.
+// Olympus ORF files use the "IIRO"/"IIRS" variants of the little-endian magic.
+func isTIFFHeader(b []byte) bool {
+	if len(b) < 4 {
+		return false
+	}
+	switch {
+	case b[0] == 'I' && b[1] == 'I':
+		magic := binary.LittleEndian.Uint16(b[2:4])
+		return magic == 42 || magic == 0x4F52 || magic == 0x5352
+	case b[0] == 'M' && b[1] == 'M':
+		return binary.BigEndian.Uint16(b[2:4]) == 42
+	}
+	return false
+}
+
+// readJPEGEXIF walks the JPEG marker segments looking for the APP1 Exif block
+// and the start-of-frame header that carries the pixel dimensions.
+func readJPEGEXIF(r io.ReaderAt, size int64) (*EXIFData, error) {
+	data := &EXIFData{}
+	foundEXIF := false
+	offset := int64(2)
+
+	for i := 0; i < maxJPEGSegmentsToScan && offset+4 <= size; i++ {
+		marker := make([]byte, 4)
+		if _, err := r.ReadAt(marker, offset); err != nil {
+			break
+		}
+		if marker[0] != 0xFF {
+			break
+		}
+		code := marker[1]
+		if code == 0xD8 || (code >= 0xD0 && code <= 0xD7) || code == 0x01 {
+			offset += 2
+			continue
+		}
+		if code == 0xD9 || code == 0xDA {
+			break
+		}
+
+		segLen := int64(binary.BigEndian.Uint16(marker[2:4]))
+		if segLen < 2 {
+			break
+		}
+		segStart := offset + 4
+
+		switch {
+		case code == 0xE1 && !foundEXIF:
+			ident := make([]byte, 6)
+			if _, err := r.ReadAt(ident, segStart); err == nil && bytes.Equal(ident, []byte("Exif\x00\x00")) {
+				section := io.NewSectionReader(r, segStart+6, segLen-8)
+				if err := parseTIFF(section, data); err == nil {
+					foundEXIF = true
+				}
+			}
+		case isSOFMarker(code):
+			sof := make([]byte, 5)
+			if _, err := r.ReadAt(sof, segStart); err == nil {
+				height := int(binary.BigEndian.Uint16(sof[1:3]))
+				width := int(binary.BigEndian.Uint16(sof[3:5]))
+				data.Width = &width
+				data.Height = &height
+			}
+		}
+
+		offset = segStart + segLen - 2
+	}
+
+	if !foundEXIF {
+		return nil, ErrNoEXIF
+	}
+	return data, nil
+}
+
+// isSOFMarker reports whether the JPEG marker is a start-of-frame marker
+func isSOFMarker(code byte) bool {
+	return code >= 0xC0 && code <= 0xCF && code != 0xC4 && code != 0xC8 && code != 0xCC
+}
+
+// tiffReader reads IFD structures from a TIFF byte stream
+type tiffReader struct {
+	r       *io.SectionReader
+	order   binary.ByteOrder
+	visited map[uint32]bool
+}
+
+// tiffEntry is a single IFD entry with its raw value bytes
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// parseTIFF parses IFD0 and the EXIF, GPS and raw sub-IFDs into data
+func parseTIFF(r *io.SectionReader, data *EXIFData) error {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return ErrNoEXIF
+	}
+	if !isTIFFHeader(header) {
+		return ErrNoEXIF
+	}
+
+	tr := &tiffReader{r: r, visited: make(map[uint32]bool)}
+	if header[0] == 'I' {
+		tr.order = binary.LittleEndian
+	} else {
+		tr.order = binary.BigEndian
+	}
+
+	ifd0, err := tr.readIFD(tr.order.Uint32(header[4:8]))
+	if err != nil {
+		return err
+	}
+
+	var ifd0Width, ifd0Height *int
+	fullResolution := true
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagMake:
+			data.Make = tr.asciiValue(e)
+		case tagModel:
+			data.Model = tr.asciiValue(e)
+		case tagOrientation:
+			if v, ok := tr.intValue(e); ok {
+				data.Orientation = &v
+			}
+		case tagImageWidth:
+			if v, ok := tr.intValue(e); ok {
+				ifd0Width = &v
+			}
+		case tagImageLength:
+			if v, ok := tr.intValue(e); ok {
+				ifd0Height = &v
+			}
+		case tagNewSubFileType:
+			if v, ok := tr.intValue(e); ok {
+				fullResolution = v == 0
+			}
+		case tagDNGCameraSerial:
+			if data.SerialNumber == "" {
+				data.SerialNumber = tr.asciiValue(e)
+			}
+		case tagExifIFD:
+			if v, ok := tr.intValue(e); ok {
+				tr.parseExifIFD(uint32(v), data)
+			}
+		case tagGPSIFD:
+			if v, ok := tr.intValue(e); ok {
+				tr.parseGPSIFD(uint32(v), data)
+			}
+		case tagSubIFDs:
+			if data.Width == nil {
+				tr.parseSubIFDDimensions(e, data)
+			}
+		}
+	}
+
+	if data.Width == nil && fullResolution {
+		data.Width = ifd0Width
+		data.Height = ifd0Height
+	}
+
+	return nil
+}
+
+// readIFD reads all entries of the IFD at offset
+func (tr *tiffReader) readIFD(offset uint32) ([]tiffEntry, error) {
+	if offset == 0 || tr.visited[offset] {
+		return nil, fmt.Errorf("invalid IFD offset: %d", offset)
+	}
+	tr.visited[offset] = true
+
+	countBuf := make([]byte, 2)
+	if _, err := tr.r.ReadAt(countBuf, int64(offset)); err != nil {
+		return nil, fmt.Errorf("failed to read IFD: %w", err)
+	}
+	count := int(tr.order.Uint16(countBuf))
+	if count > maxIFDEntries {
+		return nil, fmt.Errorf("IFD has too many entries: %d", count)
+	}
+
+	raw := make([]byte, count*12)
+	if _, err := tr.r.ReadAt(raw, int64(offset)+2); err != nil {
+		return nil, fmt.Errorf("failed to read IFD entries: %w", err)
+	}
+
+	entries := make([]tiffEntry, 0, count)
+	for i := 0; i < count; i++ {
+		b := raw[i*12 : i*12+12]
+		e := tiffEntry{
+			tag:   tr.order.Uint16(b[0:2]),
+			typ:   tr.order.Uint16(b[2:4]),
+			count: tr.order.Uint32(b[4:8]),
+		}
+		typeSize, ok := tiffTypeSizes[e.typ]
+		if !ok {
+			continue
+		}
+		size := uint64(typeSize) * uint64(e.count)
+		if size > maxTIFFValueSize {
+			continue
+		}
+		if size <= 4 {
+			e.value = append([]byte(nil), b[8:8+size]...)
+		} else {
+			e.value = make([]byte, size)
+			if _, err := tr.r.ReadAt(e.value, int64(tr.order.Uint32(b[8:12]))); err != nil {
+				continue
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseExifIFD reads the camera settings stored in the EXIF sub-IFD
+func (tr *tiffReader) parseExifIFD(offset uint32, data *EXIFData) {
+	entries, err := tr.readIFD(offset)
+	if err != nil {
+		return
+	}
+
+	var pixelX, pixelY *int
+	var dateTime, subSec, offsetTime string
+	for _, e := range entries {
+		switch e.tag {
+		case tagExposureTime:
+			if v, ok := tr.rationalValue(e, 0); ok {
+				data.ExposureTime = &v
+			}
+		case tagFNumber:
+			if v, ok := tr.rationalValue(e, 0); ok {
+				data.FNumber = &v
+			}
+		case tagISO:
+			if v, ok := tr.intValue(e); ok {
+				data.ISO = &v
+			}
+		case tagDateTimeOriginal:
+			dateTime = tr.asciiValue(e)
+		case tagSubSecTimeOriginal:
+			subSec = tr.asciiValue(e)
+		case tagOffsetTimeOriginal:
+			offsetTime = tr.asciiValue(e)
+		case tagFlash:
+			if v, ok := tr.intValue(e); ok {
+				fired := v&1 == 1
+				data.FlashFired = &fired
+			}
+		case tagFocalLength:
+			if v, ok := tr.rationalValue(e, 0); ok {
+				data.FocalLength = &v
+			}
+		case tagPixelXDimension:
+			if v, ok := tr.intValue(e); ok {
+				pixelX = &v
+			}
+		case tagPixelYDimension:
+			if v, ok := tr.intValue(e); ok {
+				pixelY = &v
+			}
+		case tagBodySerialNumber:
+			data.SerialNumber = tr.asciiValue(e)
+		case tagLensModel:
+			data.LensModel = tr.asciiValue(e)
+		}
+	}
+
+	if pixelX != nil && pixelY != nil && *pixelX > 0 && *pixelY > 0 {
+		data.Width = pixelX
+		data.Height = pixelY
+	}
+
+	if t, ok := parseEXIFDateTime(dateTime, subSec, offsetTime); ok {
+		data.DateTimeOriginal = t
+	}
+}
+
+// parseEXIFDateTime combines an EXIF date/time with its optional sub-second
+// and offset companions (e.g. "2024:06:15 14:30:00", "25", "+02:00")
+func parseEXIFDateTime(dateTime, subSec, offset string) (time.Time, bool) {
+	t, err := time.Parse(exifDateTimeLayout, dateTime)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	subSec = strings.TrimSpace(subSec)
+	if subSec != "" {
+		if frac, err := strconv.ParseFloat("0."+subSec, 64); err == nil {
+			t = t.Add(time.Duration(frac * float64(time.Second)))
+		}
+	}
+
+	if offset != "" {
+		if zone, err := time.Parse("-07:00", offset); err == nil {
+			_, secs := zone.Zone()
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(),
+				time.FixedZone(offset, secs))
+		}
+	}
+
+	return t, true
+}
+
+// parseGPSIFD reads the GPS position from the GPS sub-IFD
+func (tr *tiffReader) parseGPSIFD(offset uint32, data *EXIFData) {
+	entries, err := tr.readIFD(offset)
+	if err != nil {
+		return
+	}
+
+	var latRef, lonRef string
+	var lat, lon *float64
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = tr.asciiValue(e)
+		case tagGPSLongitudeRef:
+			lonRef = tr.asciiValue(e)
+		case tagGPSLatitude:
+			if v, ok := tr.degreesValue(e); ok {
+				lat = &v
+			}
+		case tagGPSLongitude:
+			if v, ok := tr.degreesValue(e); ok {
+				lon = &v
+			}
+		}
+	}
+
+	if lat == nil || lon == nil {
+		return
+	}
+	coords := &GPSCoordinates{Latitude: *lat, Longitude: *lon}
+	if strings.EqualFold(latRef, "S") {
+		coords.Latitude = -coords.Latitude
+	}
+	if strings.EqualFold(lonRef, "W") {
+		coords.Longitude = -coords.Longitude
+	}
+	data.GPS = coords
+}
+
+// parseSubIFDDimensions finds the full-resolution raw image among the
+// sub-IFDs (as used by DNG, NEF and PEF) and records its dimensions.
+func (tr *tiffReader) parseSubIFDDimensions(e tiffEntry, data *EXIFData) {
+	for i := uint32(0); i < e.count; i++ {
+		offset, ok := tr.uintAt(e, int(i))
+		if !ok {
+			return
+		}
+		entries, err := tr.readIFD(offset)
+		if err != nil {
+			continue
+		}
+
+		var width, height *int
+		primary := false
+		for _, sub := range entries {
+			switch sub.tag {
+			case tagNewSubFileType:
+				if v, ok := tr.intValue(sub); ok {
+					primary = v == 0
+				}
+			case tagImageWidth:
+				if v, ok := tr.intValue(sub); ok {
+					width = &v
+				}
+			case tagImageLength:
+				if v, ok := tr.intValue(sub); ok {
+					height = &v
+				}
+			}
+		}
+		if primary && width != nil && height != nil {
+			data.Width = width
+			data.Height = height
+			return
+		}
+	}
+}
+
+// asciiValue returns an ASCII entry as a trimmed string
+func (tr *tiffReader) asciiValue(e tiffEntry) string {
+	if e.typ != 2 && e.typ != 7 {
+		return ""
+	}
+	s := string(e.value)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// uintAt returns the i-th integer component of a BYTE, SHORT or LONG entry
+func (tr *tiffReader) uintAt(e tiffEntry, i int) (uint32, bool) {
+	if uint32(i) >= e.count {
+		return 0, false
+	}
+	switch e.typ {
+	case 1, 7:
+		return uint32(e.value[i]), true
+	case 3:
+		return uint32(tr.order.Uint16(e.value[i*2:])), true
+	case 4:
+		return tr.order.Uint32(e.value[i*4:]), true
+	}
+	return 0, false
+}
+
+// intValue returns the first integer component of an entry
+func (tr *tiffReader) intValue(e tiffEntry) (int, bool) {
+	v, ok := tr.uintAt(e, 0)
+	return int(v), ok
+}
+
+// rationalValue returns the i-th component of a RATIONAL or SRATIONAL entry
+func (tr *tiffReader) rationalValue(e tiffEntry, i int) (float64, bool) {
+	if uint32(i) >= e.count {
+		return 0, false
+	}
+	switch e.typ {
+	case 5:
+		num := tr.order.Uint32(e.value[i*8:])
+		den := tr.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		return float64(num) / float64(den), true
+	case 10:
+		num := int32(tr.order.Uint32(e.value[i*8:]))
+		den := int32(tr.order.Uint32(e.value[i*8+4:]))
+		if den == 0 {
+			return 0, false
+		}
+		return float64(num) / float64(den), true
+	}
+	if v, ok := tr.uintAt(e, i); ok {
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// degreesValue converts a degrees/minutes/seconds rational triple to decimal degrees
+func (tr *tiffReader) degreesValue(e tiffEntry) (float64, bool) {
+	if e.count < 3 {
+		return 0, false
+	}
+	deg, ok1 := tr.rationalValue(e, 0)
+	mins, ok2 := tr.rationalValue(e, 1)
+	secs, ok3 := tr.rationalValue(e, 2)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, false
+	}
+	return deg + mins/60 + secs/3600, true
+}
+
+// apertureToAPEX converts an f-number to the APEX aperture value Lightroom stores
+func apertureToAPEX(fNumber float64) float64 {
+	return 2 * math.Log2(fNumber)
+}
+
+// apexToAperture converts an APEX aperture value back to an f-number
+func apexToAperture(apex float64) float64 {
+	return math.Pow(2, apex/2)
+}
+
+// exposureToAPEX converts an exposure time in seconds to the APEX shutter speed value
+func exposureToAPEX(seconds float64) float64 {
+	return -math.Log2(seconds)
+}
+
+// apexToExposure converts an APEX shutter speed value back to seconds
+func apexToExposure(apex float64) float64 {
+	return math.Pow(2, -apex)
+}
+
+// Interned string tables referenced by AgHarvestedExifMetadata
+const (
+	internedCameraModelTable = "AgInternedExifCameraModel"
+	internedLensTable        = "AgInternedExifLens"
+	internedCameraSNTable    = "AgInternedExifCameraSN"
+)
+
+// harvestEXIF stores EXIF data for an image in AgHarvestedExifMetadata,
+// interning camera model, lens and serial number strings.
+func (c *Catalog) harvestEXIF(db dbExecutor, imageID int64, data *EXIFData) error {
+	cameraModelRef, err := internValue(db, internedCameraModelTable, data.cameraModelName())
+	if err != nil {
+		return err
+	}
+	lensRef, err := internValue(db, internedLensTable, data.LensModel)
+	if err != nil {
+		return err
+	}
+	cameraSNRef, err := internValue(db, internedCameraSNTable, data.SerialNumber)
+	if err != nil {
+		return err
+	}
+
+	var aperture, shutterSpeed, focalLength, iso, flashFired interface{}
+	if data.FNumber != nil && *data.FNumber > 0 {
+		aperture = apertureToAPEX(*data.FNumber)
+	}
+	if data.ExposureTime != nil && *data.ExposureTime > 0 {
+		shutterSpeed = exposureToAPEX(*data.ExposureTime)
+	}
+	if data.FocalLength != nil {
+		focalLength = *data.FocalLength
+	}
+	if data.ISO != nil {
+		iso = *data.ISO
+	}
+	if data.FlashFired != nil {
+		flashFired = boolToInt(*data.FlashFired)
+	}
+
+	var dateYear, dateMonth, dateDay interface{}
+	if !data.DateTimeOriginal.IsZero() {
+		dateYear = data.DateTimeOriginal.Year()
+		dateMonth = int(data.DateTimeOriginal.Month())
+		dateDay = data.DateTimeOriginal.Day()
+	}
+
+	var gpsLatitude, gpsLongitude interface{}
+	hasGPS := 0
+	if data.GPS != nil {
+		gpsLatitude = data.GPS.Latitude
+		gpsLongitude = data.GPS.Longitude
+		hasGPS = 1
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO AgHarvestedExifMetadata
+		 (image, aperture, cameraModelRef, cameraSNRef, dateDay, dateMonth, dateYear, flashFired,
+		  focalLength, gpsLatitude, gpsLongitude, hasGPS, isoSpeedRating, lensRef, shutterSpeed)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		imageID, aperture, cameraModelRef, cameraSNRef, dateDay, dateMonth, dateYear, flashFired,
+		focalLength, gpsLatitude, gpsLongitude, hasGPS, iso, lensRef, shutterSpeed,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to harvest EXIF metadata: %w", err)
+	}
+	return nil
+}
+
+// GetImageEXIF returns the harvested EXIF metadata for an image.
+// Returns nil if no EXIF metadata was harvested for the image.
+func (c *Catalog) GetImageEXIF(imageID int64) (*EXIFData, error) {
+	var aperture, shutterSpeed, focalLength, iso sql.NullFloat64
+	var gpsLatitude, gpsLongitude sql.NullFloat64
+	var flashFired, hasGPS sql.NullInt64
+	var dateYear, dateMonth, dateDay sql.NullInt64
+	var cameraModel, lens, serial sql.NullString
+
+	err := c.db.QueryRow(
+		`SELECT e.aperture, e.shutterSpeed, e.focalLength, e.isoSpeedRating, e.flashFired,
+		        e.gpsLatitude, e.gpsLongitude, e.hasGPS, e.dateYear, e.dateMonth, e.dateDay,
+		        cm.value, l.value, sn.value
+		 FROM AgHarvestedExifMetadata e
+		 LEFT JOIN AgInternedExifCameraModel cm ON e.cameraModelRef = cm.id_local
+		 LEFT JOIN AgInternedExifLens l ON e.lensRef = l.id_local
+		 LEFT JOIN AgInternedExifCameraSN sn ON e.cameraSNRef = sn.id_local
+		 WHERE e.image = ?`,
+		imageID,
+	).Scan(&aperture, &shutterSpeed, &focalLength, &iso, &flashFired,
+		&gpsLatitude, &gpsLongitude, &hasGPS, &dateYear, &dateMonth, &dateDay,
+		&cameraModel, &lens, &serial)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get EXIF metadata: %w", err)
+	}
+
+	data := &EXIFData{
+		Model:        cameraModel.String,
+		LensModel:    lens.String,
+		SerialNumber: serial.String,
+	}
+	if aperture.Valid {
+		v := apexToAperture(aperture.Float64)
+		data.FNumber = &v
+	}
+	if shutterSpeed.Valid {
+		v := apexToExposure(shutterSpeed.Float64)
+		data.ExposureTime = &v
+	}
+	if focalLength.Valid {
+		v := focalLength.Float64
+		data.FocalLength = &v
+	}
+	if iso.Valid {
+		v := int(iso.Float64)
+		data.ISO = &v
+	}
+	if flashFired.Valid {
+		v := flashFired.Int64 == 1
+		data.FlashFired = &v
+	}
+	if hasGPS.Int64 == 1 && gpsLatitude.Valid && gpsLongitude.Valid {
+		data.GPS = &GPSCoordinates{Latitude: gpsLatitude.Float64, Longitude: gpsLongitude.Float64}
+	}
+	if dateYear.Valid && dateMonth.Valid && dateDay.Valid {
+		data.DateTimeOriginal = time.Date(int(dateYear.Int64), time.Month(dateMonth.Int64), int(dateDay.Int64), 0, 0, 0, 0, time.UTC)
+	}
+
+	return data, nil
+}
+
+// cameraModelName returns the model name, prefixed with the make when the
+// model string does not already include it (e.g. Nikon's "D850").
+func (d *EXIFData) cameraModelName() string {
+	fields := strings.Fields(d.Make)
+	if len(fields) == 0 || d.Model == "" {
+		return d.Model
+	}
+	brand := fields[0]
+	if strings.HasPrefix(strings.ToLower(d.Model), strings.ToLower(brand)) {
+		return d.Model
+	}
+	return brand + " " + d.Model
+}
+
+// internValue returns the id of value in an interned string table, inserting it if needed.
+// Returns nil for empty values so the reference column stays NULL.
+func internValue(db dbExecutor, table, value string) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var id int64
+	err := db.QueryRow(`SELECT id_local FROM `+table+` WHERE value = ?`, value).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	result, err := db.Exec(
+		`INSERT INTO `+table+` (searchIndex, value) VALUES (?, ?)`,
+		strings.ToLower(value), value,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to intern %s value: %w", table, err)
+	}
+	return result.LastInsertId()
+}
+
+// boolToInt converts a bool to the 0/1 integer Lightroom stores
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
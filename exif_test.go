@@ -0,0 +1,348 @@
+package lrcat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testIFDEntry describes a tag to write into a synthetic TIFF IFD
+type testIFDEntry struct {
+	tag   uint16
+	typ   uint16
+	value interface{} // string, []uint16, []uint32, [][2]uint32, or *testIFD
+}
+
+// testIFD is a synthetic IFD used to build test TIFF structures
+type testIFD struct {
+	entries []testIFDEntry
+}
+
+// buildTestTIFF serializes ifd0 (and any nested IFDs) as a little-endian TIFF
+func buildTestTIFF(ifd0 *testIFD) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{'I', 'I', 42, 0, 8, 0, 0, 0})
+	writeTestIFD(buf, ifd0)
+	return buf.Bytes()
+}
+
+// writeTestIFD appends the IFD at the current buffer position and returns its offset
+func writeTestIFD(buf *bytes.Buffer, ifd *testIFD) uint32 {
+	le := binary.LittleEndian
+	sort.Slice(ifd.entries, func(i, j int) bool { return ifd.entries[i].tag < ifd.entries[j].tag })
+
+	start := uint32(buf.Len())
+	tableSize := uint32(2 + len(ifd.entries)*12 + 4)
+	dataOffset := start + tableSize
+
+	table := make([]byte, tableSize)
+	le.PutUint16(table, uint16(len(ifd.entries)))
+	var extra bytes.Buffer
+	var nested []*testIFD
+	var nestedSlots []int
+
+	for i, e := range ifd.entries {
+		slot := table[2+i*12:]
+		le.PutUint16(slot[0:], e.tag)
+		le.PutUint16(slot[2:], e.typ)
+
+		var raw []byte
+		var count uint32
+		switch v := e.value.(type) {
+		case string:
+			raw = append([]byte(v), 0)
+			count = uint32(len(raw))
+		case []uint16:
+			for _, x := range v {
+				raw = le.AppendUint16(raw, x)
+			}
+			count = uint32(len(v))
+		case []uint32:
+			for _, x := range v {
+				raw = le.AppendUint32(raw, x)
+			}
+			count = uint32(len(v))
+		case [][2]uint32:
+			for _, x := range v {
+				raw = le.AppendUint32(raw, x[0])
+				raw = le.AppendUint32(raw, x[1])
+			}
+			count = uint32(len(v))
+		case *testIFD:
+			nested = append(nested, v)
+			nestedSlots = append(nestedSlots, i)
+			count = 1
+		}
+		le.PutUint32(slot[4:], count)
+
+		if len(raw) <= 4 {
+			copy(slot[8:12], raw)
+		} else {
+			le.PutUint32(slot[8:], dataOffset+uint32(extra.Len()))
+			extra.Write(raw)
+			if extra.Len()%2 == 1 {
+				extra.WriteByte(0)
+			}
+		}
+	}
+
+	buf.Write(table)
+	buf.Write(extra.Bytes())
+
+	for n, sub := range nested {
+		offset := writeTestIFD(buf, sub)
+		b := buf.Bytes()
+		le.PutUint32(b[start+uint32(2+nestedSlots[n]*12+8):], offset)
+	}
+	return start
+}
+
+// sampleEXIFIFD returns an IFD0 with camera settings, GPS and dimensions
+func sampleEXIFIFD() *testIFD {
+	exifIFD := &testIFD{entries: []testIFDEntry{
+		{tagExposureTime, 5, [][2]uint32{{1, 250}}},
+		{tagFNumber, 5, [][2]uint32{{28, 10}}},
+		{tagISO, 3, []uint16{400}},
+		{tagDateTimeOriginal, 2, "2024:06:15 14:30:00"},
+		{tagFlash, 3, []uint16{0x19}},
+		{tagFocalLength, 5, [][2]uint32{{50, 1}}},
+		{tagPixelXDimension, 4, []uint32{6000}},
+		{tagPixelYDimension, 4, []uint32{4000}},
+		{tagBodySerialNumber, 2, "012345"},
+		{tagLensModel, 2, "EF50mm f/1.8 STM"},
+	}}
+	gpsIFD := &testIFD{entries: []testIFDEntry{
+		{tagGPSLatitudeRef, 2, "N"},
+		{tagGPSLatitude, 5, [][2]uint32{{48, 1}, {51, 1}, {30, 1}}},
+		{tagGPSLongitudeRef, 2, "E"},
+		{tagGPSLongitude, 5, [][2]uint32{{2, 1}, {17, 1}, {40, 1}}},
+	}}
+	return &testIFD{entries: []testIFDEntry{
+		{tagMake, 2, "Canon"},
+		{tagModel, 2, "Canon EOS R5"},
+		{tagOrientation, 3, []uint16{6}},
+		{tagExifIFD, 4, exifIFD},
+		{tagGPSIFD, 4, gpsIFD},
+	}}
+}
+
+// buildTestJPEG wraps a TIFF block in a minimal JPEG with an APP1 Exif segment and SOF0
+func buildTestJPEG(tiff []byte, width, height uint16) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8})
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	buf.Write([]byte{0xFF, 0xE1})
+	binary.Write(&buf, binary.BigEndian, uint16(len(app1)+2))
+	buf.Write(app1)
+
+	buf.Write([]byte{0xFF, 0xC0, 0x00, 0x11, 0x08})
+	binary.Write(&buf, binary.BigEndian, height)
+	binary.Write(&buf, binary.BigEndian, width)
+	buf.Write([]byte{0x03, 0x01, 0x22, 0x00, 0x02, 0x11, 0x01, 0x03, 0x11, 0x01})
+
+	buf.Write([]byte{0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+func TestReadEXIFFromTIFF(t *testing.T) {
+	data := buildTestTIFF(sampleEXIFIFD())
+
+	exif, err := ReadEXIF(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to read EXIF: %v", err)
+	}
+
+	if exif.Make != "Canon" || exif.Model != "Canon EOS R5" {
+		t.Errorf("Unexpected camera: %q %q", exif.Make, exif.Model)
+	}
+	if exif.LensModel != "EF50mm f/1.8 STM" {
+		t.Errorf("Unexpected lens: %q", exif.LensModel)
+	}
+	if exif.SerialNumber != "012345" {
+		t.Errorf("Unexpected serial: %q", exif.SerialNumber)
+	}
+	if exif.FNumber == nil || *exif.FNumber != 2.8 {
+		t.Errorf("Expected f/2.8, got %v", exif.FNumber)
+	}
+	if exif.ExposureTime == nil || *exif.ExposureTime != 1.0/250 {
+		t.Errorf("Expected 1/250s, got %v", exif.ExposureTime)
+	}
+	if exif.ISO == nil || *exif.ISO != 400 {
+		t.Errorf("Expected ISO 400, got %v", exif.ISO)
+	}
+	if exif.FocalLength == nil || *exif.FocalLength != 50 {
+		t.Errorf("Expected 50mm, got %v", exif.FocalLength)
+	}
+	if exif.FlashFired == nil || !*exif.FlashFired {
+		t.Error("Expected flash fired")
+	}
+	if exif.Orientation == nil || *exif.Orientation != 6 {
+		t.Errorf("Expected orientation 6, got %v", exif.Orientation)
+	}
+	if exif.Width == nil || *exif.Width != 6000 || exif.Height == nil || *exif.Height != 4000 {
+		t.Errorf("Expected 6000x4000, got %v x %v", exif.Width, exif.Height)
+	}
+
+	expected := time.Date(2024, 6, 15, 14, 30, 0, 0, time.UTC)
+	if !exif.DateTimeOriginal.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, exif.DateTimeOriginal)
+	}
+
+	if exif.GPS == nil {
+		t.Fatal("Expected GPS coordinates")
+	}
+	if math.Abs(exif.GPS.Latitude-48.858333) > 1e-5 || math.Abs(exif.GPS.Longitude-2.294444) > 1e-5 {
+		t.Errorf("Unexpected GPS: %+v", exif.GPS)
+	}
+}
+
+func TestReadEXIFFromJPEG(t *testing.T) {
+	data := buildTestJPEG(buildTestTIFF(sampleEXIFIFD()), 1920, 1280)
+
+	exif, err := ReadEXIF(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to read EXIF: %v", err)
+	}
+
+	if exif.Model != "Canon EOS R5" {
+		t.Errorf("Unexpected model: %q", exif.Model)
+	}
+	// SOF dimensions describe the actual encoded JPEG and take precedence
+	if exif.Width == nil || *exif.Width != 1920 || *exif.Height != 1280 {
+		t.Errorf("Expected 1920x1280, got %v x %v", exif.Width, exif.Height)
+	}
+}
+
+func TestReadEXIFRawSubIFD(t *testing.T) {
+	// NEF/DNG style: IFD0 is a thumbnail, the raw image lives in a sub-IFD
+	raw := &testIFD{entries: []testIFDEntry{
+		{tagNewSubFileType, 4, []uint32{0}},
+		{tagImageWidth, 4, []uint32{8256}},
+		{tagImageLength, 4, []uint32{5504}},
+	}}
+	ifd0 := &testIFD{entries: []testIFDEntry{
+		{tagNewSubFileType, 4, []uint32{1}},
+		{tagImageWidth, 4, []uint32{160}},
+		{tagImageLength, 4, []uint32{120}},
+		{tagMake, 2, "NIKON CORPORATION"},
+		{tagModel, 2, "NIKON D850"},
+		{tagSubIFDs, 4, raw},
+	}}
+	data := buildTestTIFF(ifd0)
+
+	exif, err := ReadEXIF(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to read EXIF: %v", err)
+	}
+	if exif.Width == nil || *exif.Width != 8256 || *exif.Height != 5504 {
+		t.Errorf("Expected 8256x5504, got %v x %v", exif.Width, exif.Height)
+	}
+}
+
+func TestReadEXIFUnsupported(t *testing.T) {
+	data := []byte("not an image file")
+	if _, err := ReadEXIF(bytes.NewReader(data), int64(len(data))); err != ErrNoEXIF {
+		t.Errorf("Expected ErrNoEXIF, got %v", err)
+	}
+}
+
+func TestCameraModelName(t *testing.T) {
+	tests := []struct {
+		make, model, expected string
+	}{
+		{"Canon", "Canon EOS R5", "Canon EOS R5"},
+		{"NIKON CORPORATION", "NIKON D850", "NIKON D850"},
+		{"SONY", "ILCE-7RM4", "SONY ILCE-7RM4"},
+		{"", "X100V", "X100V"},
+		{"  ", "X100V", "X100V"},
+	}
+
+	for _, tc := range tests {
+		d := &EXIFData{Make: tc.make, Model: tc.model}
+		if got := d.cameraModelName(); got != tc.expected {
+			t.Errorf("cameraModelName(%q, %q): expected %q, got %q", tc.make, tc.model, tc.expected, got)
+		}
+	}
+}
+
+func TestAddImageHarvestsEXIF(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	data := buildTestJPEG(buildTestTIFF(sampleEXIFIFD()), 1920, 1280)
+	for _, name := range []string{"IMG_001.jpg", "IMG_002.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	_, images, err := catalog.AddImages([]*ImageInput{
+		{FilePath: filepath.Join(dir, "IMG_001.jpg"), CaptureTime: time.Now()},
+		{FilePath: filepath.Join(dir, "IMG_002.jpg"), CaptureTime: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add images: %v", err)
+	}
+
+	if images[0].Orientation == nil || *images[0].Orientation != 6 {
+		t.Errorf("Expected orientation from EXIF, got %v", images[0].Orientation)
+	}
+	if images[0].Width == nil || *images[0].Width != 1920 {
+		t.Errorf("Expected width from EXIF, got %v", images[0].Width)
+	}
+
+	exif, err := catalog.GetImageEXIF(images[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get image EXIF: %v", err)
+	}
+	if exif == nil {
+		t.Fatal("Expected harvested EXIF")
+	}
+	if exif.Model != "Canon EOS R5" || exif.LensModel != "EF50mm f/1.8 STM" {
+		t.Errorf("Unexpected camera/lens: %q / %q", exif.Model, exif.LensModel)
+	}
+	if exif.FNumber == nil || math.Abs(*exif.FNumber-2.8) > 1e-9 {
+		t.Errorf("Expected f/2.8 round-trip, got %v", exif.FNumber)
+	}
+	if exif.ExposureTime == nil || math.Abs(*exif.ExposureTime-1.0/250) > 1e-9 {
+		t.Errorf("Expected 1/250s round-trip, got %v", exif.ExposureTime)
+	}
+	if exif.GPS == nil {
+		t.Error("Expected GPS to be harvested")
+	}
+
+	// Interned values are shared between images
+	var models int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgInternedExifCameraModel`).Scan(&models)
+	if models != 1 {
+		t.Errorf("Expected 1 interned camera model, got %d", models)
+	}
+}
+
+func TestAddImageWithoutFileSkipsEXIF(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, err := catalog.AddImage(&ImageInput{
+		FilePath:    "/photos/missing.jpg",
+		CaptureTime: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+
+	exif, err := catalog.GetImageEXIF(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get image EXIF: %v", err)
+	}
+	if exif != nil {
+		t.Error("Expected no EXIF for missing file")
+	}
+}
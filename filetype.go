@@ -0,0 +1,145 @@
+package lrcat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Lightroom fileFormat values stored in Adobe_images.fileFormat
+const (
+	FileFormatJPG   = "JPG"
+	FileFormatPNG   = "PNG"
+	FileFormatTIFF  = "TIFF"
+	FileFormatPSD   = "PSD"
+	FileFormatDNG   = "DNG"
+	FileFormatRaw   = "RAW"
+	FileFormatHEIC  = "HEIC"
+	FileFormatAVIF  = "AVIF"
+	FileFormatJXL   = "JXL"
+	FileFormatVideo = "VIDEO"
+)
+
+// ErrUnknownFileType is returned for extensions that have no registered FileType
+var ErrUnknownFileType = errors.New("unknown file type")
+
+// MetadataExtractor reads embedded metadata from a file of a registered type.
+// It returns ErrNoEXIF when the file carries no metadata, and an *fs.PathError
+// when the file cannot be read.
+type MetadataExtractor func(path string) (*EXIFData, error)
+
+// FileType describes a file extension the catalog can import
+type FileType struct {
+	// Extension is the file extension without the leading dot, e.g. "cr3"
+	Extension string
+	// Format is the Lightroom fileFormat, e.g. FileFormatRaw
+	Format string
+	// Raw marks camera raw files (Adobe_AdditionalMetadata.isRawFile)
+	Raw bool
+	// Video marks video files
+	Video bool
+	// Extractor reads embedded metadata. Defaults to ReadEXIFFile;
+	// use NoMetadata for formats without a reader.
+	Extractor MetadataExtractor
+}
+
+// NoMetadata is a MetadataExtractor for formats whose metadata cannot be read
+func NoMetadata(path string) (*EXIFData, error) {
+	return nil, ErrNoEXIF
+}
+
+var (
+	fileTypesMu sync.RWMutex
+	fileTypes   = map[string]FileType{}
+)
+
+func init() {
+	register := func(format string, raw, video bool, extractor MetadataExtractor, exts ...string) {
+		for _, ext := range exts {
+			if err := RegisterFileType(FileType{Extension: ext, Format: format, Raw: raw, Video: video, Extractor: extractor}); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	register(FileFormatJPG, false, false, nil, "jpg", "jpeg", "jpe")
+	register(FileFormatPNG, false, false, NoMetadata, "png")
+	register(FileFormatTIFF, false, false, nil, "tif", "tiff")
+	register(FileFormatPSD, false, false, NoMetadata, "psd", "psb")
+	register(FileFormatDNG, true, false, nil, "dng")
+	register(FileFormatHEIC, false, false, NoMetadata, "heic", "heif", "hif")
+	register(FileFormatAVIF, false, false, NoMetadata, "avif")
+	register(FileFormatJXL, false, false, NoMetadata, "jxl")
+
+	// TIFF-based raw formats carry a readable EXIF structure
+	register(FileFormatRaw, true, false, nil,
+		"cr2", "nef", "nrw", "arw", "srf", "sr2", "orf", "pef", "srw", "rw2", "raw",
+		"3fr", "iiq", "erf", "mrw", "dcr", "kdc", "mos", "mef", "rwl")
+	// Other raw containers are imported without embedded metadata
+	register(FileFormatRaw, true, false, NoMetadata, "cr3", "crw", "raf", "x3f")
+
+	register(FileFormatVideo, false, true, NoMetadata,
+		"mp4", "mov", "avi", "mkv", "m4v", "mts", "m2ts", "3gp", "mpg", "mpeg", "wmv")
+}
+
+// RegisterFileType adds or replaces a file type in the registry
+func RegisterFileType(ft FileType) error {
+	ext := strings.ToLower(strings.TrimPrefix(ft.Extension, "."))
+	if ext == "" || strings.ContainsAny(ext, "./\\") {
+		return fmt.Errorf("invalid file type extension: %q", ft.Extension)
+	}
+	if ft.Format == "" {
+		return fmt.Errorf("file type %s has no Lightroom file format", ext)
+	}
+	ft.Extension = ext
+	if ft.Extractor == nil {
+		ft.Extractor = ReadEXIFFile
+	}
+
+	fileTypesMu.Lock()
+	defer fileTypesMu.Unlock()
+	fileTypes[ext] = ft
+	return nil
+}
+
+// LookupFileType returns the registered type for an extension, with or without the leading dot
+func LookupFileType(ext string) (FileType, bool) {
+	fileTypesMu.RLock()
+	defer fileTypesMu.RUnlock()
+	ft, ok := fileTypes[strings.ToLower(strings.TrimPrefix(ext, "."))]
+	return ft, ok
+}
+
+// FileTypes returns all registered file types sorted by extension
+func FileTypes() []FileType {
+	fileTypesMu.RLock()
+	defer fileTypesMu.RUnlock()
+
+	types := make([]FileType, 0, len(fileTypes))
+	for _, ft := range fileTypes {
+		types = append(types, ft)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Extension < types[j].Extension })
+	return types
+}
+
+// readEmbeddedMetadata reads embedded metadata from path using the extractor
+// registered for its extension
+func readEmbeddedMetadata(path string) (*EXIFData, error) {
+	ft, ok := LookupFileType(fileExtension(path))
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFileType, path)
+	}
+	return ft.Extractor(path)
+}
+
+// fileExtension returns the extension of path without the leading dot
+func fileExtension(path string) string {
+	i := strings.LastIndexByte(path, '.')
+	if i == -1 || strings.ContainsAny(path[i:], `/\`) {
+		return ""
+	}
+	return path[i+1:]
+}
@@ -0,0 +1,134 @@
+package lrcat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupFileType(t *testing.T) {
+	tests := []struct {
+		ext    string
+		format string
+		raw    bool
+		video  bool
+	}{
+		{"jpg", FileFormatJPG, false, false},
+		{".JPEG", FileFormatJPG, false, false},
+		{"heif", FileFormatHEIC, false, false},
+		{"avif", FileFormatAVIF, false, false},
+		{"jxl", FileFormatJXL, false, false},
+		{"dng", FileFormatDNG, true, false},
+		{"crw", FileFormatRaw, true, false},
+		{"3fr", FileFormatRaw, true, false},
+		{"IIQ", FileFormatRaw, true, false},
+		{"x3f", FileFormatRaw, true, false},
+		{"mts", FileFormatVideo, false, true},
+	}
+
+	for _, tc := range tests {
+		ft, ok := LookupFileType(tc.ext)
+		if !ok {
+			t.Errorf("Expected %s to be registered", tc.ext)
+			continue
+		}
+		if ft.Format != tc.format || ft.Raw != tc.raw || ft.Video != tc.video {
+			t.Errorf("LookupFileType(%s): got %+v", tc.ext, ft)
+		}
+		if ft.Extractor == nil {
+			t.Errorf("LookupFileType(%s): expected an extractor", tc.ext)
+		}
+	}
+
+	if _, ok := LookupFileType("txt"); ok {
+		t.Error("Expected txt not to be registered")
+	}
+}
+
+func TestRegisterFileType(t *testing.T) {
+	defer func() {
+		fileTypesMu.Lock()
+		delete(fileTypes, "lrtest")
+		fileTypesMu.Unlock()
+	}()
+
+	model := "Test Camera"
+	err := RegisterFileType(FileType{
+		Extension: ".LRTEST",
+		Format:    FileFormatRaw,
+		Raw:       true,
+		Extractor: func(path string) (*EXIFData, error) {
+			return &EXIFData{Model: model}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to register file type: %v", err)
+	}
+	if !isImageExtension(".lrtest") {
+		t.Error("Expected registered extension to be accepted")
+	}
+
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	image, err := catalog.AddImage(&ImageInput{FilePath: writeTestFile(t, dir, "shot.lrtest", []byte("raw"))})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	if image.FileFormat != FileFormatRaw {
+		t.Errorf("Expected RAW, got %s", image.FileFormat)
+	}
+
+	exif, err := catalog.GetImageEXIF(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get EXIF: %v", err)
+	}
+	if exif == nil || exif.Model != model {
+		t.Errorf("Expected metadata from the registered extractor, got %+v", exif)
+	}
+
+	var isRaw int
+	catalog.DB().QueryRow(`SELECT isRawFile FROM Adobe_AdditionalMetadata WHERE image = ?`, image.ID).Scan(&isRaw)
+	if isRaw != 1 {
+		t.Error("Expected isRawFile to be set")
+	}
+}
+
+func TestRegisterFileTypeErrors(t *testing.T) {
+	if err := RegisterFileType(FileType{Format: FileFormatJPG}); err == nil {
+		t.Error("Expected error for empty extension")
+	}
+	if err := RegisterFileType(FileType{Extension: "tar.gz", Format: FileFormatJPG}); err == nil {
+		t.Error("Expected error for extension containing a dot")
+	}
+	if err := RegisterFileType(FileType{Extension: "xyz"}); err == nil {
+		t.Error("Expected error for missing format")
+	}
+}
+
+func TestFileTypes(t *testing.T) {
+	types := FileTypes()
+	if len(types) < 40 {
+		t.Errorf("Expected the built-in registry, got %d types", len(types))
+	}
+	for i := 1; i < len(types); i++ {
+		if types[i-1].Extension >= types[i].Extension {
+			t.Fatalf("Expected types sorted by extension, got %s before %s", types[i-1].Extension, types[i].Extension)
+		}
+	}
+}
+
+func TestAddImageUnknownFileType(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	_, err := catalog.AddImage(&ImageInput{FilePath: "/photos/notes.txt"})
+	if !errors.Is(err, ErrUnknownFileType) {
+		t.Errorf("Expected ErrUnknownFileType, got %v", err)
+	}
+
+	// An explicit FileFormat bypasses the registry
+	if _, err := catalog.AddImage(&ImageInput{FilePath: "/photos/scan.xyz", FileFormat: FileFormatTIFF}); err != nil {
+		t.Errorf("Expected explicit format to be accepted, got %v", err)
+	}
+}
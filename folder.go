@@ -3,6 +3,7 @@ package lrcat
 import (
 	"database/sql"
 	"fmt"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -10,10 +11,17 @@ import (
 
 // RootFolder represents a root folder in the Lightroom catalog
 type RootFolder struct {
-	ID           int64
-	UUID         string
+	ID   int64
+	UUID string
+	// AbsolutePath is the root's path on this machine, after path mappings
+	// and relativePathFromCatalog are applied
 	AbsolutePath string
 	Name         string
+	// CatalogPath is the absolutePath stored in the catalog
+	CatalogPath string
+	// RelativePathFromCatalog is the root's path relative to the catalog
+	// file's directory, or empty if the root is on another volume
+	RelativePathFromCatalog string
 }
 
 // Folder represents a folder within a root folder
@@ -25,9 +33,17 @@ type Folder struct {
 	PathFromRoot string
 }
 
+// rootFolderColumns are the AgLibraryRootFolder columns read by scanRootFolder
+const rootFolderColumns = `id_local, id_global, absolutePath, name, relativePathFromCatalog`
+
 // AddRootFolder adds a new root folder to the catalog.
 // The path should be an absolute path to the folder.
 func (c *Catalog) AddRootFolder(absolutePath string) (*RootFolder, error) {
+	return c.addRootFolder(c.db, absolutePath)
+}
+
+// addRootFolder inserts a root folder using the given executor
+func (c *Catalog) addRootFolder(db dbExecutor, absolutePath string) (*RootFolder, error) {
 	// Normalize path separators
 	absolutePath = normalizePath(absolutePath)
 
@@ -40,10 +56,12 @@ func (c *Catalog) AddRootFolder(absolutePath string) (*RootFolder, error) {
 	name := filepath.Base(strings.TrimSuffix(absolutePath, "/"))
 
 	uuid := NewUUID()
-	result, err := c.db.Exec(
+	catalogPath := c.catalogPath(absolutePath)
+	relativePath := c.relativePathFromCatalog(absolutePath)
+	result, err := db.Exec(
 		`INSERT INTO AgLibraryRootFolder (id_global, absolutePath, name, relativePathFromCatalog)
 		 VALUES (?, ?, ?, ?)`,
-		uuid, absolutePath, name, nil,
+		uuid, catalogPath, name, nullIfEmpty(relativePath),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add root folder: %w", err)
@@ -54,21 +72,41 @@ func (c *Catalog) AddRootFolder(absolutePath string) (*RootFolder, error) {
 		return nil, fmt.Errorf("failed to get root folder ID: %w", err)
 	}
 
-	return &RootFolder{
-		ID:           id,
-		UUID:         uuid,
-		AbsolutePath: absolutePath,
-		Name:         name,
-	}, nil
+	rf := &RootFolder{
+		ID:                      id,
+		UUID:                    uuid,
+		AbsolutePath:            absolutePath,
+		Name:                    name,
+		CatalogPath:             catalogPath,
+		RelativePathFromCatalog: relativePath,
+	}
+	c.addToRootIndex(db, rf)
+	return rf, nil
+}
+
+// scanRootFolder reads an AgLibraryRootFolder row selected with rootFolderColumns
+func (c *Catalog) scanRootFolder(row interface{ Scan(...interface{}) error }) (*RootFolder, error) {
+	rf := &RootFolder{}
+	var relativePath sql.NullString
+	if err := row.Scan(&rf.ID, &rf.UUID, &rf.CatalogPath, &rf.Name, &relativePath); err != nil {
+		return nil, err
+	}
+	rf.RelativePathFromCatalog = relativePath.String
+	rf.AbsolutePath = c.resolveRootPath(rf.CatalogPath, rf.RelativePathFromCatalog)
+	return rf, nil
 }
 
 // GetRootFolder retrieves a root folder by its ID
 func (c *Catalog) GetRootFolder(id int64) (*RootFolder, error) {
-	rf := &RootFolder{}
-	err := c.db.QueryRow(
-		`SELECT id_local, id_global, absolutePath, name FROM AgLibraryRootFolder WHERE id_local = ?`,
+	return c.getRootFolder(c.db, id)
+}
+
+// getRootFolder retrieves a root folder using the given executor
+func (c *Catalog) getRootFolder(db dbExecutor, id int64) (*RootFolder, error) {
+	rf, err := c.scanRootFolder(db.QueryRow(
+		`SELECT `+rootFolderColumns+` FROM AgLibraryRootFolder WHERE id_local = ?`,
 		id,
-	).Scan(&rf.ID, &rf.UUID, &rf.AbsolutePath, &rf.Name)
+	))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("root folder not found: %d", id)
@@ -78,31 +116,52 @@ func (c *Catalog) GetRootFolder(id int64) (*RootFolder, error) {
 	return rf, nil
 }
 
-// GetRootFolderByPath retrieves a root folder by its absolute path
+// GetRootFolderByPath retrieves a root folder by its absolute path on this
+// machine or as stored in the catalog
 func (c *Catalog) GetRootFolderByPath(absolutePath string) (*RootFolder, error) {
+	return c.getRootFolderByPath(c.db, absolutePath)
+}
+
+// getRootFolderByPath looks up a root folder by path using the given executor
+func (c *Catalog) getRootFolderByPath(db dbExecutor, absolutePath string) (*RootFolder, error) {
 	absolutePath = normalizePath(absolutePath)
 	if !strings.HasSuffix(absolutePath, "/") {
 		absolutePath += "/"
 	}
 
-	rf := &RootFolder{}
-	err := c.db.QueryRow(
-		`SELECT id_local, id_global, absolutePath, name FROM AgLibraryRootFolder WHERE absolutePath = ?`,
-		absolutePath,
-	).Scan(&rf.ID, &rf.UUID, &rf.AbsolutePath, &rf.Name)
+	rf, err := c.scanRootFolder(db.QueryRow(
+		`SELECT `+rootFolderColumns+` FROM AgLibraryRootFolder WHERE absolutePath = ?`,
+		c.catalogPath(absolutePath),
+	))
+	if err == nil {
+		return rf, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// The root may only be found through relativePathFromCatalog
+	roots, err := c.listRootFolders(db)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
 		return nil, err
 	}
-	return rf, nil
+	for _, rf := range roots {
+		if rf.AbsolutePath == absolutePath {
+			return rf, nil
+		}
+	}
+	return nil, nil
 }
 
 // ListRootFolders returns all root folders in the catalog
 func (c *Catalog) ListRootFolders() ([]*RootFolder, error) {
-	rows, err := c.db.Query(
-		`SELECT id_local, id_global, absolutePath, name FROM AgLibraryRootFolder ORDER BY name`,
+	return c.listRootFolders(c.db)
+}
+
+// listRootFolders returns all root folders using the given executor
+func (c *Catalog) listRootFolders(db dbExecutor) ([]*RootFolder, error) {
+	rows, err := db.Query(
+		`SELECT ` + rootFolderColumns + ` FROM AgLibraryRootFolder ORDER BY name`,
 	)
 	if err != nil {
 		return nil, err
@@ -111,8 +170,8 @@ func (c *Catalog) ListRootFolders() ([]*RootFolder, error) {
 
 	var folders []*RootFolder
 	for rows.Next() {
-		rf := &RootFolder{}
-		if err := rows.Scan(&rf.ID, &rf.UUID, &rf.AbsolutePath, &rf.Name); err != nil {
+		rf, err := c.scanRootFolder(rows)
+		if err != nil {
 			return nil, err
 		}
 		folders = append(folders, rf)
@@ -120,9 +179,565 @@ func (c *Catalog) ListRootFolders() ([]*RootFolder, error) {
 	return folders, rows.Err()
 }
 
+// RelocateRootFolder points a root folder at a new location, like
+// Lightroom's "Update Folder Location". Folders and files below the root
+// keep their relative paths. Nothing on disk is moved.
+func (c *Catalog) RelocateRootFolder(id int64, newPath string) (*RootFolder, error) {
+	newPath = normalizePath(newPath)
+	if !strings.HasSuffix(newPath, "/") {
+		newPath += "/"
+	}
+
+	rf, err := c.GetRootFolder(id)
+	if err != nil {
+		return nil, err
+	}
+	if existing, err := c.GetRootFolderByPath(newPath); err != nil {
+		return nil, err
+	} else if existing != nil && existing.ID != id {
+		return nil, fmt.Errorf("root folder already exists at %s", newPath)
+	}
+
+	rf.AbsolutePath = newPath
+	rf.CatalogPath = c.catalogPath(newPath)
+	rf.Name = filepath.Base(strings.TrimSuffix(newPath, "/"))
+	rf.RelativePathFromCatalog = c.relativePathFromCatalog(newPath)
+	if _, err := c.db.Exec(
+		`UPDATE AgLibraryRootFolder SET absolutePath = ?, name = ?, relativePathFromCatalog = ? WHERE id_local = ?`,
+		rf.CatalogPath, rf.Name, nullIfEmpty(rf.RelativePathFromCatalog), id,
+	); err != nil {
+		return nil, fmt.Errorf("failed to relocate root folder: %w", err)
+	}
+	if err := c.invalidateRootIndex(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// ShowParentFolder replaces a root folder with its parent directory, like
+// Lightroom's "Show Parent Folder". The root's folders move one level down,
+// so "2024/" under "/photos/imports/" becomes "imports/2024/" under
+// "/photos/". If a root folder already exists at the parent, the root is
+// merged into it. The returned root folder is the parent.
+func (c *Catalog) ShowParentFolder(rootFolderID int64) (*RootFolder, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rf, err := c.getRootFolder(tx, rootFolderID)
+	if err != nil {
+		return nil, err
+	}
+	parentPath := parentFolderPath(rf.AbsolutePath)
+	if parentPath == "" {
+		return nil, fmt.Errorf("root folder %s has no parent", rf.AbsolutePath)
+	}
+	prefix := strings.TrimPrefix(rf.AbsolutePath, parentPath)
+
+	parent, err := c.getRootFolderByPath(tx, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	if parent != nil {
+		if err := c.mergeRootInto(tx, rf, parent, prefix); err != nil {
+			return nil, err
+		}
+	} else {
+		// Reuse the root's row so its ID stays valid
+		parent = &RootFolder{
+			ID:                      rf.ID,
+			UUID:                    rf.UUID,
+			AbsolutePath:            parentPath,
+			Name:                    filepath.Base(strings.TrimSuffix(parentPath, "/")),
+			CatalogPath:             c.catalogPath(parentPath),
+			RelativePathFromCatalog: c.relativePathFromCatalog(parentPath),
+		}
+		if _, err := tx.Exec(
+			`UPDATE AgLibraryRootFolder SET absolutePath = ?, name = ?, relativePathFromCatalog = ? WHERE id_local = ?`,
+			parent.CatalogPath, parent.Name, nullIfEmpty(parent.RelativePathFromCatalog), rf.ID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to update root folder: %w", err)
+		}
+		if _, err := tx.Exec(
+			`UPDATE AgLibraryFolder SET pathFromRoot = ? || pathFromRoot WHERE rootFolder = ?`,
+			prefix, rf.ID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to update folder paths: %w", err)
+		}
+	}
+	if err := c.relinkFolders(tx, parent.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if err := c.invalidateRootIndex(); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+// PromoteSubfolders turns the top-level subfolders of a root folder into
+// root folders of their own, like Lightroom's "Promote Subfolders". A
+// subfolder whose path already is a root folder is merged into it. The
+// original root folder is removed unless files remain directly in it.
+// The promoted root folders are returned.
+func (c *Catalog) PromoteSubfolders(rootFolderID int64) ([]*RootFolder, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rf, err := c.getRootFolder(tx, rootFolderID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(
+		`SELECT pathFromRoot FROM AgLibraryFolder WHERE rootFolder = ? AND pathFromRoot != '' ORDER BY pathFromRoot`,
+		rf.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var subfolders []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if parentFolderPath(path) == "" {
+			subfolders = append(subfolders, path)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(subfolders) == 0 {
+		return nil, fmt.Errorf("root folder %s has no subfolders", rf.AbsolutePath)
+	}
+
+	var promoted []*RootFolder
+	for _, path := range subfolders {
+		target, err := c.getRootFolderByPath(tx, rf.AbsolutePath+path)
+		if err != nil {
+			return nil, err
+		}
+		if target == nil {
+			if target, err = c.addRootFolder(tx, rf.AbsolutePath+path); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.moveFolders(tx, rf.ID, path, target.ID, ""); err != nil {
+			return nil, err
+		}
+		if err := c.relinkFolders(tx, target.ID); err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, target)
+	}
+
+	var files int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM AgLibraryFile f JOIN AgLibraryFolder fo ON f.folder = fo.id_local WHERE fo.rootFolder = ?`,
+		rf.ID,
+	).Scan(&files); err != nil {
+		return nil, err
+	}
+	if files == 0 {
+		if err := c.deleteRootFolder(tx, rf.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if err := c.invalidateRootIndex(); err != nil {
+		return nil, err
+	}
+	return promoted, nil
+}
+
+// MergeRootFolders combines two root folders into one. If one contains the
+// other, the inner root is merged into the outer one; otherwise both are
+// merged into a root folder at their closest common parent directory, which
+// is created if needed. Folders present in both are combined. The remaining
+// root folder is returned.
+func (c *Catalog) MergeRootFolders(a, b int64) (*RootFolder, error) {
+	if a == b {
+		return nil, fmt.Errorf("cannot merge root folder %d with itself", a)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	ra, err := c.getRootFolder(tx, a)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := c.getRootFolder(tx, b)
+	if err != nil {
+		return nil, err
+	}
+	common := commonFolderPath(ra.AbsolutePath, rb.AbsolutePath)
+	if common == "" {
+		return nil, fmt.Errorf("root folders %s and %s have no common parent", ra.AbsolutePath, rb.AbsolutePath)
+	}
+
+	var target *RootFolder
+	switch common {
+	case ra.AbsolutePath:
+		target = ra
+	case rb.AbsolutePath:
+		target = rb
+	default:
+		if target, err = c.getRootFolderByPath(tx, common); err != nil {
+			return nil, err
+		}
+		if target == nil {
+			if target, err = c.addRootFolder(tx, common); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, rf := range []*RootFolder{ra, rb} {
+		if rf.ID == target.ID {
+			continue
+		}
+		if err := c.mergeRootInto(tx, rf, target, strings.TrimPrefix(rf.AbsolutePath, target.AbsolutePath)); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.relinkFolders(tx, target.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if err := c.invalidateRootIndex(); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// mergeRootInto moves every folder of rf below prefix in target and deletes rf
+func (c *Catalog) mergeRootInto(tx *sql.Tx, rf, target *RootFolder, prefix string) error {
+	if err := c.moveFolders(tx, rf.ID, "", target.ID, prefix); err != nil {
+		return err
+	}
+	return c.deleteRootFolder(tx, rf.ID)
+}
+
+// moveFolders moves the folders of one root whose path starts with
+// fromPrefix to another root, replacing fromPrefix with toPrefix. A folder
+// whose new path already exists is merged into the existing folder: its
+// files and subfolders are moved over and the folder is deleted. The roots
+// must differ; parent links are fixed by relinkFolders.
+func (c *Catalog) moveFolders(tx *sql.Tx, fromRootID int64, fromPrefix string, toRootID int64, toPrefix string) error {
+	rows, err := tx.Query(
+		`SELECT id_local, pathFromRoot FROM AgLibraryFolder
+		 WHERE rootFolder = ? AND substr(pathFromRoot, 1, length(?)) = ?
+		 ORDER BY pathFromRoot`,
+		fromRootID, fromPrefix, fromPrefix,
+	)
+	if err != nil {
+		return err
+	}
+	var folders []*Folder
+	for rows.Next() {
+		f := &Folder{}
+		if err := rows.Scan(&f.ID, &f.PathFromRoot); err != nil {
+			rows.Close()
+			return err
+		}
+		folders = append(folders, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range folders {
+		newPath := toPrefix + strings.TrimPrefix(f.PathFromRoot, fromPrefix)
+
+		var existing int64
+		err := tx.QueryRow(
+			`SELECT id_local FROM AgLibraryFolder WHERE rootFolder = ? AND pathFromRoot = ?`,
+			toRootID, newPath,
+		).Scan(&existing)
+		if err == sql.ErrNoRows {
+			if _, err := tx.Exec(
+				`UPDATE AgLibraryFolder SET rootFolder = ?, pathFromRoot = ? WHERE id_local = ?`,
+				toRootID, newPath, f.ID,
+			); err != nil {
+				return fmt.Errorf("failed to move folder %s: %w", f.PathFromRoot, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE AgLibraryFile SET folder = ? WHERE folder = ?`, existing, f.ID); err != nil {
+			return fmt.Errorf("failed to merge folder %s: %w", f.PathFromRoot, err)
+		}
+		if _, err := tx.Exec(`UPDATE AgLibraryFolder SET parentId = ? WHERE parentId = ?`, existing, f.ID); err != nil {
+			return fmt.Errorf("failed to merge folder %s: %w", f.PathFromRoot, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM AgLibraryFolder WHERE id_local = ?`, f.ID); err != nil {
+			return fmt.Errorf("failed to merge folder %s: %w", f.PathFromRoot, err)
+		}
+	}
+	return nil
+}
+
+// relinkFolders points the parentId of every folder of a root at the folder
+// containing it, creating missing intermediate folders
+func (c *Catalog) relinkFolders(tx *sql.Tx, rootFolderID int64) error {
+	rows, err := tx.Query(
+		`SELECT id_local, pathFromRoot, parentId FROM AgLibraryFolder WHERE rootFolder = ? ORDER BY pathFromRoot`,
+		rootFolderID,
+	)
+	if err != nil {
+		return err
+	}
+	var folders []*Folder
+	for rows.Next() {
+		f := &Folder{}
+		var parentID sql.NullInt64
+		if err := rows.Scan(&f.ID, &f.PathFromRoot, &parentID); err != nil {
+			rows.Close()
+			return err
+		}
+		if parentID.Valid {
+			f.ParentID = &parentID.Int64
+		}
+		folders = append(folders, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, f := range folders {
+		var parentID *int64
+		if f.PathFromRoot != "" {
+			parent, err := c.getOrCreateFolder(tx, rootFolderID, parentFolderPath(f.PathFromRoot))
+			if err != nil {
+				return err
+			}
+			parentID = &parent.ID
+		}
+		if (parentID == nil) == (f.ParentID == nil) && (parentID == nil || *parentID == *f.ParentID) {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE AgLibraryFolder SET parentId = ? WHERE id_local = ?`, parentID, f.ID); err != nil {
+			return fmt.Errorf("failed to link folder %s: %w", f.PathFromRoot, err)
+		}
+	}
+	return nil
+}
+
+// deleteRootFolder deletes a root folder and its remaining folder rows
+func (c *Catalog) deleteRootFolder(db dbExecutor, rootFolderID int64) error {
+	if _, err := db.Exec(`DELETE FROM AgLibraryFolder WHERE rootFolder = ?`, rootFolderID); err != nil {
+		return fmt.Errorf("failed to remove folders: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM AgLibraryRootFolder WHERE id_local = ?`, rootFolderID); err != nil {
+		return fmt.Errorf("failed to remove root folder: %w", err)
+	}
+	return nil
+}
+
+// commonFolderPath returns the deepest directory containing both a and b,
+// which must end with "/", or "" if they are on different volumes
+func commonFolderPath(a, b string) string {
+	pa := strings.Split(strings.TrimSuffix(a, "/"), "/")
+	pb := strings.Split(strings.TrimSuffix(b, "/"), "/")
+	n := 0
+	for n < len(pa) && n < len(pb) && pa[n] == pb[n] {
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+	return strings.Join(pa[:n], "/") + "/"
+}
+
+// RootFolderPolicy decides where a new root folder is created when an image
+// is added from a directory that no existing root folder contains
+type RootFolderPolicy int
+
+const (
+	// RootAtDirectory makes the image's directory the new root folder
+	RootAtDirectory RootFolderPolicy = iota
+	// RootAtParent makes the parent of the image's directory the new root
+	// folder, so sibling import folders share a root
+	RootAtParent
+	// RootAtVolume makes the volume containing the image the new root folder:
+	// a drive ("C:/"), a share ("//server/share/"), a mount under /Volumes,
+	// /media, /run/media or /mnt, or "/"
+	RootAtVolume
+)
+
+// SetRootFolderPolicy sets where new root folders are created. The default is RootAtDirectory.
+func (c *Catalog) SetRootFolderPolicy(policy RootFolderPolicy) {
+	c.rootMu.Lock()
+	defer c.rootMu.Unlock()
+	c.rootPolicy = policy
+}
+
+// RootFolderPolicy returns the policy set by SetRootFolderPolicy
+func (c *Catalog) RootFolderPolicy() RootFolderPolicy {
+	c.rootMu.Lock()
+	defer c.rootMu.Unlock()
+	return c.rootPolicy
+}
+
+// rootFor returns the root folder path for dir, which must end with "/"
+func (p RootFolderPolicy) rootFor(dir string) string {
+	switch p {
+	case RootAtParent:
+		if parent := parentFolderPath(dir); parent != "" && parent != dir {
+			return parent
+		}
+		return dir
+	case RootAtVolume:
+		return volumeRoot(dir)
+	default:
+		return dir
+	}
+}
+
+// volumeRoot returns the volume root of dir, which must end with "/"
+func volumeRoot(dir string) string {
+	parts := strings.Split(dir, "/")
+	prefix := func(n int) string {
+		if len(parts) <= n {
+			return dir
+		}
+		return strings.Join(parts[:n], "/") + "/"
+	}
+
+	switch {
+	case len(parts[0]) == 2 && parts[0][1] == ':':
+		// C:/photos/ -> C:/
+		return prefix(1)
+	case strings.HasPrefix(dir, "//"):
+		// //server/share/photos/ -> //server/share/
+		return prefix(4)
+	case len(parts) > 3 && (parts[1] == "Volumes" || parts[1] == "mnt"):
+		// /Volumes/Card/ or /mnt/card/
+		return prefix(3)
+	case len(parts) > 4 && parts[1] == "media":
+		// /media/user/Card/
+		return prefix(4)
+	case len(parts) > 5 && parts[1] == "run" && parts[2] == "media":
+		// /run/media/user/Card/
+		return prefix(5)
+	default:
+		return "/"
+	}
+}
+
+// rootIndex caches the root folders read through one executor. An index
+// loaded inside a transaction is only reused by that transaction, so roots
+// that are rolled back never leak into later lookups.
+type rootIndex struct {
+	db    dbExecutor
+	roots []*RootFolder
+}
+
+// matchRootFolder returns the root folder with the longest absolutePath
+// containing dir, or nil if no root folder contains it. dir must end with "/".
+func (c *Catalog) matchRootFolder(db dbExecutor, dir string) (*RootFolder, error) {
+	c.rootMu.Lock()
+	index := c.roots
+	c.rootMu.Unlock()
+
+	cached := index != nil && index.db == db
+	for {
+		if !cached {
+			roots, err := c.listRootFolders(db)
+			if err != nil {
+				return nil, err
+			}
+			index = &rootIndex{db: db, roots: roots}
+			c.rootMu.Lock()
+			c.roots = index
+			c.rootMu.Unlock()
+		}
+
+		if best := index.match(dir); best != nil || !cached {
+			return best, nil
+		}
+		// Reload once in case roots were added behind the cache's back
+		cached = false
+	}
+}
+
+// match returns the root folder with the longest path containing dir.
+// Paths are compared whole components at a time, so "/photos/" does not
+// contain "/photos2/".
+func (idx *rootIndex) match(dir string) *RootFolder {
+	var best *RootFolder
+	bestLen := 0
+	for _, rf := range idx.roots {
+		root := rf.AbsolutePath
+		if !strings.HasSuffix(root, "/") {
+			root += "/"
+		}
+		if strings.HasPrefix(dir, root) && len(root) > bestLen {
+			best, bestLen = rf, len(root)
+		}
+	}
+	return best
+}
+
+// addToRootIndex records a new root folder in the cached index for db
+func (c *Catalog) addToRootIndex(db dbExecutor, rf *RootFolder) {
+	c.rootMu.Lock()
+	defer c.rootMu.Unlock()
+	if c.roots != nil && c.roots.db == db {
+		c.roots.roots = append(c.roots.roots, rf)
+	} else {
+		c.roots = nil
+	}
+}
+
+// invalidateRootIndex drops the cached root folders after roots are changed
+// and looks up the mappings found through relativePathFromCatalog again.
+// It must be called after the change is committed.
+func (c *Catalog) invalidateRootIndex() error {
+	c.rootMu.Lock()
+	c.roots = nil
+	c.rootMappings = nil
+	c.rootMu.Unlock()
+	return c.resolveRootMappings()
+}
+
 // AddFolder adds a new folder within a root folder.
 // pathFromRoot is the relative path from the root folder (e.g., "2024/January/")
 func (c *Catalog) AddFolder(rootFolderID int64, pathFromRoot string) (*Folder, error) {
+	return c.addFolder(c.db, rootFolderID, pathFromRoot)
+}
+
+// addFolder inserts a folder using the given executor. Missing ancestor
+// folders are created first so parentId always links to the parent folder;
+// the root's top folder ("") has no parent.
+func (c *Catalog) addFolder(db dbExecutor, rootFolderID int64, pathFromRoot string) (*Folder, error) {
 	// Normalize path
 	pathFromRoot = normalizePath(pathFromRoot)
 
@@ -131,11 +746,20 @@ func (c *Catalog) AddFolder(rootFolderID int64, pathFromRoot string) (*Folder, e
 		pathFromRoot += "/"
 	}
 
+	var parentID *int64
+	if pathFromRoot != "" {
+		parent, err := c.getOrCreateFolder(db, rootFolderID, parentFolderPath(pathFromRoot))
+		if err != nil {
+			return nil, err
+		}
+		parentID = &parent.ID
+	}
+
 	uuid := NewUUID()
-	result, err := c.db.Exec(
+	result, err := db.Exec(
 		`INSERT INTO AgLibraryFolder (id_global, rootFolder, pathFromRoot, parentId, visibility)
 		 VALUES (?, ?, ?, ?, ?)`,
-		uuid, rootFolderID, pathFromRoot, nil, nil,
+		uuid, rootFolderID, pathFromRoot, parentID, nil,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add folder: %w", err)
@@ -150,15 +774,32 @@ func (c *Catalog) AddFolder(rootFolderID int64, pathFromRoot string) (*Folder, e
 		ID:           id,
 		UUID:         uuid,
 		RootFolderID: rootFolderID,
+		ParentID:     parentID,
 		PathFromRoot: pathFromRoot,
 	}, nil
 }
 
+// parentFolderPath returns the pathFromRoot of the folder containing
+// pathFromRoot, e.g. "2024/" for "2024/January/" and "" for "2024/"
+func parentFolderPath(pathFromRoot string) string {
+	trimmed := strings.TrimSuffix(pathFromRoot, "/")
+	i := strings.LastIndexByte(trimmed, '/')
+	if i == -1 {
+		return ""
+	}
+	return trimmed[:i+1]
+}
+
 // GetFolder retrieves a folder by its ID
 func (c *Catalog) GetFolder(id int64) (*Folder, error) {
+	return c.getFolder(c.db, id)
+}
+
+// getFolder retrieves a folder using the given executor
+func (c *Catalog) getFolder(db dbExecutor, id int64) (*Folder, error) {
 	f := &Folder{}
 	var parentID sql.NullInt64
-	err := c.db.QueryRow(
+	err := db.QueryRow(
 		`SELECT id_local, id_global, rootFolder, pathFromRoot, parentId FROM AgLibraryFolder WHERE id_local = ?`,
 		id,
 	).Scan(&f.ID, &f.UUID, &f.RootFolderID, &f.PathFromRoot, &parentID)
@@ -176,6 +817,11 @@ func (c *Catalog) GetFolder(id int64) (*Folder, error) {
 
 // GetOrCreateFolder gets an existing folder or creates it if it doesn't exist
 func (c *Catalog) GetOrCreateFolder(rootFolderID int64, pathFromRoot string) (*Folder, error) {
+	return c.getOrCreateFolder(c.db, rootFolderID, pathFromRoot)
+}
+
+// getOrCreateFolder looks up or creates a folder using the given executor
+func (c *Catalog) getOrCreateFolder(db dbExecutor, rootFolderID int64, pathFromRoot string) (*Folder, error) {
 	pathFromRoot = normalizePath(pathFromRoot)
 	if pathFromRoot != "" && !strings.HasSuffix(pathFromRoot, "/") {
 		pathFromRoot += "/"
@@ -184,7 +830,7 @@ func (c *Catalog) GetOrCreateFolder(rootFolderID int64, pathFromRoot string) (*F
 	// Try to find existing folder
 	f := &Folder{}
 	var parentID sql.NullInt64
-	err := c.db.QueryRow(
+	err := db.QueryRow(
 		`SELECT id_local, id_global, rootFolder, pathFromRoot, parentId FROM AgLibraryFolder
 		 WHERE rootFolder = ? AND pathFromRoot = ?`,
 		rootFolderID, pathFromRoot,
@@ -202,7 +848,7 @@ func (c *Catalog) GetOrCreateFolder(rootFolderID int64, pathFromRoot string) (*F
 	}
 
 	// Create new folder
-	return c.AddFolder(rootFolderID, pathFromRoot)
+	return c.addFolder(db, rootFolderID, pathFromRoot)
 }
 
 // ListFolders returns all folders under a root folder
@@ -232,6 +878,401 @@ func (c *Catalog) ListFolders(rootFolderID int64) ([]*Folder, error) {
 	return folders, rows.Err()
 }
 
+// GetFolderChildren returns the direct subfolders of a folder
+func (c *Catalog) GetFolderChildren(folderID int64) ([]*Folder, error) {
+	rows, err := c.db.Query(
+		`SELECT id_local, id_global, rootFolder, pathFromRoot, parentId FROM AgLibraryFolder
+		 WHERE parentId = ? ORDER BY pathFromRoot`,
+		folderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []*Folder
+	for rows.Next() {
+		f := &Folder{}
+		var parentID sql.NullInt64
+		if err := rows.Scan(&f.ID, &f.UUID, &f.RootFolderID, &f.PathFromRoot, &parentID); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			f.ParentID = &parentID.Int64
+		}
+		folders = append(folders, f)
+	}
+	return folders, rows.Err()
+}
+
+// FolderNode is a folder in the tree returned by GetFolderTree
+type FolderNode struct {
+	// Folder is nil for the top node of a root folder that has no top folder row
+	Folder *Folder
+	// Name is the last component of the folder path, or the root folder's
+	// name for the top node
+	Name string
+	// ImageCount is the number of images directly in the folder
+	ImageCount int
+	// TotalImageCount also includes the images of all subfolders
+	TotalImageCount int
+	Children        []*FolderNode
+}
+
+// GetFolderTree returns the folders of a root folder as a tree, with image
+// counts per folder. The returned node is the root's top folder.
+func (c *Catalog) GetFolderTree(rootFolderID int64) (*FolderNode, error) {
+	root, err := c.GetRootFolder(rootFolderID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(
+		`SELECT fo.id_local, fo.id_global, fo.rootFolder, fo.pathFromRoot, fo.parentId, COUNT(i.id_local)
+		 FROM AgLibraryFolder fo
+		 LEFT JOIN AgLibraryFile f ON f.folder = fo.id_local
+		 LEFT JOIN Adobe_images i ON i.rootFile = f.id_local
+		 WHERE fo.rootFolder = ?
+		 GROUP BY fo.id_local
+		 ORDER BY fo.pathFromRoot`,
+		rootFolderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := &FolderNode{Name: root.Name}
+	nodes := map[int64]*FolderNode{}
+	var ordered []*FolderNode
+	for rows.Next() {
+		f := &Folder{}
+		var parentID sql.NullInt64
+		node := &FolderNode{Folder: f}
+		if err := rows.Scan(&f.ID, &f.UUID, &f.RootFolderID, &f.PathFromRoot, &parentID, &node.ImageCount); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			f.ParentID = &parentID.Int64
+		}
+
+		if f.PathFromRoot == "" {
+			top.Folder, top.ImageCount = f, node.ImageCount
+			nodes[f.ID] = top
+			continue
+		}
+		node.Name = filepath.Base(strings.TrimSuffix(f.PathFromRoot, "/"))
+		nodes[f.ID] = node
+		ordered = append(ordered, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Folders without a known parent hang off the top node
+	for _, node := range ordered {
+		parent := top
+		if node.Folder.ParentID != nil {
+			if p, ok := nodes[*node.Folder.ParentID]; ok && p != node {
+				parent = p
+			}
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	top.sumImageCounts()
+	return top, nil
+}
+
+// sumImageCounts sets TotalImageCount for n and its descendants
+func (n *FolderNode) sumImageCounts() int {
+	n.TotalImageCount = n.ImageCount
+	for _, child := range n.Children {
+		n.TotalImageCount += child.sumImageCounts()
+	}
+	return n.TotalImageCount
+}
+
+// backfillFolderParents links folders written without a parentId, as older
+// versions of this package did, creating missing intermediate folders
+func (c *Catalog) backfillFolderParents() error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT id_local, rootFolder, pathFromRoot FROM AgLibraryFolder
+		 WHERE parentId IS NULL AND pathFromRoot != ''
+		 ORDER BY pathFromRoot`,
+	)
+	if err != nil {
+		return err
+	}
+	var orphans []*Folder
+	for rows.Next() {
+		f := &Folder{}
+		if err := rows.Scan(&f.ID, &f.RootFolderID, &f.PathFromRoot); err != nil {
+			rows.Close()
+			return err
+		}
+		orphans = append(orphans, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	for _, f := range orphans {
+		parent, err := c.getOrCreateFolder(tx, f.RootFolderID, parentFolderPath(f.PathFromRoot))
+		if err != nil {
+			return fmt.Errorf("failed to create parent of folder %d: %w", f.ID, err)
+		}
+		if _, err := tx.Exec(`UPDATE AgLibraryFolder SET parentId = ? WHERE id_local = ?`, parent.ID, f.ID); err != nil {
+			return fmt.Errorf("failed to link folder %d: %w", f.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// FolderOptions controls RenameFolder, MoveFolder and RemoveFolder
+type FolderOptions struct {
+	// UpdateDisk also renames, moves or deletes the directory on disk. A
+	// rename or move is undone if the catalog update fails; RemoveFolder
+	// deletes the directory and everything in it only after the catalog
+	// change is committed.
+	UpdateDisk bool
+}
+
+// RenameFolder renames a folder. The pathFromRoot of the folder and all of
+// its subfolders is updated; files keep their folder. newName must be a
+// single path component.
+func (c *Catalog) RenameFolder(folderID int64, newName string, opts *FolderOptions) (*Folder, error) {
+	if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+		return nil, fmt.Errorf("invalid folder name: %q", newName)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	folder, err := c.getFolder(tx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.PathFromRoot == "" {
+		return nil, fmt.Errorf("cannot rename the top folder of a root folder; use RelocateRootFolder")
+	}
+
+	newPath := parentFolderPath(folder.PathFromRoot) + newName + "/"
+	return c.relocateFolder(tx, folder, folder.RootFolderID, folder.ParentID, newPath, opts)
+}
+
+// MoveFolder moves a folder and its subfolders below newParentID, which may
+// be in another root folder. To move a folder to the top level of a root,
+// pass the root's top folder (GetOrCreateFolder(rootID, "")).
+func (c *Catalog) MoveFolder(folderID, newParentID int64, opts *FolderOptions) (*Folder, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	folder, err := c.getFolder(tx, folderID)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := c.getFolder(tx, newParentID)
+	if err != nil {
+		return nil, err
+	}
+	if folder.PathFromRoot == "" {
+		return nil, fmt.Errorf("cannot move the top folder of a root folder; use RelocateRootFolder")
+	}
+	if parent.RootFolderID == folder.RootFolderID && strings.HasPrefix(parent.PathFromRoot, folder.PathFromRoot) {
+		return nil, fmt.Errorf("cannot move folder %s into itself", folder.PathFromRoot)
+	}
+
+	name := filepath.Base(strings.TrimSuffix(folder.PathFromRoot, "/"))
+	return c.relocateFolder(tx, folder, parent.RootFolderID, &parent.ID, parent.PathFromRoot+name+"/", opts)
+}
+
+// relocateFolder gives folder a new root, parent and path, rewrites the
+// paths of its subfolders and commits tx
+func (c *Catalog) relocateFolder(tx *sql.Tx, folder *Folder, rootFolderID int64, parentID *int64, newPath string, opts *FolderOptions) (*Folder, error) {
+	if rootFolderID == folder.RootFolderID && newPath == folder.PathFromRoot {
+		return folder, tx.Commit()
+	}
+
+	var conflicts int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM AgLibraryFolder WHERE rootFolder = ? AND pathFromRoot = ?`,
+		rootFolderID, newPath,
+	).Scan(&conflicts); err != nil {
+		return nil, err
+	}
+	if conflicts > 0 {
+		return nil, fmt.Errorf("folder already exists: %s", newPath)
+	}
+
+	var oldDir, newDir string
+	if opts != nil && opts.UpdateDisk {
+		var err error
+		if oldDir, err = c.folderDir(tx, folder.RootFolderID, folder.PathFromRoot); err != nil {
+			return nil, err
+		}
+		if newDir, err = c.folderDir(tx, rootFolderID, newPath); err != nil {
+			return nil, err
+		}
+		if _, err := os.Lstat(newDir); err == nil {
+			return nil, fmt.Errorf("destination directory already exists: %s", newDir)
+		}
+		if err := os.Rename(oldDir, newDir); err != nil {
+			return nil, fmt.Errorf("failed to move %s: %w", oldDir, err)
+		}
+	}
+	undoMove := func() {
+		if newDir != "" {
+			os.Rename(newDir, oldDir)
+		}
+	}
+
+	_, err := tx.Exec(
+		`UPDATE AgLibraryFolder SET rootFolder = ?, pathFromRoot = ? || substr(pathFromRoot, length(?) + 1)
+		 WHERE rootFolder = ? AND substr(pathFromRoot, 1, length(?)) = ?`,
+		rootFolderID, newPath, folder.PathFromRoot,
+		folder.RootFolderID, folder.PathFromRoot, folder.PathFromRoot,
+	)
+	if err != nil {
+		undoMove()
+		return nil, fmt.Errorf("failed to update folder paths: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE AgLibraryFolder SET parentId = ? WHERE id_local = ?`, parentID, folder.ID); err != nil {
+		undoMove()
+		return nil, fmt.Errorf("failed to update folder parent: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		undoMove()
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	folder.RootFolderID = rootFolderID
+	folder.ParentID = parentID
+	folder.PathFromRoot = newPath
+	return folder, nil
+}
+
+// RemoveFolder removes a folder from the catalog. With recursive its
+// subfolders are removed too; otherwise a folder with subfolders is an
+// error. With removeImages the images in the removed folders are removed
+// as by RemoveImage; otherwise a folder containing files is an error.
+func (c *Catalog) RemoveFolder(folderID int64, recursive, removeImages bool, opts *FolderOptions) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	folder, err := c.getFolder(tx, folderID)
+	if err != nil {
+		return err
+	}
+	if folder.PathFromRoot == "" {
+		return fmt.Errorf("cannot remove the top folder of a root folder")
+	}
+
+	var subfolders int
+	if err := tx.QueryRow(
+		`SELECT COUNT(*) FROM AgLibraryFolder
+		 WHERE rootFolder = ? AND substr(pathFromRoot, 1, length(?)) = ? AND id_local != ?`,
+		folder.RootFolderID, folder.PathFromRoot, folder.PathFromRoot, folder.ID,
+	).Scan(&subfolders); err != nil {
+		return err
+	}
+	if subfolders > 0 && !recursive {
+		return fmt.Errorf("folder %s has %d subfolders", folder.PathFromRoot, subfolders)
+	}
+
+	rows, err := tx.Query(
+		`SELECT f.id_local FROM AgLibraryFile f
+		 JOIN AgLibraryFolder fo ON f.folder = fo.id_local
+		 WHERE fo.rootFolder = ? AND substr(fo.pathFromRoot, 1, length(?)) = ?`,
+		folder.RootFolderID, folder.PathFromRoot, folder.PathFromRoot,
+	)
+	if err != nil {
+		return err
+	}
+	var fileIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		fileIDs = append(fileIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(fileIDs) > 0 && !removeImages {
+		return fmt.Errorf("folder %s contains %d files", folder.PathFromRoot, len(fileIDs))
+	}
+
+	for _, id := range fileIDs {
+		if err := c.removeFileImages(tx, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(
+		`DELETE FROM AgLibraryFolder WHERE rootFolder = ? AND substr(pathFromRoot, 1, length(?)) = ?`,
+		folder.RootFolderID, folder.PathFromRoot, folder.PathFromRoot,
+	); err != nil {
+		return fmt.Errorf("failed to remove folder: %w", err)
+	}
+
+	var dir string
+	if opts != nil && opts.UpdateDisk {
+		if dir, err = c.folderDir(tx, folder.RootFolderID, folder.PathFromRoot); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if dir != "" {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("folder removed from catalog but not from disk: %w", err)
+		}
+	}
+	return nil
+}
+
+// folderDir returns the local directory of a folder
+func (c *Catalog) folderDir(db dbExecutor, rootFolderID int64, pathFromRoot string) (string, error) {
+	var rootPath string
+	var relativePath sql.NullString
+	err := db.QueryRow(
+		`SELECT absolutePath, relativePathFromCatalog FROM AgLibraryRootFolder WHERE id_local = ?`,
+		rootFolderID,
+	).Scan(&rootPath, &relativePath)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("root folder not found: %d", rootFolderID)
+		}
+		return "", err
+	}
+	dir := c.resolveRootPath(rootPath, relativePath.String) + pathFromRoot
+	return filepath.FromSlash(strings.TrimSuffix(dir, "/")), nil
+}
+
 // normalizePath converts Windows backslashes to forward slashes
 func normalizePath(path string) string {
 	if runtime.GOOS == "windows" {
@@ -1,6 +1,8 @@
 package lrcat
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -176,8 +178,216 @@ func TestListFolders(t *testing.T) {
 		t.Fatalf("Failed to list folders: %v", err)
 	}
 
-	if len(folders) != 2 {
-		t.Errorf("Expected 2 folders, got %d", len(folders))
+	// The top folder and "2024/" are created as intermediate folders
+	if len(folders) != 4 {
+		t.Errorf("Expected 4 folders, got %d", len(folders))
+	}
+}
+
+func TestAddFolderCreatesParents(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	rf, _ := catalog.AddRootFolder("/photos")
+	january, err := catalog.AddFolder(rf.ID, "2024/January")
+	if err != nil {
+		t.Fatalf("Failed to add folder: %v", err)
+	}
+
+	year, err := catalog.GetOrCreateFolder(rf.ID, "2024")
+	if err != nil {
+		t.Fatalf("Failed to get parent folder: %v", err)
+	}
+	top, err := catalog.GetOrCreateFolder(rf.ID, "")
+	if err != nil {
+		t.Fatalf("Failed to get top folder: %v", err)
+	}
+
+	if january.ParentID == nil || *january.ParentID != year.ID {
+		t.Errorf("Expected January's parent to be %d, got %v", year.ID, january.ParentID)
+	}
+	if year.ParentID == nil || *year.ParentID != top.ID {
+		t.Errorf("Expected 2024's parent to be the top folder %d, got %v", top.ID, year.ParentID)
+	}
+	if top.ParentID != nil {
+		t.Errorf("Expected the top folder to have no parent, got %d", *top.ParentID)
+	}
+
+	children, err := catalog.GetFolderChildren(year.ID)
+	if err != nil {
+		t.Fatalf("Failed to get children: %v", err)
+	}
+	if len(children) != 1 || children[0].ID != january.ID {
+		t.Errorf("Expected January as the only child of 2024, got %v", children)
+	}
+}
+
+func TestGetFolderTree(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	rf, _ := catalog.AddRootFolder("/photos")
+	for _, path := range []string{
+		"/photos/cover.jpg",
+		"/photos/2024/January/a.jpg",
+		"/photos/2024/January/b.jpg",
+		"/photos/2024/February/c.jpg",
+		"/photos/2023/d.jpg",
+	} {
+		if _, err := catalog.AddImage(&ImageInput{FilePath: path}); err != nil {
+			t.Fatalf("Failed to add image: %v", err)
+		}
+	}
+
+	tree, err := catalog.GetFolderTree(rf.ID)
+	if err != nil {
+		t.Fatalf("Failed to get folder tree: %v", err)
+	}
+	if tree.Name != "photos" || tree.ImageCount != 1 || tree.TotalImageCount != 5 {
+		t.Errorf("Unexpected top node: %s %d/%d", tree.Name, tree.ImageCount, tree.TotalImageCount)
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Name != "2023" || tree.Children[1].Name != "2024" {
+		t.Fatalf("Expected children 2023 and 2024, got %v", tree.Children)
+	}
+
+	year := tree.Children[1]
+	if year.ImageCount != 0 || year.TotalImageCount != 3 || len(year.Children) != 2 {
+		t.Errorf("Unexpected 2024 node: %d/%d with %d children", year.ImageCount, year.TotalImageCount, len(year.Children))
+	}
+	if year.Children[1].Name != "January" || year.Children[1].ImageCount != 2 {
+		t.Errorf("Unexpected January node: %+v", year.Children[1])
+	}
+
+	if _, err := catalog.GetFolderTree(999); err == nil {
+		t.Error("Expected an error for an unknown root folder")
+	}
+}
+
+func TestBackfillFolderParents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.lrcat")
+	catalog, err := NewCatalog(path)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+
+	// Folders as written by older versions: leaf only, no parentId
+	rf, _ := catalog.AddRootFolder("/photos")
+	if _, err := catalog.DB().Exec(
+		`INSERT INTO AgLibraryFolder (id_global, rootFolder, pathFromRoot) VALUES (?, ?, '2024/January/')`,
+		NewUUID(), rf.ID,
+	); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+	catalog.Close()
+
+	catalog, err = OpenCatalog(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	folders, _ := catalog.ListFolders(rf.ID)
+	if len(folders) != 3 {
+		t.Fatalf("Expected the top and 2024 folders to be created, got %d folders", len(folders))
+	}
+	for _, f := range folders {
+		if (f.PathFromRoot == "") != (f.ParentID == nil) {
+			t.Errorf("Folder %q has parent %v", f.PathFromRoot, f.ParentID)
+		}
+	}
+}
+
+func TestRootFolderLongestPrefix(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	// Listed by name, "photos" comes before "zz"; the nested root must still win
+	photos, _ := catalog.AddRootFolder("/photos")
+	nested, _ := catalog.AddRootFolder("/photos/zz")
+	catalog.AddRootFolder("/photo")
+
+	tests := []struct {
+		path string
+		root int64
+		dir  string
+	}{
+		{"/photos/zz/a.jpg", nested.ID, ""},
+		{"/photos/zz/2024/b.jpg", nested.ID, "2024/"},
+		{"/photos/zzz/c.jpg", photos.ID, "zzz/"},
+		{"/photos/d.jpg", photos.ID, ""},
+	}
+	for _, tc := range tests {
+		image, err := catalog.AddImage(&ImageInput{FilePath: tc.path})
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", tc.path, err)
+		}
+		file, err := catalog.GetImageFile(image.ID)
+		if err != nil {
+			t.Fatalf("Failed to get file: %v", err)
+		}
+		folder, _ := catalog.GetFolder(file.FolderID)
+		if folder.RootFolderID != tc.root || folder.PathFromRoot != tc.dir {
+			t.Errorf("%s: expected root %d folder %q, got root %d folder %q",
+				tc.path, tc.root, tc.dir, folder.RootFolderID, folder.PathFromRoot)
+		}
+	}
+
+	roots, _ := catalog.ListRootFolders()
+	if len(roots) != 3 {
+		t.Errorf("Expected no new root folders, got %d", len(roots))
+	}
+
+	// Roots added behind the cache's back are still found
+	if _, err := catalog.DB().Exec(
+		`INSERT INTO AgLibraryRootFolder (id_global, absolutePath, name) VALUES (?, '/archive/', 'archive')`,
+		NewUUID(),
+	); err != nil {
+		t.Fatalf("Failed to insert root folder: %v", err)
+	}
+	image, err := catalog.AddImage(&ImageInput{FilePath: "/archive/2019/e.jpg"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	path, _ := catalog.GetImagePath(image.ID)
+	if roots, _ = catalog.ListRootFolders(); len(roots) != 4 || path != "/archive/2019/e.jpg" {
+		t.Errorf("Expected the existing /archive/ root to be used, got %d roots and %s", len(roots), path)
+	}
+}
+
+func TestRootFolderPolicy(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	catalog.SetRootFolderPolicy(RootAtParent)
+	catalog.AddImage(&ImageInput{FilePath: "/imports/2024-06-15/a.jpg"})
+	catalog.AddImage(&ImageInput{FilePath: "/imports/2024-06-16/b.jpg"})
+
+	catalog.SetRootFolderPolicy(RootAtVolume)
+	catalog.AddImage(&ImageInput{FilePath: "/Volumes/Card/DCIM/100CANON/c.jpg"})
+
+	roots, _ := catalog.ListRootFolders()
+	var paths []string
+	for _, rf := range roots {
+		paths = append(paths, rf.AbsolutePath)
+	}
+	if len(paths) != 2 || paths[0] != "/Volumes/Card/" || paths[1] != "/imports/" {
+		t.Errorf("Expected roots /Volumes/Card/ and /imports/, got %v", paths)
+	}
+
+	volumes := map[string]string{
+		"C:/Users/me/Pictures/":    "C:/",
+		"//nas/photos/2024/":       "//nas/photos/",
+		"/Volumes/Card/DCIM/":      "/Volumes/Card/",
+		"/media/me/Card/DCIM/":     "/media/me/Card/",
+		"/run/media/me/Card/DCIM/": "/run/media/me/Card/",
+		"/mnt/archive/2024/":       "/mnt/archive/",
+		"/home/me/Pictures/":       "/",
+		"/Volumes/":                "/",
+	}
+	for dir, want := range volumes {
+		if got := volumeRoot(dir); got != want {
+			t.Errorf("volumeRoot(%s): expected %s, got %s", dir, want, got)
+		}
 	}
 }
 
@@ -200,3 +410,303 @@ func TestNormalizePath(t *testing.T) {
 		}
 	}
 }
+
+func TestRenameFolder(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := normalizePath(t.TempDir())
+	root, _ := catalog.AddRootFolder(dir)
+	photo := writeTestFile(t, dir, "2024/June/Day1/a.jpg", []byte("a"))
+	image, err := catalog.AddImage(&ImageInput{FilePath: photo})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	june, _ := catalog.GetOrCreateFolder(root.ID, "2024/June")
+	day1, _ := catalog.GetOrCreateFolder(root.ID, "2024/June/Day1")
+	catalog.AddFolder(root.ID, "2024/July")
+
+	if _, err := catalog.RenameFolder(june.ID, "July", nil); err == nil {
+		t.Error("Expected renaming onto an existing folder to fail")
+	}
+	if _, err := catalog.RenameFolder(june.ID, "a/b", nil); err == nil {
+		t.Error("Expected a name with a separator to be rejected")
+	}
+	top, _ := catalog.GetOrCreateFolder(root.ID, "")
+	if _, err := catalog.RenameFolder(top.ID, "x", nil); err == nil {
+		t.Error("Expected renaming a top folder to fail")
+	}
+
+	renamed, err := catalog.RenameFolder(june.ID, "Summer", &FolderOptions{UpdateDisk: true})
+	if err != nil {
+		t.Fatalf("Failed to rename folder: %v", err)
+	}
+	if renamed.PathFromRoot != "2024/Summer/" {
+		t.Errorf("Expected 2024/Summer/, got %s", renamed.PathFromRoot)
+	}
+	day1, _ = catalog.GetFolder(day1.ID)
+	if day1.PathFromRoot != "2024/Summer/Day1/" || *day1.ParentID != june.ID {
+		t.Errorf("Expected the subfolder to be renamed with its parent, got %+v", day1)
+	}
+	folders, _ := catalog.ListFolders(root.ID)
+	if len(folders) != 5 {
+		t.Errorf("Expected no folders to be added, got %d", len(folders))
+	}
+
+	want := dir + "/2024/Summer/Day1/a.jpg"
+	if path, _ := catalog.GetImagePath(image.ID); path != want {
+		t.Errorf("Expected %s, got %s", want, path)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("Expected the directory to be renamed on disk: %v", err)
+	}
+}
+
+func TestMoveFolder(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := normalizePath(t.TempDir())
+	photo := writeTestFile(t, dir, "inbox/shoot/a.jpg", []byte("a"))
+	os.MkdirAll(filepath.Join(dir, "archive"), 0755)
+
+	inbox, _ := catalog.AddRootFolder(dir + "/inbox")
+	archive, _ := catalog.AddRootFolder(dir + "/archive")
+	image, err := catalog.AddImage(&ImageInput{FilePath: photo})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	shoot, _ := catalog.GetOrCreateFolder(inbox.ID, "shoot")
+	nested, _ := catalog.AddFolder(inbox.ID, "shoot/selects")
+	archiveTop, _ := catalog.GetOrCreateFolder(archive.ID, "")
+
+	if _, err := catalog.MoveFolder(shoot.ID, nested.ID, nil); err == nil {
+		t.Error("Expected moving a folder into itself to fail")
+	}
+
+	moved, err := catalog.MoveFolder(shoot.ID, archiveTop.ID, &FolderOptions{UpdateDisk: true})
+	if err != nil {
+		t.Fatalf("Failed to move folder: %v", err)
+	}
+	if moved.RootFolderID != archive.ID || moved.PathFromRoot != "shoot/" || *moved.ParentID != archiveTop.ID {
+		t.Errorf("Unexpected moved folder: %+v", moved)
+	}
+	nested, _ = catalog.GetFolder(nested.ID)
+	if nested.RootFolderID != archive.ID || nested.PathFromRoot != "shoot/selects/" {
+		t.Errorf("Expected the subfolder to move along, got %+v", nested)
+	}
+
+	want := dir + "/archive/shoot/a.jpg"
+	if path, _ := catalog.GetImagePath(image.ID); path != want {
+		t.Errorf("Expected %s, got %s", want, path)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("Expected the file to be moved on disk: %v", err)
+	}
+	if exists, _ := catalog.ImageExists(want); !exists {
+		t.Error("Expected ImageExists to find the moved file")
+	}
+
+	// A failed disk move leaves the catalog untouched
+	again, _ := catalog.AddFolder(inbox.ID, "missing")
+	if _, err := catalog.MoveFolder(again.ID, archiveTop.ID, &FolderOptions{UpdateDisk: true}); err == nil {
+		t.Error("Expected moving a directory that does not exist to fail")
+	}
+	if f, _ := catalog.GetFolder(again.ID); f.RootFolderID != inbox.ID {
+		t.Errorf("Expected the folder to stay in place, got %+v", f)
+	}
+}
+
+func TestRemoveFolder(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := normalizePath(t.TempDir())
+	root, _ := catalog.AddRootFolder(dir)
+	a := writeTestFile(t, dir, "2024/a.jpg", []byte("a"))
+	b := writeTestFile(t, dir, "2024/June/b.jpg", []byte("b"))
+	imageA, _ := catalog.AddImage(&ImageInput{FilePath: a})
+	imageB, _ := catalog.AddImage(&ImageInput{FilePath: b})
+	collection, _ := catalog.AddCollection("Picks", CollectionTypeStandard, nil)
+	catalog.AddImageToCollection(imageB.ID, collection.ID)
+	empty, _ := catalog.AddFolder(root.ID, "empty")
+
+	year, _ := catalog.GetOrCreateFolder(root.ID, "2024")
+	if err := catalog.RemoveFolder(year.ID, false, true, nil); err == nil {
+		t.Error("Expected a folder with subfolders to need recursive")
+	}
+	if err := catalog.RemoveFolder(year.ID, true, false, nil); err == nil {
+		t.Error("Expected a folder with files to need removeImages")
+	}
+	if err := catalog.RemoveFolder(empty.ID, false, false, nil); err != nil {
+		t.Errorf("Failed to remove empty folder: %v", err)
+	}
+
+	if err := catalog.RemoveFolder(year.ID, true, true, &FolderOptions{UpdateDisk: true}); err != nil {
+		t.Fatalf("Failed to remove folder: %v", err)
+	}
+	folders, _ := catalog.ListFolders(root.ID)
+	if len(folders) != 1 || folders[0].PathFromRoot != "" {
+		t.Errorf("Expected only the top folder to remain, got %d folders", len(folders))
+	}
+	for _, id := range []int64{imageA.ID, imageB.ID} {
+		if _, err := catalog.GetImage(id); err == nil {
+			t.Errorf("Expected image %d to be removed", id)
+		}
+	}
+	if images, _ := catalog.GetCollectionImages(collection.ID); len(images) != 0 {
+		t.Errorf("Expected the collection to be empty, got %d images", len(images))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2024")); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory to be deleted, got %v", err)
+	}
+}
+
+func TestShowParentFolder(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/imports/2024/a.jpg"})
+	root, _ := catalog.GetRootFolderByPath("/photos/imports/2024")
+	catalog.AddFolder(root.ID, "raw")
+
+	parent, err := catalog.ShowParentFolder(root.ID)
+	if err != nil {
+		t.Fatalf("ShowParentFolder failed: %v", err)
+	}
+	if parent.ID != root.ID || parent.AbsolutePath != "/photos/imports/" || parent.Name != "imports" {
+		t.Errorf("Expected the root to be replaced in place, got %+v", parent)
+	}
+	if path, _ := catalog.GetImagePath(image.ID); path != "/photos/imports/2024/a.jpg" {
+		t.Errorf("Expected the image path to be unchanged, got %s", path)
+	}
+	raw, _ := catalog.GetOrCreateFolder(root.ID, "2024/raw")
+	year, _ := catalog.GetOrCreateFolder(root.ID, "2024")
+	if raw.ParentID == nil || *raw.ParentID != year.ID {
+		t.Errorf("Expected 2024/raw/ to be linked to 2024/, got %+v", raw)
+	}
+	tree, _ := catalog.GetFolderTree(root.ID)
+	if tree.Folder == nil || len(tree.Children) != 1 || tree.TotalImageCount != 1 {
+		t.Errorf("Unexpected tree after ShowParentFolder: %+v", tree)
+	}
+
+	// A root at the parent absorbs the shown root
+	other, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/b.jpg"})
+	photos, _ := catalog.GetRootFolderByPath("/photos")
+	merged, err := catalog.ShowParentFolder(root.ID)
+	if err != nil {
+		t.Fatalf("ShowParentFolder failed: %v", err)
+	}
+	if merged.ID != photos.ID {
+		t.Errorf("Expected the existing parent root, got %+v", merged)
+	}
+	if _, err := catalog.GetRootFolder(root.ID); err == nil {
+		t.Error("Expected the merged root to be removed")
+	}
+	for id, want := range map[int64]string{image.ID: "/photos/imports/2024/a.jpg", other.ID: "/photos/b.jpg"} {
+		if path, _ := catalog.GetImagePath(id); path != want {
+			t.Errorf("Expected %s, got %s", want, path)
+		}
+	}
+
+	top, _ := catalog.AddRootFolder("/")
+	if _, err := catalog.ShowParentFolder(top.ID); err == nil {
+		t.Error("Expected a volume root to have no parent")
+	}
+}
+
+func TestPromoteSubfolders(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	root, _ := catalog.AddRootFolder("/photos")
+	a, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/2023/x/a.jpg"})
+	b, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/2024/b.jpg"})
+
+	promoted, err := catalog.PromoteSubfolders(root.ID)
+	if err != nil {
+		t.Fatalf("PromoteSubfolders failed: %v", err)
+	}
+	if len(promoted) != 2 || promoted[0].AbsolutePath != "/photos/2023/" || promoted[1].AbsolutePath != "/photos/2024/" {
+		t.Fatalf("Unexpected promoted roots: %+v", promoted)
+	}
+	if _, err := catalog.GetRootFolder(root.ID); err == nil {
+		t.Error("Expected the emptied root to be removed")
+	}
+
+	file, _ := catalog.GetImageFile(a.ID)
+	folder, _ := catalog.GetFolder(file.FolderID)
+	if folder.RootFolderID != promoted[0].ID || folder.PathFromRoot != "x/" || folder.ParentID == nil {
+		t.Errorf("Unexpected folder after promotion: %+v", folder)
+	}
+	for id, want := range map[int64]string{a.ID: "/photos/2023/x/a.jpg", b.ID: "/photos/2024/b.jpg"} {
+		if path, _ := catalog.GetImagePath(id); path != want {
+			t.Errorf("Expected %s, got %s", want, path)
+		}
+	}
+
+	// Merging reverses the promotion
+	merged, err := catalog.MergeRootFolders(promoted[0].ID, promoted[1].ID)
+	if err != nil {
+		t.Fatalf("MergeRootFolders failed: %v", err)
+	}
+	if merged.AbsolutePath != "/photos/" {
+		t.Errorf("Expected a root at the common parent, got %s", merged.AbsolutePath)
+	}
+	roots, _ := catalog.ListRootFolders()
+	if len(roots) != 1 {
+		t.Errorf("Expected one root folder, got %d", len(roots))
+	}
+	if path, _ := catalog.GetImagePath(a.ID); path != "/photos/2023/x/a.jpg" {
+		t.Errorf("Expected the image path to be unchanged, got %s", path)
+	}
+
+	// A root with files at the top is kept
+	catalog.AddImage(&ImageInput{FilePath: "/photos/c.jpg"})
+	if _, err := catalog.PromoteSubfolders(merged.ID); err != nil {
+		t.Fatalf("PromoteSubfolders failed: %v", err)
+	}
+	if _, err := catalog.GetRootFolder(merged.ID); err != nil {
+		t.Errorf("Expected the root with files to be kept: %v", err)
+	}
+	if _, err := catalog.PromoteSubfolders(merged.ID); err == nil {
+		t.Error("Expected an error for a root without subfolders")
+	}
+}
+
+func TestMergeRootFolders(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	outer, _ := catalog.AddRootFolder("/photos")
+	a, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/2024/a.jpg"})
+	inner, _ := catalog.AddRootFolder("/photos/2024")
+	b, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/2024/b.jpg"})
+
+	merged, err := catalog.MergeRootFolders(inner.ID, outer.ID)
+	if err != nil {
+		t.Fatalf("MergeRootFolders failed: %v", err)
+	}
+	if merged.ID != outer.ID {
+		t.Errorf("Expected the outer root to remain, got %+v", merged)
+	}
+
+	// Both images now share one folder
+	fa, _ := catalog.GetImageFile(a.ID)
+	fb, _ := catalog.GetImageFile(b.ID)
+	if fa.FolderID != fb.FolderID {
+		t.Errorf("Expected 2024/ to be merged, got folders %d and %d", fa.FolderID, fb.FolderID)
+	}
+	folders, _ := catalog.ListFolders(outer.ID)
+	if len(folders) != 2 {
+		t.Errorf("Expected 2 folders, got %d", len(folders))
+	}
+
+	other, _ := catalog.AddRootFolder("D:/Photos")
+	if _, err := catalog.MergeRootFolders(outer.ID, other.ID); err == nil {
+		t.Error("Expected roots on different volumes not to merge")
+	}
+	if _, err := catalog.MergeRootFolders(outer.ID, outer.ID); err == nil {
+		t.Error("Expected merging a root with itself to fail")
+	}
+}
@@ -63,130 +63,63 @@ type ImageInput struct {
 	Height *int
 	// Orientation is the EXIF orientation value
 	Orientation *int
+	// EXIF is pre-extracted EXIF metadata. If nil, it is read from FilePath
+	// when the file exists and harvested into AgHarvestedExifMetadata.
+	EXIF *EXIFData
 }
 
 // AddImage adds a single image to the catalog.
 // The image's folder will be created automatically if it doesn't exist.
 func (c *Catalog) AddImage(input *ImageInput) (*Image, error) {
-	// Normalize the file path
-	absPath := normalizePath(input.FilePath)
-
-	// Split path into directory and filename
-	dir := filepath.Dir(absPath)
-	filename := filepath.Base(absPath)
-	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
-	baseName := strings.TrimSuffix(filename, filepath.Ext(filename))
-
-	// Get or create root folder and folder
-	rootFolder, folder, err := c.ensureFolderPath(dir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to ensure folder path: %w", err)
-	}
-
-	// Determine file format
-	fileFormat := input.FileFormat
-	if fileFormat == "" {
-		fileFormat = detectFileFormat(ext)
-	}
-
-	// Create file record
-	file, err := c.addFile(folder.ID, baseName, ext, filename)
+	tx, err := c.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to add file record: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Create image record
-	image, err := c.addImageRecord(file.ID, input, fileFormat)
+	image, err := c.addImageInTx(tx, input, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to add image record: %w", err)
+		return nil, err
 	}
 
-	// Add additional metadata placeholder
-	if err := c.addAdditionalMetadata(image.ID); err != nil {
-		return nil, fmt.Errorf("failed to add metadata: %w", err)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	_ = rootFolder // Used for folder creation
-
 	return image, nil
 }
 
 // AddImages adds multiple images to the catalog in a single transaction.
 // Returns the import session and the list of added images.
+// Files are referenced where they are; see AddImagesWithOptions for copy and move imports.
 func (c *Catalog) AddImages(inputs []*ImageInput) (*ImportSession, []*Image, error) {
-	if len(inputs) == 0 {
-		return nil, nil, fmt.Errorf("no images to add")
-	}
-
-	tx, err := c.db.Begin()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Create import session
-	importSession, err := c.createImportSession(tx, len(inputs))
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create import session: %w", err)
-	}
-
-	var images []*Image
-	for _, input := range inputs {
-		image, err := c.addImageInTx(tx, input)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to add image %s: %w", input.FilePath, err)
-		}
-
-		// Link image to import
-		if err := c.linkImageToImport(tx, image.ID, importSession.ID); err != nil {
-			return nil, nil, fmt.Errorf("failed to link image to import: %w", err)
-		}
-
-		images = append(images, image)
-	}
-
-	if err := tx.Commit(); err != nil {
-		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	return importSession, images, nil
+	return c.AddImagesWithOptions(inputs, nil)
 }
 
 // ensureFolderPath ensures the folder path exists and returns the root folder and folder
-func (c *Catalog) ensureFolderPath(dirPath string) (*RootFolder, *Folder, error) {
+func (c *Catalog) ensureFolderPath(db dbExecutor, dirPath string) (*RootFolder, *Folder, error) {
 	dirPath = normalizePath(dirPath)
 	if !strings.HasSuffix(dirPath, "/") {
 		dirPath += "/"
 	}
 
-	// Try to find an existing root folder that matches
-	rootFolders, err := c.ListRootFolders()
+	// Use the most specific root folder containing the directory
+	matchingRoot, err := c.matchRootFolder(db, dirPath)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	var matchingRoot *RootFolder
-	var pathFromRoot string
-
-	for _, rf := range rootFolders {
-		if strings.HasPrefix(dirPath, rf.AbsolutePath) {
-			matchingRoot = rf
-			pathFromRoot = strings.TrimPrefix(dirPath, rf.AbsolutePath)
-			break
-		}
-	}
-
-	// If no matching root folder, create one at the directory
+	// If no root folder matches, create one as the policy directs
 	if matchingRoot == nil {
-		matchingRoot, err = c.AddRootFolder(dirPath)
+		matchingRoot, err = c.addRootFolder(db, c.RootFolderPolicy().rootFor(dirPath))
 		if err != nil {
 			return nil, nil, err
 		}
-		pathFromRoot = ""
 	}
+	pathFromRoot := strings.TrimPrefix(dirPath, matchingRoot.AbsolutePath)
 
 	// Get or create the folder
-	folder, err := c.GetOrCreateFolder(matchingRoot.ID, pathFromRoot)
+	folder, err := c.getOrCreateFolder(db, matchingRoot.ID, pathFromRoot)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -194,108 +127,15 @@ func (c *Catalog) ensureFolderPath(dirPath string) (*RootFolder, *Folder, error)
 	return matchingRoot, folder, nil
 }
 
-// addFile creates a file record in AgLibraryFile
-func (c *Catalog) addFile(folderID int64, baseName, extension, originalFilename string) (*ImageFile, error) {
-	uuid := NewUUID()
-	idxFilename := baseName + "." + extension
-	lcIdxFilename := strings.ToLower(idxFilename)
-	lcIdxFilenameExt := strings.ToLower(extension)
-
-	result, err := c.db.Exec(
-		`INSERT INTO AgLibraryFile
-		 (id_global, folder, baseName, extension, originalFilename, idx_filename, lc_idx_filename, lc_idx_filenameExtension)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		uuid, folderID, baseName, extension, originalFilename, idxFilename, lcIdxFilename, lcIdxFilenameExt,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-
-	return &ImageFile{
-		ID:               id,
-		UUID:             uuid,
-		FolderID:         folderID,
-		BaseName:         baseName,
-		Extension:        extension,
-		OriginalFilename: originalFilename,
-	}, nil
-}
-
-// addImageRecord creates an image record in Adobe_images
-func (c *Catalog) addImageRecord(fileID int64, input *ImageInput, fileFormat string) (*Image, error) {
-	uuid := NewUUID()
-	captureTimeStr := FormatCaptureTime(input.CaptureTime)
-
-	var rating interface{}
-	if input.Rating != nil {
-		rating = *input.Rating
-	}
-
-	var width, height, orientation interface{}
-	if input.Width != nil {
-		width = *input.Width
-	}
-	if input.Height != nil {
-		height = *input.Height
-	}
-	if input.Orientation != nil {
-		orientation = *input.Orientation
-	}
-
-	result, err := c.db.Exec(
-		`INSERT INTO Adobe_images
-		 (id_global, rootFile, captureTime, rating, colorLabels, pick, fileFormat, fileWidth, fileHeight, orientation, touchTime)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		uuid, fileID, captureTimeStr, rating, input.ColorLabel, input.Pick, fileFormat, width, height, orientation,
-		ToLightroomTimestamp(time.Now()),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
-
-	return &Image{
-		ID:          id,
-		UUID:        uuid,
-		FileID:      fileID,
-		CaptureTime: input.CaptureTime,
-		Rating:      input.Rating,
-		ColorLabel:  input.ColorLabel,
-		Pick:        input.Pick,
-		FileFormat:  fileFormat,
-		Width:       input.Width,
-		Height:      input.Height,
-		Orientation: input.Orientation,
-	}, nil
-}
-
-// addAdditionalMetadata adds a metadata placeholder for an image
-func (c *Catalog) addAdditionalMetadata(imageID int64) error {
-	uuid := NewUUID()
-	_, err := c.db.Exec(
-		`INSERT INTO Adobe_AdditionalMetadata (id_global, image, xmp) VALUES (?, ?, ?)`,
-		uuid, imageID, "",
-	)
-	return err
-}
-
-// createImportSession creates a new import session
-func (c *Catalog) createImportSession(tx *sql.Tx, imageCount int) (*ImportSession, error) {
+// createImportSession creates a new import session.
+// An empty name is stored as NULL, as Lightroom does for unnamed imports.
+func (c *Catalog) createImportSession(tx *sql.Tx, imageCount int, name string) (*ImportSession, error) {
 	now := time.Now()
 	importDate := FormatCaptureTime(now)
 
 	result, err := tx.Exec(
-		`INSERT INTO AgLibraryImport (importDate, imageCount) VALUES (?, ?)`,
-		importDate, imageCount,
+		`INSERT INTO AgLibraryImport (importDate, imageCount, name) VALUES (?, ?, ?)`,
+		importDate, imageCount, nullIfEmpty(name),
 	)
 	if err != nil {
 		return nil, err
@@ -310,6 +150,7 @@ func (c *Catalog) createImportSession(tx *sql.Tx, imageCount int) (*ImportSessio
 		ID:         id,
 		ImportDate: now,
 		ImageCount: imageCount,
+		Name:       name,
 	}, nil
 }
 
@@ -322,24 +163,50 @@ func (c *Catalog) linkImageToImport(tx *sql.Tx, imageID, importID int64) error {
 	return err
 }
 
-// addImageInTx adds an image within a transaction
-func (c *Catalog) addImageInTx(tx *sql.Tx, input *ImageInput) (*Image, error) {
+// addImageInTx adds an image within a transaction.
+// originalFilename is recorded in AgLibraryFile; if empty, the file name of input.FilePath is used.
+func (c *Catalog) addImageInTx(tx *sql.Tx, input *ImageInput, originalFilename string) (*Image, error) {
 	absPath := normalizePath(input.FilePath)
 	dir := filepath.Dir(absPath)
 	filename := filepath.Base(absPath)
+	if originalFilename == "" {
+		originalFilename = filename
+	}
 	ext := strings.TrimPrefix(filepath.Ext(filename), ".")
 	baseName := strings.TrimSuffix(filename, filepath.Ext(filename))
 
 	// Ensure folder path
-	rootFolder, folder, err := c.ensureFolderPath(dir)
+	_, folder, err := c.ensureFolderPath(tx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure folder path: %w", err)
+	}
+
+	// Harvest EXIF from the file unless the caller supplied it
+	exif := input.EXIF
+	if exif == nil {
+		exif, _ = readEmbeddedMetadata(absPath)
+	}
+
+	width, height, orientation := input.Width, input.Height, input.Orientation
+	if exif != nil {
+		if width == nil && height == nil {
+			width, height = exif.Width, exif.Height
+		}
+		if orientation == nil {
+			orientation = exif.Orientation
+		}
+	}
+
+	fileFormat, isRaw, err := resolveFileFormat(input, ext)
 	if err != nil {
 		return nil, err
 	}
-	_ = rootFolder
 
-	fileFormat := input.FileFormat
-	if fileFormat == "" {
-		fileFormat = detectFileFormat(ext)
+	// Record modification time and size so SyncFolder can detect changes
+	var modTime, importHash interface{}
+	if info, err := os.Stat(absPath); err == nil {
+		fp := newFileFingerprint(info)
+		modTime, importHash = fp.modTime, fp.importHash()
 	}
 
 	// Create file record
@@ -350,9 +217,11 @@ func (c *Catalog) addImageInTx(tx *sql.Tx, input *ImageInput) (*Image, error) {
 
 	fileResult, err := tx.Exec(
 		`INSERT INTO AgLibraryFile
-		 (id_global, folder, baseName, extension, originalFilename, idx_filename, lc_idx_filename, lc_idx_filenameExtension)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		fileUUID, folder.ID, baseName, ext, filename, idxFilename, lcIdxFilename, lcIdxFilenameExt,
+		 (id_global, folder, baseName, extension, originalFilename, idx_filename, lc_idx_filename, lc_idx_filenameExtension,
+		  modTime, externalModTime, importHash)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		fileUUID, folder.ID, baseName, ext, originalFilename, idxFilename, lcIdxFilename, lcIdxFilenameExt,
+		modTime, modTime, importHash,
 	)
 	if err != nil {
 		return nil, err
@@ -372,23 +241,23 @@ func (c *Catalog) addImageInTx(tx *sql.Tx, input *ImageInput) (*Image, error) {
 		rating = *input.Rating
 	}
 
-	var width, height, orientation interface{}
-	if input.Width != nil {
-		width = *input.Width
+	var widthValue, heightValue, orientationValue interface{}
+	if width != nil {
+		widthValue = *width
 	}
-	if input.Height != nil {
-		height = *input.Height
+	if height != nil {
+		heightValue = *height
 	}
-	if input.Orientation != nil {
-		orientation = *input.Orientation
+	if orientation != nil {
+		orientationValue = *orientation
 	}
 
 	imageResult, err := tx.Exec(
 		`INSERT INTO Adobe_images
 		 (id_global, rootFile, captureTime, rating, colorLabels, pick, fileFormat, fileWidth, fileHeight, orientation, touchTime)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		imageUUID, fileID, captureTimeStr, rating, input.ColorLabel, input.Pick, fileFormat, width, height, orientation,
-		ToLightroomTimestamp(time.Now()),
+		imageUUID, fileID, captureTimeStr, rating, input.ColorLabel, input.Pick, fileFormat,
+		widthValue, heightValue, orientationValue, ToLightroomTimestamp(time.Now()),
 	)
 	if err != nil {
 		return nil, err
@@ -402,13 +271,19 @@ func (c *Catalog) addImageInTx(tx *sql.Tx, input *ImageInput) (*Image, error) {
 	// Add additional metadata
 	metaUUID := NewUUID()
 	_, err = tx.Exec(
-		`INSERT INTO Adobe_AdditionalMetadata (id_global, image, xmp) VALUES (?, ?, ?)`,
-		metaUUID, imageID, "",
+		`INSERT INTO Adobe_AdditionalMetadata (id_global, image, isRawFile, xmp) VALUES (?, ?, ?, ?)`,
+		metaUUID, imageID, boolToInt(isRaw), "",
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if exif != nil {
+		if err := c.harvestEXIF(tx, imageID, exif); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Image{
 		ID:          imageID,
 		UUID:        imageUUID,
@@ -419,9 +294,9 @@ func (c *Catalog) addImageInTx(tx *sql.Tx, input *ImageInput) (*Image, error) {
 		ColorLabel:  input.ColorLabel,
 		Pick:        input.Pick,
 		FileFormat:  fileFormat,
-		Width:       input.Width,
-		Height:      input.Height,
-		Orientation: input.Orientation,
+		Width:       width,
+		Height:      height,
+		Orientation: orientation,
 	}, nil
 }
 
@@ -518,27 +393,177 @@ func (c *Catalog) ListImages() ([]*Image, error) {
 	return images, rows.Err()
 }
 
-// detectFileFormat determines the Lightroom file format from extension
-func detectFileFormat(ext string) string {
-	ext = strings.ToUpper(ext)
-	switch ext {
-	case "JPG", "JPEG":
-		return "JPG"
-	case "PNG":
-		return "PNG"
-	case "TIFF", "TIF":
-		return "TIFF"
-	case "PSD":
-		return "PSD"
-	case "DNG":
-		return "DNG"
-	case "CR2", "CR3", "NEF", "ARW", "ORF", "RAF", "RW2", "PEF", "SRW":
-		return "RAW"
-	case "MP4", "MOV", "AVI", "MKV":
-		return "VIDEO"
-	default:
-		return "JPG"
+// GetImageFile returns the AgLibraryFile record for an image
+func (c *Catalog) GetImageFile(imageID int64) (*ImageFile, error) {
+	file, _, err := c.getImageFile(c.db, imageID)
+	return file, err
+}
+
+// GetImagePath returns the absolute path of an image's file
+func (c *Catalog) GetImagePath(imageID int64) (string, error) {
+	file, dir, err := c.getImageFile(c.db, imageID)
+	if err != nil {
+		return "", err
+	}
+	return dir + file.BaseName + "." + file.Extension, nil
+}
+
+// getImageFile returns an image's file record and the absolute path of its folder
+func (c *Catalog) getImageFile(db dbExecutor, imageID int64) (*ImageFile, string, error) {
+	file := &ImageFile{}
+	var rootPath, pathFromRoot string
+	var relativePath sql.NullString
+	err := db.QueryRow(
+		`SELECT f.id_local, f.id_global, f.folder, f.baseName, f.extension, f.originalFilename,
+		        rf.absolutePath, rf.relativePathFromCatalog, fo.pathFromRoot
+		 FROM Adobe_images i
+		 JOIN AgLibraryFile f ON i.rootFile = f.id_local
+		 JOIN AgLibraryFolder fo ON f.folder = fo.id_local
+		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+		 WHERE i.id_local = ?`,
+		imageID,
+	).Scan(&file.ID, &file.UUID, &file.FolderID, &file.BaseName, &file.Extension, &file.OriginalFilename,
+		&rootPath, &relativePath, &pathFromRoot)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", fmt.Errorf("image not found: %d", imageID)
+		}
+		return nil, "", err
+	}
+	return file, c.resolveRootPath(rootPath, relativePath.String) + pathFromRoot, nil
+}
+
+// RemoveImage removes an image and its file record from the catalog,
+// together with its keywords, collection memberships, metadata and develop
+// settings. The file on disk is not touched.
+func (c *Catalog) RemoveImage(imageID int64) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := c.removeImage(tx, imageID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// imageTables lists the tables whose rows belong to a single image via an image column
+var imageTables = []string{
+	"AgLibraryKeywordImage",
+	"AgLibraryCollectionImage",
+	"AgLibraryImportImage",
+	"Adobe_AdditionalMetadata",
+	"AgHarvestedExifMetadata",
+	"AgHarvestedIptcMetadata",
+	"AgLibraryIPTC",
+	"Adobe_imageDevelopSettings",
+	"Adobe_imageProperties",
+	"Adobe_libraryImageDevelopHistoryStep",
+	"Adobe_libraryImageDevelopSnapshot",
+	"AgMetadataSearchIndex",
+	"AgVideoInfo",
+	"AgLibraryImageChangeCounter",
+	"AgLibraryFolderStackImage",
+	"AgSourceColorProfileConstants",
+	"AgLibraryUpdatedImages",
+}
+
+// removeImage deletes an image and everything that references it using the given executor
+func (c *Catalog) removeImage(db dbExecutor, imageID int64) error {
+	var fileID int64
+	err := db.QueryRow(`SELECT rootFile FROM Adobe_images WHERE id_local = ?`, imageID).Scan(&fileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("image not found: %d", imageID)
+		}
+		return err
+	}
+
+	// Collections, keywords and imports keep a cached image count
+	collectionIDs, err := queryIDs(db, `SELECT DISTINCT collection FROM AgLibraryCollectionImage WHERE image = ?`, imageID)
+	if err != nil {
+		return err
+	}
+	keywordIDs, err := queryIDs(db, `SELECT DISTINCT tag FROM AgLibraryKeywordImage WHERE image = ?`, imageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		`UPDATE AgLibraryImport SET imageCount = imageCount - 1
+		 WHERE id_local IN (SELECT import FROM AgLibraryImportImage WHERE image = ?) AND imageCount > 0`,
+		imageID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update import: %w", err)
+	}
+
+	for _, table := range imageTables {
+		if _, err := db.Exec(`DELETE FROM `+table+` WHERE image = ?`, imageID); err != nil {
+			return fmt.Errorf("failed to remove image from %s: %w", table, err)
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM Adobe_images WHERE id_local = ?`, imageID); err != nil {
+		return fmt.Errorf("failed to remove image: %w", err)
+	}
+
+	// Virtual copies share the file record
+	var remaining int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM Adobe_images WHERE rootFile = ?`, fileID).Scan(&remaining); err != nil {
+		return err
+	}
+	if remaining == 0 {
+		if _, err := db.Exec(`DELETE FROM AgLibraryFile WHERE id_local = ?`, fileID); err != nil {
+			return fmt.Errorf("failed to remove file: %w", err)
+		}
+	}
+
+	for _, id := range collectionIDs {
+		if err := c.updateCollectionImageCount(db, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range keywordIDs {
+		if err := updateKeywordImageCount(db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detectFileFormat determines the Lightroom file format from the registered file types
+func detectFileFormat(ext string) (string, error) {
+	ft, ok := LookupFileType(ext)
+	if !ok {
+		return "", fmt.Errorf("%w: .%s", ErrUnknownFileType, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+	return ft.Format, nil
+}
+
+// resolveFileFormat returns the Lightroom file format and raw flag for an
+// input with the given extension. input.FileFormat takes precedence over
+// the format registered for the extension.
+func resolveFileFormat(input *ImageInput, ext string) (string, bool, error) {
+	fileType, known := LookupFileType(ext)
+	if input.FileFormat == "" {
+		if !known {
+			_, err := detectFileFormat(ext)
+			return "", false, err
+		}
+		return fileType.Format, fileType.Raw, nil
+	}
+	if known && fileType.Format == input.FileFormat {
+		return fileType.Format, fileType.Raw, nil
 	}
+	// The caller or content detection overrode the extension's format
+	return input.FileFormat, isRawFormat(input.FileFormat), nil
+}
+
+// isRawFormat reports whether a Lightroom file format is a camera raw format
+func isRawFormat(format string) bool {
+	return format == FileFormatRaw || format == FileFormatDNG
 }
 
 // ImageExists checks if an image file already exists in the catalog
@@ -557,7 +582,7 @@ func (c *Catalog) ImageExists(filePath string) (bool, error) {
 		 JOIN AgLibraryFolder fo ON f.folder = fo.id_local
 		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
 		 WHERE rf.absolutePath || fo.pathFromRoot || f.baseName || '.' || f.extension = ?`,
-		absPath,
+		c.catalogPath(absPath),
 	).Scan(&count)
 	if err != nil {
 		return false, err
@@ -574,48 +599,8 @@ func (c *Catalog) ImageExists(filePath string) (bool, error) {
 	return count > 0, err
 }
 
-// ScanDirectory scans a directory for image files and returns ImageInputs
-func ScanDirectory(dir string, recursive bool) ([]*ImageInput, error) {
-	var inputs []*ImageInput
-
-	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if d.IsDir() {
-			if !recursive && path != dir {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		ext := strings.ToLower(filepath.Ext(path))
-		if isImageExtension(ext) {
-			info, err := d.Info()
-			if err != nil {
-				return nil // Skip files we can't read
-			}
-
-			inputs = append(inputs, &ImageInput{
-				FilePath:    path,
-				CaptureTime: info.ModTime(),
-			})
-		}
-
-		return nil
-	})
-
-	return inputs, err
-}
-
-// isImageExtension checks if the extension is a supported image format
+// isImageExtension checks if the extension (including the dot) has a registered file type
 func isImageExtension(ext string) bool {
-	supportedExts := map[string]bool{
-		".jpg": true, ".jpeg": true, ".png": true, ".tiff": true, ".tif": true,
-		".psd": true, ".dng": true, ".cr2": true, ".cr3": true, ".nef": true,
-		".arw": true, ".orf": true, ".raf": true, ".rw2": true, ".pef": true,
-		".srw": true, ".mp4": true, ".mov": true, ".avi": true,
-	}
-	return supportedExts[ext]
+	_, ok := LookupFileType(ext)
+	return ok && ext != ""
 }
@@ -1,6 +1,7 @@
 package lrcat
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -170,15 +171,24 @@ func TestDetectFileFormat(t *testing.T) {
 		{"mp4", "VIDEO"},
 		{"mov", "VIDEO"},
 		{"psd", "PSD"},
-		{"unknown", "JPG"}, // default
+		{"heic", "HEIC"},
+		{"cr3", "RAW"},
+		{"m4v", "VIDEO"},
 	}
 
 	for _, tc := range tests {
-		result := detectFileFormat(tc.ext)
+		result, err := detectFileFormat(tc.ext)
+		if err != nil {
+			t.Errorf("detectFileFormat(%s): unexpected error: %v", tc.ext, err)
+		}
 		if result != tc.expected {
 			t.Errorf("detectFileFormat(%s): expected %s, got %s", tc.ext, tc.expected, result)
 		}
 	}
+
+	if _, err := detectFileFormat("unknown"); !errors.Is(err, ErrUnknownFileType) {
+		t.Errorf("Expected ErrUnknownFileType for unknown extension, got %v", err)
+	}
 }
 
 func TestImageExists(t *testing.T) {
@@ -271,3 +281,50 @@ func TestAddImageCreatesFolder(t *testing.T) {
 		t.Errorf("Expected 1 root folder, got %d", len(rootFolders))
 	}
 }
+
+func TestRemoveImage(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	session, images, err := catalog.AddImages([]*ImageInput{
+		{FilePath: "/photos/a.jpg"},
+		{FilePath: "/photos/b.jpg"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add images: %v", err)
+	}
+	image := images[0]
+
+	keyword, _ := catalog.AddKeyword("travel", nil)
+	catalog.AddKeywordToImage(image.ID, keyword.ID)
+	collection, _ := catalog.AddCollection("Best", CollectionTypeStandard, nil)
+	catalog.AddImageToCollection(image.ID, collection.ID)
+
+	if err := catalog.RemoveImage(image.ID); err != nil {
+		t.Fatalf("Failed to remove image: %v", err)
+	}
+
+	if _, err := catalog.GetImage(image.ID); err == nil {
+		t.Error("Expected removed image to be gone")
+	}
+	if kws, _ := catalog.GetImageKeywords(image.ID); len(kws) != 0 {
+		t.Error("Expected keyword links to be removed")
+	}
+	coll, _ := catalog.GetCollection(collection.ID)
+	if coll.ImageCount == nil || *coll.ImageCount != 0 {
+		t.Errorf("Expected collection image count 0, got %v", coll.ImageCount)
+	}
+	var importCount, files int
+	catalog.DB().QueryRow(`SELECT imageCount FROM AgLibraryImport WHERE id_local = ?`, session.ID).Scan(&importCount)
+	if importCount != 1 {
+		t.Errorf("Expected import image count 1, got %d", importCount)
+	}
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryFile`).Scan(&files)
+	if files != 1 {
+		t.Errorf("Expected 1 file record, got %d", files)
+	}
+
+	if err := catalog.RemoveImage(image.ID); err == nil {
+		t.Error("Expected error removing a missing image")
+	}
+}
@@ -0,0 +1,602 @@
+package lrcat
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImportMode controls what happens to source files during an import
+type ImportMode int
+
+const (
+	// ImportModeAdd references files where they already are
+	ImportModeAdd ImportMode = iota
+	// ImportModeCopy copies files into the destination root and references the copies
+	ImportModeCopy
+	// ImportModeMove moves files into the destination root
+	ImportModeMove
+)
+
+// CollisionPolicy controls what happens when a destination file already exists
+type CollisionPolicy int
+
+const (
+	// CollisionRename appends "-1", "-2", ... to the file name until it is unique
+	CollisionRename CollisionPolicy = iota
+	// CollisionSkip leaves the existing file alone and does not import the source
+	CollisionSkip
+	// CollisionOverwrite replaces the existing file. A file the catalog
+	// already references is not replaced; the source is skipped instead.
+	CollisionOverwrite
+	// CollisionError aborts the import before any file is transferred
+	CollisionError
+)
+
+// DefaultFolderTemplate is the destination folder layout used when ImportOptions.FolderTemplate is empty
+const DefaultFolderTemplate = "{year}/{year}-{month}-{day}"
+
+// ImportOptions controls how AddImagesWithOptions imports files
+type ImportOptions struct {
+	// Mode selects add (reference in place), copy or move behaviour
+	Mode ImportMode
+	// DestinationRoot is the directory files are copied or moved into.
+	// Required for ImportModeCopy and ImportModeMove.
+	DestinationRoot string
+	// FolderTemplate lays out subfolders below DestinationRoot using capture-date
+	// tokens: {year} {yy} {month} {monthname} {mon} {day} {hour} {minute} {second} {date}.
+	// Defaults to DefaultFolderTemplate.
+	FolderTemplate string
+	// Collision controls what happens when a destination file already exists
+	Collision CollisionPolicy
+	// VerifyChecksum re-reads every copied file and compares its SHA-256 with the source
+	VerifyChecksum bool
+	// BackupDir, if set, receives a second copy of every file, mirroring the
+	// layout below DestinationRoot
+	BackupDir string
+	// Rename, if set, names the transferred files from a template.
+	// Requires ImportModeCopy or ImportModeMove; originalFilename keeps the source name.
+	Rename *RenameOptions
+	// SessionName names the import session (AgLibraryImport.name)
+	SessionName string
+	// Preset, if set, applies keywords, IPTC metadata, rating, color label,
+	// a target collection and develop settings to every imported image
+	// within the import transaction
+	Preset *ImportPreset
+	// DetectContent identifies each file from its magic bytes instead of its
+	// extension, so files with wrong or missing extensions get the right
+	// fileFormat and raw flag. Inputs with FileFormat set are left alone.
+	DetectContent bool
+	// OnWarning, if set, receives non-fatal problems such as a *FormatMismatch
+	// when a file's content disagrees with its extension
+	OnWarning func(err error)
+	// Plan, if set, executes a plan made by PlanImport for the same inputs.
+	// The options given to PlanImport apply and the other fields are ignored.
+	Plan *ImportPlan
+}
+
+// importItem is a single input resolved against ImportOptions
+type importItem struct {
+	input            *ImageInput
+	sourcePath       string
+	destPath         string
+	originalFilename string
+	skip             bool
+	// mismatch is set when DetectContent found content disagreeing with the extension
+	mismatch *FormatMismatch
+	// err records why the item cannot be imported
+	err error
+	// metadata is applied to the image after any preset
+	metadata *itemMetadata
+}
+
+// AddImagesWithOptions imports multiple images in a single transaction using opts.
+// With ImportModeCopy or ImportModeMove the files are transferred into
+// opts.DestinationRoot first and the catalog references the new locations;
+// files whose destination the catalog already references are skipped.
+// If the catalog update fails, transferred files are removed or moved back.
+func (c *Catalog) AddImagesWithOptions(inputs []*ImageInput, opts *ImportOptions) (*ImportSession, []*Image, error) {
+	if len(inputs) == 0 {
+		return nil, nil, fmt.Errorf("no images to add")
+	}
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	var items []*importItem
+	var err error
+	if opts.Plan != nil {
+		if items, err = c.planItems(opts.Plan, inputs); err != nil {
+			return nil, nil, err
+		}
+		opts = &opts.Plan.opts
+	} else {
+		if items, err = resolveImportItems(inputs, opts); err != nil {
+			return nil, nil, err
+		}
+		for _, item := range items {
+			if item.err != nil {
+				return nil, nil, item.err
+			}
+		}
+		if opts.Mode != ImportModeAdd {
+			if err := c.skipCatalogedItems(items); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return c.importItems(items, opts)
+}
+
+// skipCatalogedItems skips items whose destination the catalog already
+// references, as PlanImport does, so that overwriting a cataloged file does
+// not add a second image for it
+func (c *Catalog) skipCatalogedItems(items []*importItem) error {
+	for _, item := range items {
+		if item.skip {
+			continue
+		}
+		cataloged, err := c.fileInCatalog(c.db, item.destPath)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", item.destPath, err)
+		}
+		item.skip = cataloged
+	}
+	return nil
+}
+
+// importItems transfers the files of copy and move imports and then writes the
+// catalog rows, undoing the transfers if the catalog update fails
+func (c *Catalog) importItems(items []*importItem, opts *ImportOptions) (*ImportSession, []*Image, error) {
+	transfers := &transferLog{}
+	if opts.Mode != ImportModeAdd {
+		if err := transfers.transferAll(items, opts); err != nil {
+			transfers.rollback()
+			return nil, nil, err
+		}
+	}
+
+	session, images, err := c.insertImportItems(items, opts)
+	if err != nil {
+		transfers.rollback()
+		return nil, nil, err
+	}
+
+	transfers.commit()
+	return session, images, nil
+}
+
+// insertImportItems writes the catalog rows for all non-skipped items in one transaction
+func (c *Catalog) insertImportItems(items []*importItem, opts *ImportOptions) (*ImportSession, []*Image, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	importSession, images, err := c.insertImportItemsTx(tx, items, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return importSession, images, nil
+}
+
+// insertImportItemsTx creates an import session and adds all non-skipped items within tx
+func (c *Catalog) insertImportItemsTx(tx *sql.Tx, items []*importItem, opts *ImportOptions) (*ImportSession, []*Image, error) {
+	count := 0
+	for _, item := range items {
+		if !item.skip {
+			count++
+		}
+	}
+
+	// Create import session
+	importSession, err := c.createImportSession(tx, count, opts.SessionName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create import session: %w", err)
+	}
+
+	var preset *resolvedPreset
+	if opts.Preset != nil {
+		if preset, err = c.resolveImportPreset(tx, opts.Preset); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var images []*Image
+	for _, item := range items {
+		if item.skip {
+			continue
+		}
+
+		input := *item.input
+		input.FilePath = item.destPath
+		if preset != nil {
+			preset.applyRatingAndLabel(&input)
+		}
+		image, err := c.addImageInTx(tx, &input, item.originalFilename)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to add image %s: %w", item.sourcePath, err)
+		}
+
+		if preset != nil {
+			if err := c.applyImportPreset(tx, image, preset); err != nil {
+				return nil, nil, fmt.Errorf("failed to apply preset to %s: %w", item.sourcePath, err)
+			}
+		}
+		if item.metadata != nil {
+			if err := c.applyItemMetadata(tx, image, item.metadata); err != nil {
+				return nil, nil, fmt.Errorf("failed to apply metadata to %s: %w", item.sourcePath, err)
+			}
+		}
+
+		// Link image to import
+		if err := c.linkImageToImport(tx, image.ID, importSession.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to link image to import: %w", err)
+		}
+
+		images = append(images, image)
+	}
+
+	return importSession, images, nil
+}
+
+// resolveImportItems computes the destination of every input and applies the
+// collision policy. Problems with individual files are recorded in item.err;
+// an error is returned only for invalid options.
+func resolveImportItems(inputs []*ImageInput, opts *ImportOptions) ([]*importItem, error) {
+	if opts.Mode != ImportModeAdd && opts.DestinationRoot == "" {
+		return nil, fmt.Errorf("destination root is required for copy and move imports")
+	}
+
+	folderTemplate := opts.FolderTemplate
+	if folderTemplate == "" {
+		folderTemplate = DefaultFolderTemplate
+	}
+
+	var nameTemplate *FilenameTemplate
+	seq := 1
+	if opts.Rename != nil {
+		if opts.Mode == ImportModeAdd {
+			return nil, fmt.Errorf("renaming on import requires copy or move mode")
+		}
+		var err error
+		if nameTemplate, err = NewFilenameTemplate(opts.Rename); err != nil {
+			return nil, err
+		}
+		if opts.Rename.StartSequence != 0 {
+			seq = opts.Rename.StartSequence
+		}
+	}
+
+	claimed := map[string]bool{}
+	items := make([]*importItem, 0, len(inputs))
+	for _, input := range inputs {
+		item := &importItem{
+			input:            input,
+			sourcePath:       input.FilePath,
+			destPath:         input.FilePath,
+			originalFilename: filepath.Base(normalizePath(input.FilePath)),
+		}
+		items = append(items, item)
+
+		if opts.DetectContent && input.FileFormat == "" {
+			detected, mismatch, err := detectInputType(item)
+			if err != nil {
+				item.err = err
+				continue
+			}
+			item.input, item.mismatch = detected, mismatch
+			if mismatch != nil && opts.OnWarning != nil {
+				opts.OnWarning(mismatch)
+			}
+		}
+
+		if opts.Mode == ImportModeAdd {
+			continue
+		}
+
+		// Read EXIF once from the source; it is needed for naming and harvesting
+		if item.input.EXIF == nil {
+			if exif, err := readEmbeddedMetadata(input.FilePath); err == nil {
+				withEXIF := *item.input
+				withEXIF.EXIF = exif
+				item.input = &withEXIF
+			}
+		}
+
+		captureTime := importCaptureTime(item.input)
+		subdir, err := renderFolderTemplate(folderTemplate, captureTime)
+		if err != nil {
+			return nil, err
+		}
+
+		filename := item.originalFilename
+		if nameTemplate != nil {
+			filename, err = nameTemplate.Render(&FilenameTemplateData{
+				CaptureTime:      captureTime,
+				OriginalFilename: item.originalFilename,
+				Sequence:         seq,
+				CameraModel:      importCameraModel(item.input),
+			})
+			if err != nil {
+				item.err = err
+				continue
+			}
+		}
+		dest := filepath.Join(opts.DestinationRoot, filepath.FromSlash(subdir), filename)
+
+		dest, skip, err := resolveCollision(dest, opts.Collision, claimed)
+		if err != nil {
+			item.err = err
+			continue
+		}
+		item.destPath = dest
+		item.skip = skip
+		if !skip {
+			claimed[dest] = true
+			seq++
+		}
+	}
+	return items, nil
+}
+
+// detectInputType returns a copy of the item's input with FileFormat and EXIF
+// taken from the file's content
+func detectInputType(item *importItem) (*ImageInput, *FormatMismatch, error) {
+	ft, mismatch, err := DetectFileType(item.sourcePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detected := *item.input
+	detected.FileFormat = ft.Format
+	if detected.EXIF == nil {
+		if exif, err := ft.Extractor(item.sourcePath); err == nil {
+			detected.EXIF = exif
+		}
+	}
+	return &detected, mismatch, nil
+}
+
+// importCaptureTime returns the capture time used to lay out destination folders
+func importCaptureTime(input *ImageInput) time.Time {
+	if !input.CaptureTime.IsZero() {
+		return input.CaptureTime
+	}
+	if input.EXIF != nil && !input.EXIF.DateTimeOriginal.IsZero() {
+		return input.EXIF.DateTimeOriginal
+	}
+	if info, err := os.Stat(input.FilePath); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// importCameraModel returns the camera model used by the {camera} filename token
+func importCameraModel(input *ImageInput) string {
+	if input.EXIF == nil {
+		return ""
+	}
+	return input.EXIF.cameraModelName()
+}
+
+// resolveCollision applies policy when dest exists on disk or is already
+// claimed by an earlier file in the same import
+func resolveCollision(dest string, policy CollisionPolicy, claimed map[string]bool) (string, bool, error) {
+	taken := func(path string) bool {
+		if claimed[path] {
+			return true
+		}
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+
+	if !taken(dest) {
+		return dest, false, nil
+	}
+
+	switch policy {
+	case CollisionSkip:
+		return dest, true, nil
+	case CollisionOverwrite:
+		if claimed[dest] {
+			return "", false, fmt.Errorf("two files in this import map to %s", dest)
+		}
+		return dest, false, nil
+	case CollisionError:
+		return "", false, fmt.Errorf("destination file already exists: %s", dest)
+	default:
+		ext := filepath.Ext(dest)
+		base := strings.TrimSuffix(dest, ext)
+		for i := 1; ; i++ {
+			candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+			if !taken(candidate) {
+				return candidate, false, nil
+			}
+		}
+	}
+}
+
+// transferLog records file operations so they can be undone if the catalog update fails
+type transferLog struct {
+	created  []string    // files created by copies, removed on rollback
+	moved    [][2]string // [source, dest] pairs renamed, moved back on rollback
+	replaced [][2]string // [path, aside] pairs of overwritten files, restored on rollback
+	pending  []string    // move sources to delete once the catalog update commits
+}
+
+// transferAll copies or moves every non-skipped item and writes backups
+func (l *transferLog) transferAll(items []*importItem, opts *ImportOptions) error {
+	for _, item := range items {
+		if item.skip {
+			continue
+		}
+		if err := l.transfer(item, opts); err != nil {
+			return fmt.Errorf("failed to transfer %s: %w", item.sourcePath, err)
+		}
+
+		if opts.BackupDir != "" {
+			rel, err := filepath.Rel(opts.DestinationRoot, item.destPath)
+			if err != nil {
+				return err
+			}
+			backup := filepath.Join(opts.BackupDir, rel)
+			if err := l.copyFile(item.destPath, backup, opts.VerifyChecksum); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", item.sourcePath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// transfer copies or moves a single item to its destination
+func (l *transferLog) transfer(item *importItem, opts *ImportOptions) error {
+	if err := os.MkdirAll(filepath.Dir(item.destPath), 0755); err != nil {
+		return err
+	}
+
+	if opts.Mode == ImportModeMove {
+		if _, err := os.Lstat(item.destPath); os.IsNotExist(err) {
+			if err := os.Rename(item.sourcePath, item.destPath); err == nil {
+				l.moved = append(l.moved, [2]string{item.sourcePath, item.destPath})
+				return nil
+			}
+		}
+		// Cross-device or overwrite: copy now, delete the source after commit
+		if err := l.copyFile(item.sourcePath, item.destPath, opts.VerifyChecksum); err != nil {
+			return err
+		}
+		l.pending = append(l.pending, item.sourcePath)
+		return nil
+	}
+
+	return l.copyFile(item.sourcePath, item.destPath, opts.VerifyChecksum)
+}
+
+// copyFile copies src to dst, preserving the modification time and
+// optionally verifying the SHA-256 of the written file
+func (l *transferLog) copyFile(src, dst string, verify bool) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	// An existing file is kept aside until the catalog update commits
+	if _, err := os.Lstat(dst); err == nil {
+		if err := l.moveAside(dst); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	l.created = append(l.created, dst)
+
+	hash := sha256.New()
+	if _, err := io.Copy(out, io.TeeReader(in, hash)); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+
+	if verify {
+		sum, err := fileChecksum(dst)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(sum, hash.Sum(nil)) {
+			return fmt.Errorf("checksum mismatch after copying to %s", dst)
+		}
+	}
+	return nil
+}
+
+// moveAside renames an existing file that is about to be overwritten to an
+// unused name in the same directory
+func (l *transferLog) moveAside(path string) error {
+	for i := 0; ; i++ {
+		aside := fmt.Sprintf("%s.lrcat-replaced-%d", path, i)
+		if _, err := os.Lstat(aside); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Rename(path, aside); err != nil {
+			return err
+		}
+		l.replaced = append(l.replaced, [2]string{path, aside})
+		return nil
+	}
+}
+
+// rollback undoes all recorded file operations
+func (l *transferLog) rollback() {
+	for i := len(l.moved) - 1; i >= 0; i-- {
+		os.Rename(l.moved[i][1], l.moved[i][0])
+	}
+	for _, path := range l.created {
+		os.Remove(path)
+	}
+	for i := len(l.replaced) - 1; i >= 0; i-- {
+		os.Rename(l.replaced[i][1], l.replaced[i][0])
+	}
+	l.moved, l.created, l.replaced, l.pending = nil, nil, nil, nil
+}
+
+// commit finalizes the transfer by removing the sources of copy-based moves
+// and the files that were overwritten
+func (l *transferLog) commit() {
+	for _, path := range l.pending {
+		os.Remove(path)
+	}
+	for _, pair := range l.replaced {
+		os.Remove(pair[1])
+	}
+	l.moved, l.created, l.replaced, l.pending = nil, nil, nil, nil
+}
+
+// fileChecksum returns the SHA-256 digest of the file at path
+func fileChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
@@ -0,0 +1,317 @@
+package lrcat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// imageFilePath returns the absolute path the catalog records for an image
+func imageFilePath(t *testing.T, catalog *Catalog, imageID int64) string {
+	t.Helper()
+	var path string
+	err := catalog.DB().QueryRow(
+		`SELECT rf.absolutePath || fo.pathFromRoot || f.baseName || '.' || f.extension
+		 FROM Adobe_images i
+		 JOIN AgLibraryFile f ON i.rootFile = f.id_local
+		 JOIN AgLibraryFolder fo ON f.folder = fo.id_local
+		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+		 WHERE i.id_local = ?`,
+		imageID,
+	).Scan(&path)
+	if err != nil {
+		t.Fatalf("Failed to resolve image path: %v", err)
+	}
+	return path
+}
+
+func TestImportCopyMode(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	card := t.TempDir()
+	library := t.TempDir()
+	backup := t.TempDir()
+	src := writeTestFile(t, card, "DCIM/IMG_001.jpg", []byte("image data"))
+
+	session, images, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: src, CaptureTime: time.Date(2024, 6, 15, 14, 30, 0, 0, time.UTC)},
+	}, &ImportOptions{
+		Mode:            ImportModeCopy,
+		DestinationRoot: library,
+		VerifyChecksum:  true,
+		BackupDir:       backup,
+	})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if session.ImageCount != 1 || len(images) != 1 {
+		t.Fatalf("Expected 1 imported image, got %d", len(images))
+	}
+
+	dest := filepath.Join(library, "2024", "2024-06-15", "IMG_001.jpg")
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("Expected copied file at %s: %v", dest, err)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Error("Source file should remain after copy")
+	}
+	if _, err := os.Stat(filepath.Join(backup, "2024", "2024-06-15", "IMG_001.jpg")); err != nil {
+		t.Errorf("Expected backup copy: %v", err)
+	}
+
+	if got := imageFilePath(t, catalog, images[0].ID); got != normalizePath(dest) {
+		t.Errorf("Expected catalog path %s, got %s", dest, got)
+	}
+}
+
+func TestImportMoveMode(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	card := t.TempDir()
+	library := t.TempDir()
+	src := writeTestFile(t, card, "IMG_002.jpg", []byte("image data"))
+
+	_, images, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: src, CaptureTime: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}, &ImportOptions{
+		Mode:            ImportModeMove,
+		DestinationRoot: library,
+		FolderTemplate:  "{year}/{month}",
+	})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	dest := filepath.Join(library, "2023", "01", "IMG_002.jpg")
+	if _, err := os.Stat(dest); err != nil {
+		t.Errorf("Expected moved file at %s: %v", dest, err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("Source file should be gone after move")
+	}
+	if got := imageFilePath(t, catalog, images[0].ID); got != normalizePath(dest) {
+		t.Errorf("Expected catalog path %s, got %s", dest, got)
+	}
+}
+
+func TestImportCollisionPolicies(t *testing.T) {
+	captureTime := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		policy   CollisionPolicy
+		imported int
+		wantErr  bool
+		expected string
+	}{
+		{"rename", CollisionRename, 1, false, "IMG_001-1.jpg"},
+		{"skip", CollisionSkip, 0, false, ""},
+		{"overwrite", CollisionOverwrite, 1, false, "IMG_001.jpg"},
+		{"error", CollisionError, 0, true, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			catalog := createTestCatalog(t)
+			defer catalog.Close()
+
+			card := t.TempDir()
+			library := t.TempDir()
+			src := writeTestFile(t, card, "IMG_001.jpg", []byte("new"))
+			writeTestFile(t, library, "2024/2024-06-15/IMG_001.jpg", []byte("existing"))
+
+			session, images, err := catalog.AddImagesWithOptions([]*ImageInput{
+				{FilePath: src, CaptureTime: captureTime},
+			}, &ImportOptions{Mode: ImportModeCopy, DestinationRoot: library, Collision: tc.policy})
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("Expected collision error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to import: %v", err)
+			}
+			if session.ImageCount != tc.imported || len(images) != tc.imported {
+				t.Fatalf("Expected %d imported, got %d", tc.imported, len(images))
+			}
+			if tc.expected != "" {
+				dest := filepath.Join(library, "2024", "2024-06-15", tc.expected)
+				data, err := os.ReadFile(dest)
+				if err != nil || string(data) != "new" {
+					t.Errorf("Expected new file content at %s", dest)
+				}
+			}
+		})
+	}
+}
+
+func TestImportCollisionWithinBatch(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	library := t.TempDir()
+	a := writeTestFile(t, t.TempDir(), "IMG_001.jpg", []byte("a"))
+	b := writeTestFile(t, t.TempDir(), "IMG_001.jpg", []byte("b"))
+	captureTime := time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)
+
+	_, images, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: a, CaptureTime: captureTime},
+		{FilePath: b, CaptureTime: captureTime},
+	}, &ImportOptions{Mode: ImportModeCopy, DestinationRoot: library})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	if len(images) != 2 {
+		t.Fatalf("Expected 2 images, got %d", len(images))
+	}
+	if imageFilePath(t, catalog, images[1].ID) != normalizePath(filepath.Join(library, "2024", "2024-06-15", "IMG_001-1.jpg")) {
+		t.Error("Expected second file to be renamed")
+	}
+
+	var original string
+	catalog.DB().QueryRow(`SELECT originalFilename FROM AgLibraryFile WHERE id_local = ?`, images[1].FileID).Scan(&original)
+	if original != "IMG_001.jpg" {
+		t.Errorf("Expected originalFilename IMG_001.jpg, got %s", original)
+	}
+}
+
+func TestImportRequiresDestination(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	_, _, err := catalog.AddImagesWithOptions([]*ImageInput{{FilePath: "/photos/a.jpg"}}, &ImportOptions{Mode: ImportModeCopy})
+	if err == nil {
+		t.Error("Expected error without destination root")
+	}
+}
+
+func TestImportRollsBackFilesOnFailure(t *testing.T) {
+	catalog := createTestCatalog(t)
+
+	library := t.TempDir()
+	src := writeTestFile(t, t.TempDir(), "IMG_001.jpg", []byte("data"))
+
+	// A closed catalog makes the database step fail after files are copied
+	catalog.Close()
+
+	_, _, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: src, CaptureTime: time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC)},
+	}, &ImportOptions{Mode: ImportModeCopy, DestinationRoot: library})
+	if err == nil {
+		t.Fatal("Expected import to fail")
+	}
+
+	if _, err := os.Stat(filepath.Join(library, "2024", "2024-06-15", "IMG_001.jpg")); !os.IsNotExist(err) {
+		t.Error("Copied file should be removed on failure")
+	}
+}
+
+func TestImportSessionName(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	session, _, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: "/photos/a.jpg"},
+	}, &ImportOptions{SessionName: "Card 1"})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if session.Name != "Card 1" {
+		t.Errorf("Expected session name 'Card 1', got '%s'", session.Name)
+	}
+
+	var name string
+	catalog.DB().QueryRow(`SELECT name FROM AgLibraryImport WHERE id_local = ?`, session.ID).Scan(&name)
+	if name != "Card 1" {
+		t.Errorf("Expected stored name 'Card 1', got '%s'", name)
+	}
+}
+
+func TestImportRestoresOverwrittenFilesOnFailure(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	card := t.TempDir()
+	library := t.TempDir()
+	src := writeTestFile(t, card, "b.jpg", []byte("new"))
+	existing := writeTestFile(t, library, "out/b.jpg", []byte("original"))
+
+	_, _, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: src},
+		{FilePath: filepath.Join(card, "missing.jpg")},
+	}, &ImportOptions{
+		Mode:            ImportModeCopy,
+		DestinationRoot: library,
+		FolderTemplate:  "out",
+		Collision:       CollisionOverwrite,
+	})
+	if err == nil {
+		t.Fatal("Expected import to fail")
+	}
+
+	data, err := os.ReadFile(existing)
+	if err != nil {
+		t.Fatalf("Expected the overwritten file to be restored: %v", err)
+	}
+	if string(data) != "original" {
+		t.Errorf("Expected the original content, got %q", data)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(existing))
+	if len(entries) != 1 {
+		t.Errorf("Expected only b.jpg to remain, got %d files", len(entries))
+	}
+
+	// A successful overwrite leaves no aside copy behind
+	if _, _, err := catalog.AddImagesWithOptions([]*ImageInput{{FilePath: src}}, &ImportOptions{
+		Mode:            ImportModeCopy,
+		DestinationRoot: library,
+		FolderTemplate:  "out",
+		Collision:       CollisionOverwrite,
+	}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "new" {
+		t.Errorf("Expected the file to be overwritten, got %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(existing)); len(entries) != 1 {
+		t.Errorf("Expected no aside copy after commit, got %d files", len(entries))
+	}
+}
+
+func TestImportOverwriteSkipsCatalogedFiles(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	card := t.TempDir()
+	library := t.TempDir()
+	src := writeTestFile(t, card, "a.jpg", []byte("first"))
+	opts := &ImportOptions{
+		Mode:            ImportModeCopy,
+		DestinationRoot: library,
+		FolderTemplate:  "out",
+		Collision:       CollisionOverwrite,
+	}
+	if _, _, err := catalog.AddImagesWithOptions([]*ImageInput{{FilePath: src}}, opts); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	writeTestFile(t, card, "a.jpg", []byte("second"))
+	_, images, err := catalog.AddImagesWithOptions([]*ImageInput{{FilePath: src}}, opts)
+	if err != nil {
+		t.Fatalf("Failed to import again: %v", err)
+	}
+	if len(images) != 0 {
+		t.Errorf("Expected the cataloged file to be skipped, got %d images", len(images))
+	}
+	if count, _ := catalog.ImageCount(); count != 1 {
+		t.Errorf("Expected 1 image, got %d", count)
+	}
+	if data, _ := os.ReadFile(filepath.Join(library, "out", "a.jpg")); string(data) != "first" {
+		t.Errorf("Expected the cataloged file to be left alone, got %q", data)
+	}
+}
@@ -0,0 +1,144 @@
+package lrcat
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// IPTCMetadata contains the IPTC fields Lightroom stores for an image
+type IPTCMetadata struct {
+	Caption        string `json:"caption,omitempty" yaml:"caption,omitempty"`
+	Copyright      string `json:"copyright,omitempty" yaml:"copyright,omitempty"`
+	Creator        string `json:"creator,omitempty" yaml:"creator,omitempty"`
+	JobIdentifier  string `json:"jobIdentifier,omitempty" yaml:"jobIdentifier,omitempty"`
+	Location       string `json:"location,omitempty" yaml:"location,omitempty"`
+	City           string `json:"city,omitempty" yaml:"city,omitempty"`
+	State          string `json:"state,omitempty" yaml:"state,omitempty"`
+	Country        string `json:"country,omitempty" yaml:"country,omitempty"`
+	ISOCountryCode string `json:"isoCountryCode,omitempty" yaml:"isoCountryCode,omitempty"`
+}
+
+// IsEmpty reports whether no IPTC field is set
+func (m *IPTCMetadata) IsEmpty() bool {
+	return m == nil || *m == IPTCMetadata{}
+}
+
+// SetIPTC replaces the IPTC metadata for an image
+func (c *Catalog) SetIPTC(imageID int64, iptc *IPTCMetadata) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := c.setIPTC(tx, imageID, iptc); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setIPTC replaces the IPTC metadata for an image using the given executor
+func (c *Catalog) setIPTC(db dbExecutor, imageID int64, iptc *IPTCMetadata) error {
+	if iptc == nil {
+		iptc = &IPTCMetadata{}
+	}
+
+	if _, err := db.Exec(`DELETE FROM AgLibraryIPTC WHERE image = ?`, imageID); err != nil {
+		return fmt.Errorf("failed to clear IPTC: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM AgHarvestedIptcMetadata WHERE image = ?`, imageID); err != nil {
+		return fmt.Errorf("failed to clear IPTC: %w", err)
+	}
+	if iptc.IsEmpty() {
+		return nil
+	}
+
+	_, err := db.Exec(
+		`INSERT INTO AgLibraryIPTC (image, caption, copyright) VALUES (?, ?, ?)`,
+		imageID, nullIfEmpty(iptc.Caption), nullIfEmpty(iptc.Copyright),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set IPTC: %w", err)
+	}
+
+	refs := []struct {
+		table string
+		value string
+		ref   interface{}
+	}{
+		{"AgInternedIptcCreator", iptc.Creator, nil},
+		{"AgInternedIptcJobIdentifier", iptc.JobIdentifier, nil},
+		{"AgInternedIptcLocation", iptc.Location, nil},
+		{"AgInternedIptcCity", iptc.City, nil},
+		{"AgInternedIptcState", iptc.State, nil},
+		{"AgInternedIptcCountry", iptc.Country, nil},
+		{"AgInternedIptcIsoCountryCode", iptc.ISOCountryCode, nil},
+	}
+	for i := range refs {
+		if refs[i].ref, err = internValue(db, refs[i].table, refs[i].value); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(
+		`INSERT INTO AgHarvestedIptcMetadata
+		 (image, creatorRef, jobIdentifierRef, locationRef, cityRef, stateRef, countryRef, isoCountryCodeRef)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		imageID, refs[0].ref, refs[1].ref, refs[2].ref, refs[3].ref, refs[4].ref, refs[5].ref, refs[6].ref,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set IPTC: %w", err)
+	}
+	return nil
+}
+
+// GetIPTC returns the IPTC metadata for an image.
+// Fields that are not set are returned as empty strings.
+func (c *Catalog) GetIPTC(imageID int64) (*IPTCMetadata, error) {
+	var caption, copyright sql.NullString
+	err := c.db.QueryRow(
+		`SELECT caption, copyright FROM AgLibraryIPTC WHERE image = ?`,
+		imageID,
+	).Scan(&caption, &copyright)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get IPTC: %w", err)
+	}
+
+	var creator, job, location, city, state, country, isoCode sql.NullString
+	err = c.db.QueryRow(
+		`SELECT cr.value, j.value, l.value, ci.value, s.value, co.value, iso.value
+		 FROM AgHarvestedIptcMetadata h
+		 LEFT JOIN AgInternedIptcCreator cr ON h.creatorRef = cr.id_local
+		 LEFT JOIN AgInternedIptcJobIdentifier j ON h.jobIdentifierRef = j.id_local
+		 LEFT JOIN AgInternedIptcLocation l ON h.locationRef = l.id_local
+		 LEFT JOIN AgInternedIptcCity ci ON h.cityRef = ci.id_local
+		 LEFT JOIN AgInternedIptcState s ON h.stateRef = s.id_local
+		 LEFT JOIN AgInternedIptcCountry co ON h.countryRef = co.id_local
+		 LEFT JOIN AgInternedIptcIsoCountryCode iso ON h.isoCountryCodeRef = iso.id_local
+		 WHERE h.image = ?`,
+		imageID,
+	).Scan(&creator, &job, &location, &city, &state, &country, &isoCode)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get IPTC: %w", err)
+	}
+
+	return &IPTCMetadata{
+		Caption:        caption.String,
+		Copyright:      copyright.String,
+		Creator:        creator.String,
+		JobIdentifier:  job.String,
+		Location:       location.String,
+		City:           city.String,
+		State:          state.String,
+		Country:        country.String,
+		ISOCountryCode: isoCode.String,
+	}, nil
+}
+
+// nullIfEmpty returns nil for empty strings so the column is stored as NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
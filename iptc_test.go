@@ -0,0 +1,87 @@
+package lrcat
+
+import "testing"
+
+func TestSetAndGetIPTC(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, err := catalog.AddImage(&ImageInput{FilePath: "/photos/test.jpg"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+
+	iptc := &IPTCMetadata{
+		Caption:        "Eiffel Tower at dusk",
+		Copyright:      "© 2024 Jane Doe",
+		Creator:        "Jane Doe",
+		JobIdentifier:  "JOB-42",
+		Location:       "Champ de Mars",
+		City:           "Paris",
+		State:          "Île-de-France",
+		Country:        "France",
+		ISOCountryCode: "FR",
+	}
+	if err := catalog.SetIPTC(image.ID, iptc); err != nil {
+		t.Fatalf("Failed to set IPTC: %v", err)
+	}
+
+	got, err := catalog.GetIPTC(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get IPTC: %v", err)
+	}
+	if *got != *iptc {
+		t.Errorf("Expected %+v, got %+v", iptc, got)
+	}
+
+	// Replacing clears fields that are no longer set
+	if err := catalog.SetIPTC(image.ID, &IPTCMetadata{City: "Lyon"}); err != nil {
+		t.Fatalf("Failed to replace IPTC: %v", err)
+	}
+	got, err = catalog.GetIPTC(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get IPTC: %v", err)
+	}
+	if *got != (IPTCMetadata{City: "Lyon"}) {
+		t.Errorf("Expected only City to be set, got %+v", got)
+	}
+}
+
+func TestIPTCInterning(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	for _, path := range []string{"/photos/a.jpg", "/photos/b.jpg"} {
+		image, err := catalog.AddImage(&ImageInput{FilePath: path})
+		if err != nil {
+			t.Fatalf("Failed to add image: %v", err)
+		}
+		if err := catalog.SetIPTC(image.ID, &IPTCMetadata{City: "Paris"}); err != nil {
+			t.Fatalf("Failed to set IPTC: %v", err)
+		}
+	}
+
+	var count int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgInternedIptcCity`).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 interned city, got %d", count)
+	}
+}
+
+func TestGetIPTCEmpty(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, err := catalog.AddImage(&ImageInput{FilePath: "/photos/test.jpg"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+
+	got, err := catalog.GetIPTC(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get IPTC: %v", err)
+	}
+	if !got.IsEmpty() {
+		t.Errorf("Expected empty IPTC, got %+v", got)
+	}
+}
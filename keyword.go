@@ -3,23 +3,90 @@ package lrcat
 import (
 	"database/sql"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
 
+// KeywordType is the kind of a keyword (AgLibraryKeyword.keywordType)
+type KeywordType string
+
+const (
+	// KeywordTypeStandard is an ordinary keyword
+	KeywordTypeStandard KeywordType = ""
+	// KeywordTypePerson is a person keyword, as created by Lightroom's People view
+	KeywordTypePerson KeywordType = "person"
+)
+
 // Keyword represents a keyword in the Lightroom catalog
 type Keyword struct {
-	ID             int64
-	UUID           string
-	Name           string
-	LCName         string
-	ParentID       *int64
-	Genealogy      string
+	ID        int64
+	UUID      string
+	Name      string
+	LCName    string
+	ParentID  *int64
+	Genealogy string
+	Type      KeywordType
+	// IncludeOnExport, IncludeParents and IncludeSynonyms are Lightroom's
+	// "Include on Export", "Export Containing Keywords" and "Export Synonyms"
 	IncludeOnExport bool
+	IncludeParents  bool
+	IncludeSynonyms bool
+	// LastApplied is when the keyword was last added to an image, or the zero
+	// time if it never was
+	LastApplied time.Time
+}
+
+// keywordColumns are the AgLibraryKeyword columns read by scanKeyword,
+// qualified with the alias k
+const keywordColumns = `k.id_local, k.id_global, k.name, k.lc_name, k.parent, k.genealogy,
+	k.keywordType, k.includeOnExport, k.includeParents, k.includeSynonyms, k.lastApplied`
+
+// scanKeyword reads an AgLibraryKeyword row selected with keywordColumns
+func scanKeyword(row interface{ Scan(...interface{}) error }) (*Keyword, error) {
+	kw := &Keyword{}
+	var parentID sql.NullInt64
+	var keywordType sql.NullString
+	var includeOnExport, includeParents, includeSynonyms int
+	var lastApplied sql.NullFloat64
+	if err := row.Scan(&kw.ID, &kw.UUID, &kw.Name, &kw.LCName, &parentID, &kw.Genealogy,
+		&keywordType, &includeOnExport, &includeParents, &includeSynonyms, &lastApplied); err != nil {
+		return nil, err
+	}
+	if lastApplied.Valid {
+		kw.LastApplied = FromLightroomTimestamp(lastApplied.Float64)
+	}
+	if parentID.Valid {
+		kw.ParentID = &parentID.Int64
+	}
+	kw.Type = KeywordType(keywordType.String)
+	kw.IncludeOnExport = includeOnExport == 1
+	kw.IncludeParents = includeParents == 1
+	kw.IncludeSynonyms = includeSynonyms == 1
+	return kw, nil
+}
+
+// scanKeywords reads all rows selected with keywordColumns
+func scanKeywords(rows *sql.Rows) ([]*Keyword, error) {
+	defer rows.Close()
+	var keywords []*Keyword
+	for rows.Next() {
+		kw, err := scanKeyword(rows)
+		if err != nil {
+			return nil, err
+		}
+		keywords = append(keywords, kw)
+	}
+	return keywords, rows.Err()
 }
 
 // AddKeyword adds a new keyword to the catalog
 func (c *Catalog) AddKeyword(name string, parentID *int64) (*Keyword, error) {
+	return c.addKeyword(c.db, name, parentID)
+}
+
+// addKeyword inserts a keyword using the given executor
+func (c *Catalog) addKeyword(db dbExecutor, name string, parentID *int64) (*Keyword, error) {
 	uuid := NewUUID()
 	lcName := strings.ToLower(name)
 	dateCreated := FormatCaptureTime(time.Now())
@@ -27,14 +94,14 @@ func (c *Catalog) AddKeyword(name string, parentID *int64) (*Keyword, error) {
 	// Build genealogy
 	genealogy := ""
 	if parentID != nil {
-		parent, err := c.GetKeyword(*parentID)
+		parent, err := c.getKeyword(db, *parentID)
 		if err != nil {
 			return nil, fmt.Errorf("parent keyword not found: %w", err)
 		}
 		genealogy = parent.Genealogy
 	}
 
-	result, err := c.db.Exec(
+	result, err := db.Exec(
 		`INSERT INTO AgLibraryKeyword (id_global, name, lc_name, parent, genealogy, dateCreated, includeOnExport, includeParents, includeSynonyms)
 		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		uuid, name, lcName, parentID, genealogy, dateCreated, 1, 1, 1,
@@ -49,156 +116,219 @@ func (c *Catalog) AddKeyword(name string, parentID *int64) (*Keyword, error) {
 	}
 
 	// Update genealogy to include the new ID
-	newGenealogy := genealogy
-	if newGenealogy != "" {
-		newGenealogy += "/"
-	}
-	newGenealogy += fmt.Sprintf("%d", id)
+	newGenealogy := keywordGenealogy(genealogy, id)
 
-	_, err = c.db.Exec(`UPDATE AgLibraryKeyword SET genealogy = ? WHERE id_local = ?`, newGenealogy, id)
+	_, err = db.Exec(`UPDATE AgLibraryKeyword SET genealogy = ? WHERE id_local = ?`, newGenealogy, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update genealogy: %w", err)
 	}
 
 	return &Keyword{
-		ID:             id,
-		UUID:           uuid,
-		Name:           name,
-		LCName:         lcName,
-		ParentID:       parentID,
-		Genealogy:      newGenealogy,
+		ID:              id,
+		UUID:            uuid,
+		Name:            name,
+		LCName:          lcName,
+		ParentID:        parentID,
+		Genealogy:       newGenealogy,
 		IncludeOnExport: true,
+		IncludeParents:  true,
+		IncludeSynonyms: true,
 	}, nil
 }
 
 // GetKeyword retrieves a keyword by its ID
 func (c *Catalog) GetKeyword(id int64) (*Keyword, error) {
-	kw := &Keyword{}
-	var parentID sql.NullInt64
-	var includeOnExport int
+	return c.getKeyword(c.db, id)
+}
 
-	err := c.db.QueryRow(
-		`SELECT id_local, id_global, name, lc_name, parent, genealogy, includeOnExport
-		 FROM AgLibraryKeyword WHERE id_local = ?`,
+// getKeyword retrieves a keyword by its ID using the given executor
+func (c *Catalog) getKeyword(db dbExecutor, id int64) (*Keyword, error) {
+	kw, err := scanKeyword(db.QueryRow(
+		`SELECT `+keywordColumns+` FROM AgLibraryKeyword k WHERE k.id_local = ?`,
 		id,
-	).Scan(&kw.ID, &kw.UUID, &kw.Name, &kw.LCName, &parentID, &kw.Genealogy, &includeOnExport)
+	))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("keyword not found: %d", id)
 		}
 		return nil, err
 	}
-
-	if parentID.Valid {
-		kw.ParentID = &parentID.Int64
-	}
-	kw.IncludeOnExport = includeOnExport == 1
-
 	return kw, nil
 }
 
-// GetKeywordByName retrieves a keyword by its name (case-insensitive)
+// GetKeywordByName retrieves a keyword by its name (case-insensitive). The
+// name is matched at any level of the hierarchy; when several keywords share
+// it, use GetKeywordByPath, GetKeywordByNameUnder or FindKeywords instead.
 func (c *Catalog) GetKeywordByName(name string) (*Keyword, error) {
-	lcName := strings.ToLower(name)
-	kw := &Keyword{}
-	var parentID sql.NullInt64
-	var includeOnExport int
+	return c.getKeywordByName(c.db, name)
+}
 
-	err := c.db.QueryRow(
-		`SELECT id_local, id_global, name, lc_name, parent, genealogy, includeOnExport
-		 FROM AgLibraryKeyword WHERE lc_name = ?`,
-		lcName,
-	).Scan(&kw.ID, &kw.UUID, &kw.Name, &kw.LCName, &parentID, &kw.Genealogy, &includeOnExport)
+// getKeywordByName retrieves a keyword by its name using the given executor
+func (c *Catalog) getKeywordByName(db dbExecutor, name string) (*Keyword, error) {
+	kw, err := scanKeyword(db.QueryRow(
+		`SELECT `+keywordColumns+` FROM AgLibraryKeyword k WHERE k.lc_name = ?`,
+		strings.ToLower(name),
+	))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	return kw, nil
+}
 
-	if parentID.Valid {
-		kw.ParentID = &parentID.Int64
+// GetKeywordByNameUnder retrieves the keyword named name (case-insensitive)
+// directly below parentID, or at the top level if parentID is nil. It
+// returns nil if there is none.
+func (c *Catalog) GetKeywordByNameUnder(name string, parentID *int64) (*Keyword, error) {
+	return c.getKeywordUnder(c.db, name, parentID)
+}
+
+// getKeywordUnder looks up a keyword below a parent using the given executor
+func (c *Catalog) getKeywordUnder(db dbExecutor, name string, parentID *int64) (*Keyword, error) {
+	query := `SELECT ` + keywordColumns + ` FROM AgLibraryKeyword k WHERE k.lc_name = ? AND k.parent IS NULL`
+	args := []interface{}{strings.ToLower(name)}
+	if parentID != nil {
+		query = `SELECT ` + keywordColumns + ` FROM AgLibraryKeyword k WHERE k.lc_name = ? AND k.parent = ?`
+		args = append(args, *parentID)
 	}
-	kw.IncludeOnExport = includeOnExport == 1
 
+	kw, err := scanKeyword(db.QueryRow(query+` ORDER BY k.id_local LIMIT 1`, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
 	return kw, nil
 }
 
-// GetOrCreateKeyword gets an existing keyword or creates it if it doesn't exist
+// GetOrCreateKeyword gets the keyword named name below parentID, or creates
+// it if it doesn't exist. A keyword with the same name elsewhere in the
+// hierarchy is not reused.
 func (c *Catalog) GetOrCreateKeyword(name string, parentID *int64) (*Keyword, error) {
-	kw, err := c.GetKeywordByName(name)
+	return c.getOrCreateKeyword(c.db, name, parentID)
+}
+
+// getOrCreateKeyword gets or creates a keyword using the given executor
+func (c *Catalog) getOrCreateKeyword(db dbExecutor, name string, parentID *int64) (*Keyword, error) {
+	kw, err := c.getKeywordUnder(db, name, parentID)
 	if err != nil {
 		return nil, err
 	}
 	if kw != nil {
 		return kw, nil
 	}
-	return c.AddKeyword(name, parentID)
+	return c.addKeyword(db, name, parentID)
 }
 
 // ListKeywords returns all keywords in the catalog
 func (c *Catalog) ListKeywords() ([]*Keyword, error) {
-	rows, err := c.db.Query(
-		`SELECT id_local, id_global, name, lc_name, parent, genealogy, includeOnExport
-		 FROM AgLibraryKeyword ORDER BY name`,
-	)
+	rows, err := c.db.Query(`SELECT ` + keywordColumns + ` FROM AgLibraryKeyword k ORDER BY k.name`)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var keywords []*Keyword
-	for rows.Next() {
-		kw := &Keyword{}
-		var parentID sql.NullInt64
-		var includeOnExport int
-
-		if err := rows.Scan(&kw.ID, &kw.UUID, &kw.Name, &kw.LCName, &parentID, &kw.Genealogy, &includeOnExport); err != nil {
-			return nil, err
-		}
+	return scanKeywords(rows)
+}
 
-		if parentID.Valid {
-			kw.ParentID = &parentID.Int64
-		}
-		kw.IncludeOnExport = includeOnExport == 1
+// AddKeywordToImage associates a keyword with an image
+func (c *Catalog) AddKeywordToImage(imageID, keywordID int64) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-		keywords = append(keywords, kw)
+	if err := c.addKeywordToImage(tx, imageID, keywordID); err != nil {
+		return err
 	}
-	return keywords, rows.Err()
+	return tx.Commit()
 }
 
-// AddKeywordToImage associates a keyword with an image
-func (c *Catalog) AddKeywordToImage(imageID, keywordID int64) error {
-	_, err := c.db.Exec(
-		`INSERT OR IGNORE INTO AgLibraryKeywordImage (image, tag) VALUES (?, ?)`,
-		imageID, keywordID,
+// addKeywordToImage associates a keyword with an image using the given
+// executor. Adding a keyword the image already has only updates lastApplied.
+func (c *Catalog) addKeywordToImage(db dbExecutor, imageID, keywordID int64) error {
+	result, err := db.Exec(
+		`INSERT INTO AgLibraryKeywordImage (image, tag)
+		 SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM AgLibraryKeywordImage WHERE image = ? AND tag = ?)`,
+		imageID, keywordID, imageID, keywordID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to add keyword to image: %w", err)
 	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := c.refreshKeywordXMP(db, []int64{imageID}); err != nil {
+			return err
+		}
+	}
 
 	// Update keyword last applied time
-	_, err = c.db.Exec(
+	_, err = db.Exec(
 		`UPDATE AgLibraryKeyword SET lastApplied = ? WHERE id_local = ?`,
 		ToLightroomTimestamp(time.Now()), keywordID,
 	)
-
-	return err
+	if err != nil {
+		return err
+	}
+	return updateKeywordImageCount(db, keywordID)
 }
 
 // RemoveKeywordFromImage removes a keyword association from an image
 func (c *Catalog) RemoveKeywordFromImage(imageID, keywordID int64) error {
-	_, err := c.db.Exec(
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
 		`DELETE FROM AgLibraryKeywordImage WHERE image = ? AND tag = ?`,
 		imageID, keywordID,
 	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := c.refreshKeywordXMP(tx, []int64{imageID}); err != nil {
+			return err
+		}
+	}
+	if err := updateKeywordImageCount(tx, keywordID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateKeywordImageCount recalculates the cached image count of a keyword
+func updateKeywordImageCount(db dbExecutor, keywordID int64) error {
+	_, err := db.Exec(
+		`UPDATE AgLibraryKeyword SET imageCountCache = (
+			SELECT COUNT(DISTINCT image) FROM AgLibraryKeywordImage WHERE tag = ?
+		) WHERE id_local = ?`,
+		keywordID, keywordID,
+	)
 	return err
 }
 
+// RefreshKeywordImageCounts recalculates the cached image count of every
+// keyword, e.g. for catalogs written before the counts were maintained
+func (c *Catalog) RefreshKeywordImageCounts() error {
+	_, err := c.db.Exec(
+		`UPDATE AgLibraryKeyword SET imageCountCache = (
+			SELECT COUNT(DISTINCT image) FROM AgLibraryKeywordImage WHERE tag = AgLibraryKeyword.id_local
+		)`,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to refresh keyword image counts: %w", err)
+	}
+	return nil
+}
+
 // GetImageKeywords returns all keywords associated with an image
 func (c *Catalog) GetImageKeywords(imageID int64) ([]*Keyword, error) {
 	rows, err := c.db.Query(
-		`SELECT k.id_local, k.id_global, k.name, k.lc_name, k.parent, k.genealogy, k.includeOnExport
+		`SELECT `+keywordColumns+`
 		 FROM AgLibraryKeyword k
 		 JOIN AgLibraryKeywordImage ki ON k.id_local = ki.tag
 		 WHERE ki.image = ?
@@ -208,26 +338,7 @@ func (c *Catalog) GetImageKeywords(imageID int64) ([]*Keyword, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var keywords []*Keyword
-	for rows.Next() {
-		kw := &Keyword{}
-		var parentID sql.NullInt64
-		var includeOnExport int
-
-		if err := rows.Scan(&kw.ID, &kw.UUID, &kw.Name, &kw.LCName, &parentID, &kw.Genealogy, &includeOnExport); err != nil {
-			return nil, err
-		}
-
-		if parentID.Valid {
-			kw.ParentID = &parentID.Int64
-		}
-		kw.IncludeOnExport = includeOnExport == 1
-
-		keywords = append(keywords, kw)
-	}
-	return keywords, rows.Err()
+	return scanKeywords(rows)
 }
 
 // GetKeywordImages returns all images associated with a keyword
@@ -283,29 +394,1054 @@ func (c *Catalog) GetKeywordImages(keywordID int64) ([]*Image, error) {
 	return images, rows.Err()
 }
 
-// CreateHierarchicalKeywords creates a hierarchy of keywords from a path like "People/Family/John"
+// CreateHierarchicalKeywords creates a hierarchy of keywords from a path like
+// "People/Family/John". Each level is looked up below the previous one, so
+// existing keywords on the path are reused and same-named keywords in other
+// branches are not.
 func (c *Catalog) CreateHierarchicalKeywords(path string) (*Keyword, error) {
-	parts := strings.Split(path, "/")
-	if len(parts) == 0 {
-		return nil, fmt.Errorf("empty keyword path")
-	}
+	return c.createHierarchicalKeywords(c.db, path)
+}
 
+// createHierarchicalKeywords creates a keyword hierarchy using the given executor
+func (c *Catalog) createHierarchicalKeywords(db dbExecutor, path string) (*Keyword, error) {
 	var parentID *int64
 	var lastKeyword *Keyword
 
-	for _, name := range parts {
+	for _, name := range strings.Split(path, "/") {
 		name = strings.TrimSpace(name)
 		if name == "" {
 			continue
 		}
 
-		kw, err := c.GetOrCreateKeyword(name, parentID)
+		kw, err := c.getOrCreateKeyword(db, name, parentID)
 		if err != nil {
 			return nil, err
 		}
 		parentID = &kw.ID
 		lastKeyword = kw
 	}
+	if lastKeyword == nil {
+		return nil, fmt.Errorf("empty keyword path: %q", path)
+	}
 
 	return lastKeyword, nil
 }
+
+// KeywordMatch is a keyword found by FindKeywords
+type KeywordMatch struct {
+	Keyword *Keyword
+	// Path is the keyword's full path, e.g. "Places/France/Paris"
+	Path string
+}
+
+// GetKeywordByPath retrieves a keyword by its full path such as
+// "Places/France/Paris", matching each level case-insensitively. It returns
+// nil if the path does not exist.
+func (c *Catalog) GetKeywordByPath(path string) (*Keyword, error) {
+	return c.getKeywordByPath(c.db, path)
+}
+
+// getKeywordByPath looks up a keyword path using the given executor
+func (c *Catalog) getKeywordByPath(db dbExecutor, path string) (*Keyword, error) {
+	var kw *Keyword
+	var parentID *int64
+	for _, name := range strings.Split(path, "/") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		next, err := c.getKeywordUnder(db, name, parentID)
+		if err != nil || next == nil {
+			return nil, err
+		}
+		kw, parentID = next, &next.ID
+	}
+	if kw == nil {
+		return nil, fmt.Errorf("empty keyword path")
+	}
+	return kw, nil
+}
+
+// FindKeywords returns every keyword named name (case-insensitive) with its
+// full path, sorted by path
+func (c *Catalog) FindKeywords(name string) ([]*KeywordMatch, error) {
+	rows, err := c.db.Query(
+		`SELECT `+keywordColumns+` FROM AgLibraryKeyword k WHERE k.lc_name = ?`,
+		strings.ToLower(strings.TrimSpace(name)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	keywords, err := scanKeywords(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]*KeywordMatch, 0, len(keywords))
+	for _, kw := range keywords {
+		path, err := c.keywordPath(c.db, kw)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, &KeywordMatch{Keyword: kw, Path: path})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return strings.ToLower(matches[i].Path) < strings.ToLower(matches[j].Path)
+	})
+	return matches, nil
+}
+
+// KeywordNode is a keyword in the tree returned by KeywordTree
+type KeywordNode struct {
+	Keyword *Keyword
+	// Path is the keyword's full path, e.g. "Places/France/Paris"
+	Path     string
+	Synonyms []string
+	// ImageCount is the number of images tagged with the keyword itself
+	ImageCount int
+	// TotalImageCount is the number of distinct images tagged with the
+	// keyword or any keyword below it
+	TotalImageCount int
+	Children        []*KeywordNode
+}
+
+// KeywordTree returns all keywords as a tree, with synonyms and image
+// counts. Siblings are sorted by name; the top-level keywords are returned.
+func (c *Catalog) KeywordTree() ([]*KeywordNode, error) {
+	keywords, err := c.ListKeywords()
+	if err != nil {
+		return nil, err
+	}
+	synonyms, err := c.allKeywordSynonyms()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(`SELECT DISTINCT tag, image FROM AgLibraryKeywordImage`)
+	if err != nil {
+		return nil, err
+	}
+	images := map[int64][]int64{}
+	for rows.Next() {
+		var tag, image int64
+		if err := rows.Scan(&tag, &image); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		images[tag] = append(images[tag], image)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int64]*KeywordNode, len(keywords))
+	for _, kw := range keywords {
+		nodes[kw.ID] = &KeywordNode{Keyword: kw, Synonyms: synonyms[kw.ID], ImageCount: len(images[kw.ID])}
+	}
+
+	// Keywords whose parent is missing are shown at the top level
+	var top []*KeywordNode
+	for _, kw := range keywords {
+		node := nodes[kw.ID]
+		if kw.ParentID != nil {
+			if parent, ok := nodes[*kw.ParentID]; ok && parent != node {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		top = append(top, node)
+	}
+
+	var finish func(nodes []*KeywordNode, parentPath string) map[int64]bool
+	finish = func(nodes []*KeywordNode, parentPath string) map[int64]bool {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].Keyword.LCName < nodes[j].Keyword.LCName })
+		all := map[int64]bool{}
+		for _, node := range nodes {
+			node.Path = node.Keyword.Name
+			if parentPath != "" {
+				node.Path = parentPath + "/" + node.Keyword.Name
+			}
+			tagged := finish(node.Children, node.Path)
+			for _, id := range images[node.Keyword.ID] {
+				tagged[id] = true
+			}
+			node.TotalImageCount = len(tagged)
+			for id := range tagged {
+				all[id] = true
+			}
+		}
+		return all
+	}
+	finish(top, "")
+	return top, nil
+}
+
+// GetKeywordPath returns the full path of a keyword, e.g. "Places/France/Paris"
+func (c *Catalog) GetKeywordPath(keywordID int64) (string, error) {
+	kw, err := c.getKeyword(c.db, keywordID)
+	if err != nil {
+		return "", err
+	}
+	return c.keywordPath(c.db, kw)
+}
+
+// keywordPath builds the full path of a keyword by walking its parents
+func (c *Catalog) keywordPath(db dbExecutor, kw *Keyword) (string, error) {
+	names, err := c.keywordPathNames(db, kw)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(names, "/"), nil
+}
+
+// keywordPathNames returns the names from the top-level ancestor of a
+// keyword down to the keyword itself
+func (c *Catalog) keywordPathNames(db dbExecutor, kw *Keyword) ([]string, error) {
+	names := []string{kw.Name}
+	seen := map[int64]bool{kw.ID: true}
+	for parentID := kw.ParentID; parentID != nil && !seen[*parentID]; {
+		parent, err := c.getKeyword(db, *parentID)
+		if err != nil {
+			return nil, err
+		}
+		seen[parent.ID] = true
+		names = append(names, parent.Name)
+		parentID = parent.ParentID
+	}
+
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return names, nil
+}
+
+// AddPersonKeyword adds a person keyword to the catalog
+func (c *Catalog) AddPersonKeyword(name string, parentID *int64) (*Keyword, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	kw, err := c.addKeyword(tx, name, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := setKeywordType(tx, kw.ID, KeywordTypePerson); err != nil {
+		return nil, err
+	}
+	kw.Type = KeywordTypePerson
+	return kw, tx.Commit()
+}
+
+// SetKeywordType changes the type of a keyword, e.g. to KeywordTypePerson
+func (c *Catalog) SetKeywordType(keywordID int64, keywordType KeywordType) error {
+	return setKeywordType(c.db, keywordID, keywordType)
+}
+
+// setKeywordType updates keywordType using the given executor
+func setKeywordType(db dbExecutor, keywordID int64, keywordType KeywordType) error {
+	result, err := db.Exec(
+		`UPDATE AgLibraryKeyword SET keywordType = ? WHERE id_local = ?`,
+		nullIfEmpty(string(keywordType)), keywordID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set keyword type: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("keyword not found: %d", keywordID)
+	}
+	return nil
+}
+
+// ListPersonKeywords returns all person keywords in the catalog
+func (c *Catalog) ListPersonKeywords() ([]*Keyword, error) {
+	rows, err := c.db.Query(
+		`SELECT `+keywordColumns+` FROM AgLibraryKeyword k WHERE k.keywordType = ? ORDER BY k.name`,
+		string(KeywordTypePerson),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanKeywords(rows)
+}
+
+// SetKeywordExportFlags sets whether a keyword is exported, whether the
+// keywords containing it are exported with it, and whether its synonyms are
+func (c *Catalog) SetKeywordExportFlags(keywordID int64, includeOnExport, includeParents, includeSynonyms bool) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := setKeywordExportFlags(tx, keywordID, includeOnExport, includeParents, includeSynonyms); err != nil {
+		return err
+	}
+	if err := c.refreshKeywordSubtreeXMP(tx, keywordID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setKeywordExportFlags updates the export flags using the given executor
+func setKeywordExportFlags(db dbExecutor, keywordID int64, includeOnExport, includeParents, includeSynonyms bool) error {
+	result, err := db.Exec(
+		`UPDATE AgLibraryKeyword SET includeOnExport = ?, includeParents = ?, includeSynonyms = ? WHERE id_local = ?`,
+		boolToInt(includeOnExport), boolToInt(includeParents), boolToInt(includeSynonyms), keywordID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set keyword export flags: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("keyword not found: %d", keywordID)
+	}
+	return nil
+}
+
+// AddKeywordSynonym adds a synonym to a keyword. Synonyms are compared
+// case-insensitively; adding one the keyword already has does nothing.
+func (c *Catalog) AddKeywordSynonym(keywordID int64, synonym string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := c.addKeywordSynonym(tx, keywordID, synonym); err != nil {
+		return err
+	}
+	if err := c.refreshKeywordSubtreeXMP(tx, keywordID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addKeywordSynonym adds a synonym using the given executor
+func (c *Catalog) addKeywordSynonym(db dbExecutor, keywordID int64, synonym string) error {
+	synonym = strings.TrimSpace(synonym)
+	if synonym == "" {
+		return fmt.Errorf("synonym is empty")
+	}
+	if _, err := c.getKeyword(db, keywordID); err != nil {
+		return err
+	}
+
+	lcName := strings.ToLower(synonym)
+	var count int
+	if err := db.QueryRow(
+		`SELECT COUNT(*) FROM AgLibraryKeywordSynonym WHERE keyword = ? AND lc_name = ?`,
+		keywordID, lcName,
+	).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(
+		`INSERT INTO AgLibraryKeywordSynonym (keyword, lc_name, name) VALUES (?, ?, ?)`,
+		keywordID, lcName, synonym,
+	); err != nil {
+		return fmt.Errorf("failed to add synonym: %w", err)
+	}
+	return nil
+}
+
+// RemoveKeywordSynonym removes a synonym from a keyword
+func (c *Catalog) RemoveKeywordSynonym(keywordID int64, synonym string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`DELETE FROM AgLibraryKeywordSynonym WHERE keyword = ? AND lc_name = ?`,
+		keywordID, strings.ToLower(strings.TrimSpace(synonym)),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to remove synonym: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := c.refreshKeywordSubtreeXMP(tx, keywordID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetKeywordSynonyms returns the synonyms of a keyword in the order they were added
+func (c *Catalog) GetKeywordSynonyms(keywordID int64) ([]string, error) {
+	return getKeywordSynonyms(c.db, keywordID)
+}
+
+// getKeywordSynonyms returns the synonyms of a keyword using the given executor
+func getKeywordSynonyms(db dbExecutor, keywordID int64) ([]string, error) {
+	rows, err := db.Query(
+		`SELECT name FROM AgLibraryKeywordSynonym WHERE keyword = ? ORDER BY id_local`,
+		keywordID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var synonyms []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		synonyms = append(synonyms, name)
+	}
+	return synonyms, rows.Err()
+}
+
+// allKeywordSynonyms returns the synonyms of every keyword by keyword ID
+func (c *Catalog) allKeywordSynonyms() (map[int64][]string, error) {
+	rows, err := c.db.Query(`SELECT keyword, name FROM AgLibraryKeywordSynonym ORDER BY id_local`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	synonyms := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		synonyms[id] = append(synonyms[id], name)
+	}
+	return synonyms, rows.Err()
+}
+
+// SearchKeywords returns the keywords whose name or one of whose synonyms
+// contains text, ignoring case
+func (c *Catalog) SearchKeywords(text string) ([]*Keyword, error) {
+	lcText := strings.ToLower(text)
+	rows, err := c.db.Query(
+		`SELECT `+keywordColumns+` FROM AgLibraryKeyword k
+		 WHERE instr(k.lc_name, ?) > 0
+		    OR EXISTS (SELECT 1 FROM AgLibraryKeywordSynonym s WHERE s.keyword = k.id_local AND instr(s.lc_name, ?) > 0)
+		 ORDER BY k.name`,
+		lcText, lcText,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanKeywords(rows)
+}
+
+// GetImageExportKeywords returns the keywords Lightroom writes to an
+// exported copy of an image (dc:subject): each applied keyword marked
+// IncludeOnExport, its synonyms if IncludeSynonyms is set, and, if
+// IncludeParents is set, the exportable keywords containing it with their
+// synonyms. The result is deduplicated ignoring case and sorted.
+func (c *Catalog) GetImageExportKeywords(imageID int64) ([]string, error) {
+	return c.imageExportKeywords(c.db, imageID)
+}
+
+// imageExportKeywords collects the export keywords using the given executor
+func (c *Catalog) imageExportKeywords(db dbExecutor, imageID int64) ([]string, error) {
+	rows, err := db.Query(
+		`SELECT `+keywordColumns+`
+		 FROM AgLibraryKeyword k
+		 JOIN AgLibraryKeywordImage ki ON k.id_local = ki.tag
+		 WHERE ki.image = ?`,
+		imageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := scanKeywords(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	add := func(kw *Keyword) error {
+		if !kw.IncludeOnExport {
+			return nil
+		}
+		terms := []string{kw.Name}
+		if kw.IncludeSynonyms {
+			synonyms, err := getKeywordSynonyms(db, kw.ID)
+			if err != nil {
+				return err
+			}
+			terms = append(terms, synonyms...)
+		}
+		for _, term := range terms {
+			if lc := strings.ToLower(term); !seen[lc] {
+				seen[lc] = true
+				names = append(names, term)
+			}
+		}
+		return nil
+	}
+
+	ancestors := map[int64]*Keyword{}
+	for _, kw := range applied {
+		if err := add(kw); err != nil {
+			return nil, err
+		}
+		if !kw.IncludeParents {
+			continue
+		}
+		for parentID := kw.ParentID; parentID != nil; {
+			parent, ok := ancestors[*parentID]
+			if !ok {
+				if parent, err = c.getKeyword(db, *parentID); err != nil {
+					return nil, err
+				}
+				ancestors[parent.ID] = parent
+			}
+			if err := add(parent); err != nil {
+				return nil, err
+			}
+			parentID = parent.ParentID
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+	return names, nil
+}
+
+// keywordGenealogy returns the genealogy of keyword id below a parent with
+// the given genealogy ("" for a top-level keyword)
+func keywordGenealogy(parentGenealogy string, id int64) string {
+	if parentGenealogy == "" {
+		return fmt.Sprintf("%d", id)
+	}
+	return fmt.Sprintf("%s/%d", parentGenealogy, id)
+}
+
+// RenameKeyword renames a keyword. Another keyword with the same name under
+// the same parent is an error.
+func (c *Catalog) RenameKeyword(keywordID int64, newName string) (*Keyword, error) {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return nil, fmt.Errorf("keyword name is empty")
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	kw, err := c.getKeyword(tx, keywordID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkKeywordSibling(tx, newName, kw.ParentID, kw.ID); err != nil {
+		return nil, err
+	}
+
+	lcName := strings.ToLower(newName)
+	if _, err := tx.Exec(
+		`UPDATE AgLibraryKeyword SET name = ?, lc_name = ? WHERE id_local = ?`,
+		newName, lcName, kw.ID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to rename keyword: %w", err)
+	}
+	if err := c.refreshKeywordSubtreeXMP(tx, kw.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	kw.Name, kw.LCName = newName, lcName
+	return kw, nil
+}
+
+// MoveKeyword moves a keyword and its descendants below newParentID, or to
+// the top level if newParentID is nil, rewriting the genealogy of the whole
+// subtree. Another keyword with the same name under the new parent is an
+// error.
+func (c *Catalog) MoveKeyword(keywordID int64, newParentID *int64) (*Keyword, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	kw, err := c.getKeyword(tx, keywordID)
+	if err != nil {
+		return nil, err
+	}
+
+	parentGenealogy := ""
+	if newParentID != nil {
+		parent, err := c.getKeyword(tx, *newParentID)
+		if err != nil {
+			return nil, err
+		}
+		subtree, err := keywordSubtree(tx, kw.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range subtree {
+			if id == parent.ID {
+				return nil, fmt.Errorf("cannot move keyword %s below itself", kw.Name)
+			}
+		}
+		parentGenealogy = parent.Genealogy
+	}
+	if err := c.checkKeywordSibling(tx, kw.Name, newParentID, kw.ID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE AgLibraryKeyword SET parent = ? WHERE id_local = ?`, newParentID, kw.ID); err != nil {
+		return nil, fmt.Errorf("failed to move keyword: %w", err)
+	}
+	if err := rewriteKeywordGenealogy(tx, kw.ID, parentGenealogy); err != nil {
+		return nil, err
+	}
+	if err := c.refreshKeywordSubtreeXMP(tx, kw.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	kw.ParentID = newParentID
+	kw.Genealogy = keywordGenealogy(parentGenealogy, kw.ID)
+	return kw, nil
+}
+
+// MergeKeywords merges keyword fromID into intoID: images tagged with fromID
+// are tagged with intoID instead (without duplicate links), its synonyms and
+// children move to intoID, and fromID is deleted. A child whose name intoID
+// already has below it is merged the same way.
+func (c *Catalog) MergeKeywords(fromID, intoID int64) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := c.mergeKeyword(tx, fromID, intoID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// mergeKeyword merges one keyword into another using the given executor
+func (c *Catalog) mergeKeyword(db dbExecutor, fromID, intoID int64) error {
+	from, err := c.getKeyword(db, fromID)
+	if err != nil {
+		return err
+	}
+	into, err := c.getKeyword(db, intoID)
+	if err != nil {
+		return err
+	}
+	subtree, err := keywordSubtree(db, from.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range subtree {
+		if id == into.ID {
+			return fmt.Errorf("cannot merge keyword %s into itself or a keyword below it", from.Name)
+		}
+	}
+
+	// Children of from move below into and change path, so the images
+	// tagged anywhere in from's subtree need their XMP refreshed
+	imageIDs, err := keywordImageIDs(db, append(subtree, into.ID))
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(
+		`UPDATE AgLibraryKeywordImage SET tag = ?
+		 WHERE tag = ? AND image NOT IN (SELECT image FROM AgLibraryKeywordImage WHERE tag = ?)`,
+		into.ID, from.ID, into.ID,
+	); err != nil {
+		return fmt.Errorf("failed to merge keyword images: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM AgLibraryKeywordImage WHERE tag = ?`, from.ID); err != nil {
+		return fmt.Errorf("failed to merge keyword images: %w", err)
+	}
+	if err := updateKeywordImageCount(db, into.ID); err != nil {
+		return err
+	}
+
+	synonyms, err := getKeywordSynonyms(db, from.ID)
+	if err != nil {
+		return err
+	}
+	for _, synonym := range synonyms {
+		if err := c.addKeywordSynonym(db, into.ID, synonym); err != nil {
+			return err
+		}
+	}
+
+	children, err := keywordChildIDs(db, from.ID)
+	if err != nil {
+		return err
+	}
+	for _, childID := range children {
+		child, err := c.getKeyword(db, childID)
+		if err != nil {
+			return err
+		}
+		existing, err := c.getKeywordUnder(db, child.Name, &into.ID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			if err := c.mergeKeyword(db, child.ID, existing.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := db.Exec(`UPDATE AgLibraryKeyword SET parent = ? WHERE id_local = ?`, into.ID, child.ID); err != nil {
+			return fmt.Errorf("failed to move keyword: %w", err)
+		}
+		if err := rewriteKeywordGenealogy(db, child.ID, into.Genealogy); err != nil {
+			return err
+		}
+	}
+
+	if err := deleteKeywordRows(db, []int64{from.ID}); err != nil {
+		return err
+	}
+	return c.refreshKeywordXMP(db, imageIDs)
+}
+
+// DeleteKeyword deletes a keyword and removes it from all images. With
+// recursive the keywords below it are deleted too; otherwise a keyword with
+// children is an error.
+func (c *Catalog) DeleteKeyword(keywordID int64, recursive bool) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	kw, err := c.getKeyword(tx, keywordID)
+	if err != nil {
+		return err
+	}
+	subtree, err := keywordSubtree(tx, kw.ID)
+	if err != nil {
+		return err
+	}
+	if len(subtree) > 1 && !recursive {
+		return fmt.Errorf("keyword %s has %d keywords below it", kw.Name, len(subtree)-1)
+	}
+
+	imageIDs, err := keywordImageIDs(tx, subtree)
+	if err != nil {
+		return err
+	}
+	if err := deleteKeywordRows(tx, subtree); err != nil {
+		return err
+	}
+	if err := c.refreshKeywordXMP(tx, imageIDs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// checkKeywordSibling returns an error if a keyword other than selfID named
+// name exists under parentID
+func (c *Catalog) checkKeywordSibling(db dbExecutor, name string, parentID *int64, selfID int64) error {
+	existing, err := c.getKeywordUnder(db, name, parentID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != selfID {
+		return fmt.Errorf("keyword %s already exists", existing.Name)
+	}
+	return nil
+}
+
+// keywordSubtree returns the ID of a keyword followed by the IDs of all
+// keywords below it
+func keywordSubtree(db dbExecutor, keywordID int64) ([]int64, error) {
+	return queryIDs(db,
+		`WITH RECURSIVE subtree(id) AS (
+		     SELECT ?
+		     UNION
+		     SELECT k.id_local FROM AgLibraryKeyword k JOIN subtree ON k.parent = subtree.id
+		 )
+		 SELECT id FROM subtree`,
+		keywordID,
+	)
+}
+
+// keywordChildIDs returns the IDs of the keywords directly below a keyword
+func keywordChildIDs(db dbExecutor, keywordID int64) ([]int64, error) {
+	return queryIDs(db, `SELECT id_local FROM AgLibraryKeyword WHERE parent = ? ORDER BY id_local`, keywordID)
+}
+
+// keywordImageIDs returns the images tagged with any of the keywords
+func keywordImageIDs(db dbExecutor, keywordIDs []int64) ([]int64, error) {
+	seen := map[int64]bool{}
+	var imageIDs []int64
+	for _, keywordID := range keywordIDs {
+		ids, err := queryIDs(db, `SELECT image FROM AgLibraryKeywordImage WHERE tag = ?`, keywordID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				imageIDs = append(imageIDs, id)
+			}
+		}
+	}
+	return imageIDs, nil
+}
+
+// queryIDs returns the single integer column of a query
+func queryIDs(db dbExecutor, query string, args ...interface{}) ([]int64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// rewriteKeywordGenealogy sets the genealogy of a keyword below a parent with
+// parentGenealogy, and of every keyword below it
+func rewriteKeywordGenealogy(db dbExecutor, keywordID int64, parentGenealogy string) error {
+	genealogy := keywordGenealogy(parentGenealogy, keywordID)
+	if _, err := db.Exec(`UPDATE AgLibraryKeyword SET genealogy = ? WHERE id_local = ?`, genealogy, keywordID); err != nil {
+		return fmt.Errorf("failed to update genealogy: %w", err)
+	}
+	children, err := keywordChildIDs(db, keywordID)
+	if err != nil {
+		return err
+	}
+	for _, childID := range children {
+		if err := rewriteKeywordGenealogy(db, childID, genealogy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteKeywordRows deletes keywords with their image links and synonyms
+func deleteKeywordRows(db dbExecutor, keywordIDs []int64) error {
+	for _, id := range keywordIDs {
+		if _, err := db.Exec(`DELETE FROM AgLibraryKeywordImage WHERE tag = ?`, id); err != nil {
+			return fmt.Errorf("failed to remove keyword from images: %w", err)
+		}
+		if _, err := db.Exec(`DELETE FROM AgLibraryKeywordSynonym WHERE keyword = ?`, id); err != nil {
+			return fmt.Errorf("failed to remove synonyms: %w", err)
+		}
+		if _, err := db.Exec(`DELETE FROM AgLibraryKeyword WHERE id_local = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete keyword: %w", err)
+		}
+	}
+	return nil
+}
+
+// refreshKeywordSubtreeXMP refreshes the XMP of images tagged with a keyword
+// or any keyword below it, whose exported keywords may include its name
+func (c *Catalog) refreshKeywordSubtreeXMP(db dbExecutor, keywordID int64) error {
+	subtree, err := keywordSubtree(db, keywordID)
+	if err != nil {
+		return err
+	}
+	imageIDs, err := keywordImageIDs(db, subtree)
+	if err != nil {
+		return err
+	}
+	return c.refreshKeywordXMP(db, imageIDs)
+}
+
+// refreshKeywordXMP records that the keywords of images changed: their
+// stored XMP is rewritten, the images are touched and their XMP sidecars
+// flagged as out of date, so Lightroom writes them again
+func (c *Catalog) refreshKeywordXMP(db dbExecutor, imageIDs []int64) error {
+	now := ToLightroomTimestamp(time.Now())
+	for _, id := range imageIDs {
+		if _, err := c.syncKeywordXMP(db, id); err != nil {
+			return err
+		}
+		if _, err := db.Exec(
+			`UPDATE Adobe_images SET touchCount = touchCount + 1, touchTime = ? WHERE id_local = ?`,
+			now, id,
+		); err != nil {
+			return fmt.Errorf("failed to touch image %d: %w", id, err)
+		}
+		if _, err := db.Exec(
+			`UPDATE Adobe_AdditionalMetadata SET externalXmpIsDirty = 1 WHERE image = ?`,
+			id,
+		); err != nil {
+			return fmt.Errorf("failed to mark XMP of image %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// RebuildKeywordXMP rewrites dc:subject and lr:hierarchicalSubject in the
+// stored XMP of every image from its keywords, e.g. for catalogs written
+// before keywords were kept in the XMP. Images whose XMP changed have their
+// sidecars flagged as out of date. It returns the number of images updated.
+func (c *Catalog) RebuildKeywordXMP() (int, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	imageIDs, err := queryIDs(tx, `SELECT id_local FROM Adobe_images ORDER BY id_local`)
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, id := range imageIDs {
+		changed, err := c.syncKeywordXMP(tx, id)
+		if err != nil {
+			return 0, err
+		}
+		if !changed {
+			continue
+		}
+		if _, err := tx.Exec(
+			`UPDATE Adobe_AdditionalMetadata SET externalXmpIsDirty = 1 WHERE image = ?`,
+			id,
+		); err != nil {
+			return 0, fmt.Errorf("failed to mark XMP of image %d: %w", id, err)
+		}
+		updated++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+// syncKeywordXMP writes an image's export keywords to dc:subject and the
+// paths of its keywords, joined with "|", to lr:hierarchicalSubject in its
+// stored XMP. Keywords excluded from export are left out of both. It reports
+// whether the XMP changed.
+func (c *Catalog) syncKeywordXMP(db dbExecutor, imageID int64) (bool, error) {
+	subjects, err := c.imageExportKeywords(db, imageID)
+	if err != nil {
+		return false, err
+	}
+	hierarchy, err := c.imageKeywordHierarchy(db, imageID)
+	if err != nil {
+		return false, err
+	}
+
+	xmp, err := getXMP(db, imageID)
+	if err != nil {
+		return false, err
+	}
+	updated := xmp
+	if updated == "" {
+		if len(subjects) == 0 && len(hierarchy) == 0 {
+			return false, nil
+		}
+		if updated, err = basicImageXMP(db, imageID); err != nil {
+			return false, err
+		}
+	}
+
+	if updated, err = SetXMPBag(updated, "dc:subject", subjects); err != nil {
+		return false, err
+	}
+	if updated, err = SetXMPBag(updated, "lr:hierarchicalSubject", hierarchy); err != nil {
+		return false, err
+	}
+	if updated == xmp {
+		return false, nil
+	}
+	if err := setXMP(db, imageID, updated); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// imageKeywordHierarchy returns the "|"-separated paths of the keywords
+// applied to an image that are included on export, sorted case-insensitively
+func (c *Catalog) imageKeywordHierarchy(db dbExecutor, imageID int64) ([]string, error) {
+	rows, err := db.Query(
+		`SELECT `+keywordColumns+`
+		 FROM AgLibraryKeyword k
+		 JOIN AgLibraryKeywordImage ki ON k.id_local = ki.tag
+		 WHERE ki.image = ? AND k.includeOnExport != 0`,
+		imageID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := scanKeywords(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	for _, kw := range applied {
+		names, err := c.keywordPathNames(db, kw)
+		if err != nil {
+			return nil, err
+		}
+		if path := strings.Join(names, "|"); !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.ToLower(paths[i]) < strings.ToLower(paths[j])
+	})
+	return paths, nil
+}
+
+// basicImageXMP generates the XMP of an image that has none yet from its
+// rating, color label and capture time
+func basicImageXMP(db dbExecutor, imageID int64) (string, error) {
+	var rating sql.NullInt64
+	var colorLabel, captureTime sql.NullString
+	if err := db.QueryRow(
+		`SELECT rating, colorLabels, captureTime FROM Adobe_images WHERE id_local = ?`,
+		imageID,
+	).Scan(&rating, &colorLabel, &captureTime); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("image not found: %d", imageID)
+		}
+		return "", err
+	}
+
+	var ratingPtr *int
+	if rating.Valid {
+		r := int(rating.Int64)
+		ratingPtr = &r
+	}
+	return GenerateBasicXMP(ratingPtr, colorLabel.String, captureTime.String), nil
+}
@@ -1,6 +1,9 @@
 package lrcat
 
 import (
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -231,6 +234,9 @@ func TestCreateHierarchicalKeywords(t *testing.T) {
 	if dogs.Name != "Dogs" {
 		t.Errorf("Expected parent 'Dogs', got '%s'", dogs.Name)
 	}
+	if _, err := catalog.CreateHierarchicalKeywords(" / /"); err == nil {
+		t.Error("Expected a path without names to fail")
+	}
 }
 
 func TestMultipleKeywordsOnImage(t *testing.T) {
@@ -254,3 +260,549 @@ func TestMultipleKeywordsOnImage(t *testing.T) {
 		t.Errorf("Expected 4 keywords, got %d", len(imageKeywords))
 	}
 }
+
+func TestKeywordSynonyms(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	kw, _ := catalog.AddKeyword("Automobile", nil)
+	catalog.AddKeyword("Bicycle", nil)
+
+	for _, synonym := range []string{"Car", "auto", "car"} {
+		if err := catalog.AddKeywordSynonym(kw.ID, synonym); err != nil {
+			t.Fatalf("Failed to add synonym %s: %v", synonym, err)
+		}
+	}
+	if err := catalog.AddKeywordSynonym(kw.ID, " "); err == nil {
+		t.Error("Expected an empty synonym to be rejected")
+	}
+	if err := catalog.AddKeywordSynonym(9999, "x"); err == nil {
+		t.Error("Expected an error for a missing keyword")
+	}
+
+	synonyms, _ := catalog.GetKeywordSynonyms(kw.ID)
+	if len(synonyms) != 2 || synonyms[0] != "Car" || synonyms[1] != "auto" {
+		t.Errorf("Expected [Car auto], got %v", synonyms)
+	}
+
+	found, _ := catalog.SearchKeywords("CAR")
+	if len(found) != 1 || found[0].ID != kw.ID {
+		t.Errorf("Expected the synonym to match Automobile, got %v", found)
+	}
+	found, _ = catalog.SearchKeywords("bi")
+	if len(found) != 2 {
+		t.Errorf("Expected Automobile and Bicycle to match, got %d keywords", len(found))
+	}
+
+	catalog.RemoveKeywordSynonym(kw.ID, "CAR")
+	synonyms, _ = catalog.GetKeywordSynonyms(kw.ID)
+	if len(synonyms) != 1 || synonyms[0] != "auto" {
+		t.Errorf("Expected [auto], got %v", synonyms)
+	}
+}
+
+func TestPersonKeywords(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	people, _ := catalog.AddKeyword("People", nil)
+	jane, err := catalog.AddPersonKeyword("Jane Doe", &people.ID)
+	if err != nil {
+		t.Fatalf("Failed to add person keyword: %v", err)
+	}
+	if jane.Type != KeywordTypePerson {
+		t.Errorf("Expected a person keyword, got %q", jane.Type)
+	}
+	john, _ := catalog.AddKeyword("John Doe", &people.ID)
+	if err := catalog.SetKeywordType(john.ID, KeywordTypePerson); err != nil {
+		t.Fatalf("Failed to set keyword type: %v", err)
+	}
+
+	persons, _ := catalog.ListPersonKeywords()
+	if len(persons) != 2 || persons[0].Name != "Jane Doe" || persons[1].Name != "John Doe" {
+		t.Errorf("Unexpected person keywords: %v", persons)
+	}
+	if kw, _ := catalog.GetKeyword(people.ID); kw.Type != KeywordTypeStandard {
+		t.Errorf("Expected People to stay a standard keyword, got %q", kw.Type)
+	}
+
+	catalog.SetKeywordType(john.ID, KeywordTypeStandard)
+	if persons, _ := catalog.ListPersonKeywords(); len(persons) != 1 {
+		t.Errorf("Expected one person keyword, got %d", len(persons))
+	}
+	if err := catalog.SetKeywordType(9999, KeywordTypePerson); err == nil {
+		t.Error("Expected an error for a missing keyword")
+	}
+}
+
+func TestGetImageExportKeywords(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	paris, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	france, _ := catalog.GetKeywordByName("France")
+	places, _ := catalog.GetKeywordByName("Places")
+	private, _ := catalog.AddKeyword("Private", nil)
+
+	catalog.AddKeywordSynonym(paris.ID, "City of Light")
+	catalog.AddKeywordSynonym(france.ID, "République française")
+	catalog.SetKeywordExportFlags(places.ID, false, true, true)
+	catalog.SetKeywordExportFlags(private.ID, false, true, true)
+	catalog.AddKeywordToImage(image.ID, paris.ID)
+	catalog.AddKeywordToImage(image.ID, private.ID)
+
+	keywords, err := catalog.GetImageExportKeywords(image.ID)
+	if err != nil {
+		t.Fatalf("GetImageExportKeywords failed: %v", err)
+	}
+	want := []string{"City of Light", "France", "Paris", "République française"}
+	if strings.Join(keywords, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %v, got %v", want, keywords)
+	}
+
+	catalog.SetKeywordExportFlags(paris.ID, true, false, false)
+	keywords, _ = catalog.GetImageExportKeywords(image.ID)
+	if len(keywords) != 1 || keywords[0] != "Paris" {
+		t.Errorf("Expected only Paris, got %v", keywords)
+	}
+	kw, _ := catalog.GetKeyword(paris.ID)
+	if !kw.IncludeOnExport || kw.IncludeParents || kw.IncludeSynonyms {
+		t.Errorf("Unexpected export flags: %+v", kw)
+	}
+}
+
+func TestRenameKeyword(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	paris, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	france, _ := catalog.GetKeywordByName("France")
+	catalog.CreateHierarchicalKeywords("Places/Spain")
+	catalog.AddKeywordToImage(image.ID, paris.ID)
+
+	if _, err := catalog.RenameKeyword(france.ID, "spain"); err == nil {
+		t.Error("Expected renaming onto a sibling's name to fail")
+	}
+	renamed, err := catalog.RenameKeyword(france.ID, "République")
+	if err != nil {
+		t.Fatalf("RenameKeyword failed: %v", err)
+	}
+	if renamed.Name != "République" || renamed.LCName != "république" {
+		t.Errorf("Unexpected renamed keyword: %+v", renamed)
+	}
+	if kw, _ := catalog.GetKeyword(france.ID); kw.LCName != "république" {
+		t.Errorf("Expected lc_name to be updated, got %q", kw.LCName)
+	}
+
+	// Images below the renamed keyword are flagged for an XMP refresh
+	var dirty int
+	catalog.DB().QueryRow(`SELECT externalXmpIsDirty FROM Adobe_AdditionalMetadata WHERE image = ?`, image.ID).Scan(&dirty)
+	if dirty != 1 {
+		t.Error("Expected the image's XMP to be marked dirty")
+	}
+}
+
+func TestMoveKeyword(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	paris, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	france, _ := catalog.GetKeywordByName("France")
+	europe, _ := catalog.CreateHierarchicalKeywords("Places/Europe")
+
+	if _, err := catalog.MoveKeyword(france.ID, &paris.ID); err == nil {
+		t.Error("Expected moving a keyword below itself to fail")
+	}
+
+	moved, err := catalog.MoveKeyword(france.ID, &europe.ID)
+	if err != nil {
+		t.Fatalf("MoveKeyword failed: %v", err)
+	}
+	if *moved.ParentID != europe.ID || moved.Genealogy != europe.Genealogy+"/"+itoa(france.ID) {
+		t.Errorf("Unexpected moved keyword: %+v", moved)
+	}
+	paris, _ = catalog.GetKeyword(paris.ID)
+	if paris.Genealogy != moved.Genealogy+"/"+itoa(paris.ID) {
+		t.Errorf("Expected the subtree genealogy to be rewritten, got %s", paris.Genealogy)
+	}
+
+	top, err := catalog.MoveKeyword(france.ID, nil)
+	if err != nil {
+		t.Fatalf("MoveKeyword to the top level failed: %v", err)
+	}
+	if top.ParentID != nil || top.Genealogy != itoa(france.ID) {
+		t.Errorf("Unexpected top-level keyword: %+v", top)
+	}
+
+	catalog.AddKeyword("France", &europe.ID)
+	if _, err := catalog.MoveKeyword(france.ID, &europe.ID); err == nil {
+		t.Error("Expected a name clash under the new parent to fail")
+	}
+}
+
+func TestMergeKeywords(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	a, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	b, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/b.jpg"})
+	car, _ := catalog.AddKeyword("Car", nil)
+	auto, _ := catalog.AddKeyword("Automobile", nil)
+	catalog.AddKeywordSynonym(car.ID, "Motorcar")
+	red, _ := catalog.AddKeyword("Red", &car.ID)
+	catalog.AddKeyword("Red", &auto.ID)
+	blue, _ := catalog.AddKeyword("Blue", &car.ID)
+
+	catalog.AddKeywordToImage(a.ID, car.ID)
+	catalog.AddKeywordToImage(a.ID, auto.ID)
+	catalog.AddKeywordToImage(b.ID, car.ID)
+	catalog.AddKeywordToImage(b.ID, red.ID)
+
+	if err := catalog.MergeKeywords(car.ID, red.ID); err == nil {
+		t.Error("Expected merging into a child to fail")
+	}
+	if err := catalog.MergeKeywords(car.ID, auto.ID); err != nil {
+		t.Fatalf("MergeKeywords failed: %v", err)
+	}
+
+	if _, err := catalog.GetKeyword(car.ID); err == nil {
+		t.Error("Expected the merged keyword to be deleted")
+	}
+	var links int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryKeywordImage WHERE tag = ?`, auto.ID).Scan(&links)
+	if links != 2 {
+		t.Errorf("Expected 2 links without duplicates, got %d", links)
+	}
+	if synonyms, _ := catalog.GetKeywordSynonyms(auto.ID); len(synonyms) != 1 || synonyms[0] != "Motorcar" {
+		t.Errorf("Expected the synonym to move, got %v", synonyms)
+	}
+
+	// Red was merged into the existing Automobile/Red, Blue moved over
+	if _, err := catalog.GetKeyword(red.ID); err == nil {
+		t.Error("Expected Car/Red to be merged")
+	}
+	keywords, _ := catalog.GetImageKeywords(b.ID)
+	if len(keywords) != 2 {
+		t.Errorf("Expected Automobile and Automobile/Red on b, got %v", keywords)
+	}
+	blue, _ = catalog.GetKeyword(blue.ID)
+	if *blue.ParentID != auto.ID || blue.Genealogy != auto.Genealogy+"/"+itoa(blue.ID) {
+		t.Errorf("Expected Blue below Automobile, got %+v", blue)
+	}
+}
+
+func TestDeleteKeyword(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	paris, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	places, _ := catalog.GetKeywordByName("Places")
+	catalog.AddKeywordSynonym(paris.ID, "City of Light")
+	catalog.AddKeywordToImage(image.ID, paris.ID)
+
+	if err := catalog.DeleteKeyword(places.ID, false); err == nil {
+		t.Error("Expected deleting a keyword with children to need recursive")
+	}
+	if err := catalog.DeleteKeyword(places.ID, true); err != nil {
+		t.Fatalf("DeleteKeyword failed: %v", err)
+	}
+
+	if keywords, _ := catalog.ListKeywords(); len(keywords) != 0 {
+		t.Errorf("Expected all keywords to be deleted, got %d", len(keywords))
+	}
+	if keywords, _ := catalog.GetImageKeywords(image.ID); len(keywords) != 0 {
+		t.Errorf("Expected the image to lose its keywords, got %d", len(keywords))
+	}
+	var synonyms int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryKeywordSynonym`).Scan(&synonyms)
+	if synonyms != 0 {
+		t.Errorf("Expected synonyms to be deleted, got %d", synonyms)
+	}
+	if err := catalog.DeleteKeyword(places.ID, true); err == nil {
+		t.Error("Expected an error for a deleted keyword")
+	}
+}
+
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func TestHierarchicalKeywordLookup(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	city, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	person, _ := catalog.CreateHierarchicalKeywords("People/Paris")
+	if city.ID == person.ID {
+		t.Fatal("Expected People/Paris to be a separate keyword")
+	}
+
+	// Existing levels are reused per branch
+	again, _ := catalog.CreateHierarchicalKeywords("places/france/PARIS")
+	if again.ID != city.ID {
+		t.Errorf("Expected the existing Places/France/Paris, got %+v", again)
+	}
+	louvre, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris/Louvre")
+	if louvre.ParentID == nil || *louvre.ParentID != city.ID {
+		t.Errorf("Expected Louvre below Places/France/Paris, got %+v", louvre)
+	}
+
+	found, err := catalog.GetKeywordByPath("Places/France/Paris")
+	if err != nil || found == nil || found.ID != city.ID {
+		t.Errorf("Expected Places/France/Paris, got %+v (%v)", found, err)
+	}
+	if found, _ := catalog.GetKeywordByPath("Places/Paris"); found != nil {
+		t.Errorf("Expected no keyword at Places/Paris, got %+v", found)
+	}
+
+	people, _ := catalog.GetKeywordByNameUnder("People", nil)
+	under, _ := catalog.GetKeywordByNameUnder("paris", &people.ID)
+	if under == nil || under.ID != person.ID {
+		t.Errorf("Expected People/Paris, got %+v", under)
+	}
+	if top, _ := catalog.GetKeywordByNameUnder("Paris", nil); top != nil {
+		t.Errorf("Expected no top-level Paris, got %+v", top)
+	}
+
+	matches, err := catalog.FindKeywords("PARIS")
+	if err != nil {
+		t.Fatalf("FindKeywords failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].Path != "People/Paris" || matches[1].Path != "Places/France/Paris" {
+		t.Errorf("Unexpected matches: %+v", matches)
+	}
+	if path, _ := catalog.GetKeywordPath(louvre.ID); path != "Places/France/Paris/Louvre" {
+		t.Errorf("Unexpected path: %s", path)
+	}
+
+	// GetOrCreateKeyword only reuses a keyword below the given parent
+	top, _ := catalog.GetOrCreateKeyword("Paris", nil)
+	if top.ID == city.ID || top.ID == person.ID || top.ParentID != nil {
+		t.Errorf("Expected a new top-level Paris, got %+v", top)
+	}
+}
+
+func TestKeywordTree(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	a, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	b, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/b.jpg"})
+	paris, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	lyon, _ := catalog.CreateHierarchicalKeywords("Places/France/Lyon")
+	france, _ := catalog.GetKeywordByPath("Places/France")
+	catalog.CreateHierarchicalKeywords("Animals")
+	catalog.AddKeywordSynonym(paris.ID, "City of Light")
+
+	catalog.AddKeywordToImage(a.ID, paris.ID)
+	catalog.AddKeywordToImage(a.ID, lyon.ID)
+	catalog.AddKeywordToImage(a.ID, france.ID)
+	catalog.AddKeywordToImage(b.ID, lyon.ID)
+
+	tree, err := catalog.KeywordTree()
+	if err != nil {
+		t.Fatalf("KeywordTree failed: %v", err)
+	}
+	if len(tree) != 2 || tree[0].Path != "Animals" || tree[1].Path != "Places" {
+		t.Fatalf("Unexpected top level: %+v", tree)
+	}
+	places := tree[1]
+	if places.ImageCount != 0 || places.TotalImageCount != 2 {
+		t.Errorf("Expected Places to count 2 images through its children, got %d/%d", places.ImageCount, places.TotalImageCount)
+	}
+	fr := places.Children[0]
+	if fr.ImageCount != 1 || fr.TotalImageCount != 2 || len(fr.Children) != 2 {
+		t.Errorf("Unexpected France node: %+v", fr)
+	}
+	lyonNode, parisNode := fr.Children[0], fr.Children[1]
+	if lyonNode.Path != "Places/France/Lyon" || lyonNode.ImageCount != 2 {
+		t.Errorf("Unexpected Lyon node: %+v", lyonNode)
+	}
+	if len(parisNode.Synonyms) != 1 || parisNode.ImageCount != 1 || parisNode.Keyword.LastApplied.IsZero() {
+		t.Errorf("Unexpected Paris node: %+v", parisNode)
+	}
+	if !tree[0].Keyword.LastApplied.IsZero() || !tree[0].Keyword.IncludeOnExport {
+		t.Errorf("Unexpected Animals keyword: %+v", tree[0].Keyword)
+	}
+}
+
+func TestKeywordImageCountCache(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	imageCount := func(id int64) int {
+		var n int
+		catalog.DB().QueryRow(`SELECT imageCountCache FROM AgLibraryKeyword WHERE id_local = ?`, id).Scan(&n)
+		return n
+	}
+
+	a, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	b, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/b.jpg"})
+	kw, _ := catalog.AddKeyword("Beach", nil)
+	other, _ := catalog.AddKeyword("Sea", nil)
+	if imageCount(kw.ID) != -1 {
+		t.Errorf("Expected a new keyword to have no count, got %d", imageCount(kw.ID))
+	}
+
+	catalog.AddKeywordToImage(a.ID, kw.ID)
+	catalog.AddKeywordToImage(a.ID, kw.ID)
+	catalog.AddKeywordToImage(b.ID, kw.ID)
+	if imageCount(kw.ID) != 2 {
+		t.Errorf("Expected 2 after applying, got %d", imageCount(kw.ID))
+	}
+	if keywords, _ := catalog.GetImageKeywords(a.ID); len(keywords) != 1 {
+		t.Errorf("Expected applying twice not to duplicate the link, got %d", len(keywords))
+	}
+
+	catalog.RemoveKeywordFromImage(b.ID, kw.ID)
+	if imageCount(kw.ID) != 1 {
+		t.Errorf("Expected 1 after removing, got %d", imageCount(kw.ID))
+	}
+
+	catalog.AddKeywordToImage(b.ID, other.ID)
+	catalog.MergeKeywords(other.ID, kw.ID)
+	if imageCount(kw.ID) != 2 {
+		t.Errorf("Expected 2 after merging, got %d", imageCount(kw.ID))
+	}
+
+	catalog.RemoveImage(a.ID)
+	if imageCount(kw.ID) != 1 {
+		t.Errorf("Expected 1 after removing an image, got %d", imageCount(kw.ID))
+	}
+
+	catalog.DB().Exec(`UPDATE AgLibraryKeyword SET imageCountCache = -1`)
+	if err := catalog.RefreshKeywordImageCounts(); err != nil {
+		t.Fatalf("RefreshKeywordImageCounts failed: %v", err)
+	}
+	if imageCount(kw.ID) != 1 {
+		t.Errorf("Expected 1 after refreshing, got %d", imageCount(kw.ID))
+	}
+}
+
+func TestKeywordXMP(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	paris, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	secret, _ := catalog.AddKeyword("Secret", nil)
+	catalog.SetKeywordExportFlags(secret.ID, false, true, true)
+
+	subjects := func() ([]string, []string) {
+		xmp, err := catalog.GetXMP(image.ID)
+		if err != nil {
+			t.Fatalf("Failed to get XMP: %v", err)
+		}
+		return ExtractXMPBag(xmp, "dc:subject"), ExtractXMPBag(xmp, "lr:hierarchicalSubject")
+	}
+
+	catalog.AddKeywordToImage(image.ID, paris.ID)
+	catalog.AddKeywordToImage(image.ID, secret.ID)
+	subject, hierarchy := subjects()
+	if !reflect.DeepEqual(subject, []string{"France", "Paris", "Places"}) {
+		t.Errorf("Unexpected dc:subject: %q", subject)
+	}
+	if !reflect.DeepEqual(hierarchy, []string{"Places|France|Paris"}) {
+		t.Errorf("Unexpected lr:hierarchicalSubject: %q", hierarchy)
+	}
+
+	catalog.AddKeywordSynonym(paris.ID, "City of Light")
+	if subject, _ := subjects(); !reflect.DeepEqual(subject, []string{"City of Light", "France", "Paris", "Places"}) {
+		t.Errorf("Expected the synonym in dc:subject, got %q", subject)
+	}
+	catalog.SetKeywordExportFlags(paris.ID, true, false, false)
+	if subject, _ := subjects(); !reflect.DeepEqual(subject, []string{"Paris"}) {
+		t.Errorf("Expected only Paris without parents and synonyms, got %q", subject)
+	}
+
+	catalog.RenameKeyword(paris.ID, "Paname")
+	if _, hierarchy := subjects(); !reflect.DeepEqual(hierarchy, []string{"Places|France|Paname"}) {
+		t.Errorf("Expected the renamed path, got %q", hierarchy)
+	}
+
+	catalog.RemoveKeywordFromImage(image.ID, paris.ID)
+	if subject, hierarchy := subjects(); subject != nil || hierarchy != nil {
+		t.Errorf("Expected no keywords in the XMP, got %q %q", subject, hierarchy)
+	}
+}
+
+func TestAddKeywordToImageIsAtomic(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	kw, _ := catalog.AddKeyword("Beach", nil)
+
+	// The link can be written for a missing image, but its XMP cannot
+	if err := catalog.AddKeywordToImage(9999, kw.ID); err == nil {
+		t.Fatal("Expected adding a keyword to a missing image to fail")
+	}
+	var links, count int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryKeywordImage WHERE tag = ?`, kw.ID).Scan(&links)
+	catalog.DB().QueryRow(`SELECT imageCountCache FROM AgLibraryKeyword WHERE id_local = ?`, kw.ID).Scan(&count)
+	if links != 0 || count != -1 {
+		t.Errorf("Expected the failed call to leave no trace, got %d links and count %d", links, count)
+	}
+}
+
+func TestMergeKeywordsRefreshesChildXMP(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	child, _ := catalog.CreateHierarchicalKeywords("Old/Child")
+	oldKw, _ := catalog.GetKeywordByPath("Old")
+	newKw, _ := catalog.AddKeyword("New", nil)
+	catalog.AddKeywordToImage(image.ID, child.ID)
+
+	if err := catalog.MergeKeywords(oldKw.ID, newKw.ID); err != nil {
+		t.Fatalf("Failed to merge keywords: %v", err)
+	}
+	if path, _ := catalog.GetKeywordPath(child.ID); path != "New/Child" {
+		t.Fatalf("Expected the child to move below New, got %s", path)
+	}
+
+	xmp, _ := catalog.GetXMP(image.ID)
+	if hierarchy := ExtractXMPBag(xmp, "lr:hierarchicalSubject"); !reflect.DeepEqual(hierarchy, []string{"New|Child"}) {
+		t.Errorf("Expected the merged path in lr:hierarchicalSubject, got %q", hierarchy)
+	}
+	if subject := ExtractXMPBag(xmp, "dc:subject"); !reflect.DeepEqual(subject, []string{"Child", "New"}) {
+		t.Errorf("Expected the new parent in dc:subject, got %q", subject)
+	}
+}
+
+func TestRebuildKeywordXMP(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	a, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	b, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/b.jpg"})
+	kw, _ := catalog.CreateHierarchicalKeywords("Animals/Cat")
+
+	// Keywords linked the way older versions did, without touching the XMP
+	catalog.DB().Exec(`INSERT INTO AgLibraryKeywordImage (image, tag) VALUES (?, ?)`, a.ID, kw.ID)
+	catalog.SetXMP(b.ID, GenerateBasicXMP(nil, "", ""))
+
+	updated, err := catalog.RebuildKeywordXMP()
+	if err != nil {
+		t.Fatalf("Failed to rebuild keyword XMP: %v", err)
+	}
+	if updated != 1 {
+		t.Errorf("Expected 1 image updated, got %d", updated)
+	}
+	xmp, _ := catalog.GetXMP(a.ID)
+	if hierarchy := ExtractXMPBag(xmp, "lr:hierarchicalSubject"); !reflect.DeepEqual(hierarchy, []string{"Animals|Cat"}) {
+		t.Errorf("Unexpected lr:hierarchicalSubject: %q", hierarchy)
+	}
+	var dirty int
+	catalog.DB().QueryRow(`SELECT externalXmpIsDirty FROM Adobe_AdditionalMetadata WHERE image = ?`, a.ID).Scan(&dirty)
+	if dirty != 1 {
+		t.Error("Expected the sidecar to be flagged as out of date")
+	}
+
+	if updated, _ := catalog.RebuildKeywordXMP(); updated != 0 {
+		t.Errorf("Expected a second rebuild to change nothing, got %d", updated)
+	}
+}
@@ -0,0 +1,174 @@
+package lrcat
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ImportKeywordList reads a keyword list in the text format of Lightroom's
+// Metadata > Import Keywords and adds the keywords it describes. Each line
+// holds one keyword, indented with one tab per level below its parent.
+// A keyword in [brackets] is not included on export, and a {curly} line is
+// a synonym of the keyword one level up:
+//
+//	Places
+//		France
+//			Paris
+//				{City of Light}
+//	[Private]
+//
+// Keywords that already exist under the same parent are reused and gain the
+// listed synonyms; their export setting is left alone. The number of
+// keywords added is returned. Nothing is added if the list is malformed.
+func (c *Catalog) ImportKeywordList(r io.Reader) (int, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// path holds the keyword at each level of the current line's ancestry
+	var path []*Keyword
+	added := 0
+	// synonymTargets are keywords that gained synonyms, whose images' export
+	// keywords may change
+	synonymTargets := map[int64]bool{}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		depth := len(text) - len(strings.TrimLeft(text, "\t"))
+		entry := strings.TrimSpace(text)
+		if depth > len(path) {
+			return 0, fmt.Errorf("line %d: indented more than one level below its parent", line)
+		}
+
+		if strings.HasPrefix(entry, "{") && strings.HasSuffix(entry, "}") {
+			if depth == 0 {
+				return 0, fmt.Errorf("line %d: synonym %s has no keyword", line, entry)
+			}
+			if err := c.addKeywordSynonym(tx, path[depth-1].ID, entry[1:len(entry)-1]); err != nil {
+				return 0, fmt.Errorf("line %d: %w", line, err)
+			}
+			synonymTargets[path[depth-1].ID] = true
+			continue
+		}
+
+		name := entry
+		includeOnExport := true
+		if strings.HasPrefix(entry, "[") && strings.HasSuffix(entry, "]") {
+			name = strings.TrimSpace(entry[1 : len(entry)-1])
+			includeOnExport = false
+		}
+		if name == "" {
+			return 0, fmt.Errorf("line %d: keyword name is empty", line)
+		}
+
+		var parentID *int64
+		if depth > 0 {
+			parentID = &path[depth-1].ID
+		}
+		kw, err := c.getKeywordUnder(tx, name, parentID)
+		if err != nil {
+			return 0, err
+		}
+		if kw == nil {
+			if kw, err = c.addKeyword(tx, name, parentID); err != nil {
+				return 0, fmt.Errorf("line %d: %w", line, err)
+			}
+			if !includeOnExport {
+				if err := setKeywordExportFlags(tx, kw.ID, false, kw.IncludeParents, kw.IncludeSynonyms); err != nil {
+					return 0, err
+				}
+			}
+			added++
+		}
+		path = append(path[:depth], kw)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read keyword list: %w", err)
+	}
+	for id := range synonymTargets {
+		if err := c.refreshKeywordSubtreeXMP(tx, id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return added, nil
+}
+
+// ExportKeywordList writes every keyword in the format read by
+// ImportKeywordList and Lightroom's Metadata > Import Keywords. Siblings are
+// sorted by name, and synonyms follow their keyword. The format has no
+// escapes, so a name that would read back differently, such as a keyword
+// named "[Draft]" that is included on export, is an error and nothing is
+// written.
+func (c *Catalog) ExportKeywordList(w io.Writer) error {
+	tree, err := c.KeywordTree()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	var write func(nodes []*KeywordNode, depth int) error
+	write = func(nodes []*KeywordNode, depth int) error {
+		indent := strings.Repeat("\t", depth)
+		for _, node := range nodes {
+			name := node.Keyword.Name
+			if err := checkKeywordListName(name, node.Keyword.IncludeOnExport); err != nil {
+				return err
+			}
+			if node.Keyword.IncludeOnExport {
+				fmt.Fprintf(&buf, "%s%s\n", indent, name)
+			} else {
+				fmt.Fprintf(&buf, "%s[%s]\n", indent, name)
+			}
+			for _, synonym := range node.Synonyms {
+				if strings.ContainsAny(synonym, "\r\n") {
+					return fmt.Errorf("synonym %q of keyword %q contains a line break", synonym, name)
+				}
+				fmt.Fprintf(&buf, "%s\t{%s}\n", indent, synonym)
+			}
+			if err := write(node.Children, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := write(tree, 0); err != nil {
+		return fmt.Errorf("failed to export keyword list: %w", err)
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// checkKeywordListName reports an error if a keyword name would not read
+// back unchanged from a keyword list line. plain is set for keywords written
+// without [brackets], which must not look like a bracketed or {synonym} line.
+func checkKeywordListName(name string, plain bool) error {
+	switch {
+	case strings.ContainsAny(name, "\r\n"):
+		return fmt.Errorf("keyword %q contains a line break", name)
+	case name != strings.TrimSpace(name):
+		return fmt.Errorf("keyword %q has leading or trailing whitespace", name)
+	case plain && strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]"),
+		plain && strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}"):
+		return fmt.Errorf("keyword %q would be read back as a bracketed entry", name)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package lrcat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestImportKeywordList(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	list := "\ufeffPlaces\r\n" +
+		"\tFrance\r\n" +
+		"\t\tParis\r\n" +
+		"\t\t\t{City of Light}\r\n" +
+		"\r\n" +
+		"\tParis\r\n" +
+		"[Private]\r\n" +
+		"\tFamily\r\n"
+	added, err := catalog.ImportKeywordList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("ImportKeywordList failed: %v", err)
+	}
+	if added != 6 {
+		t.Errorf("Expected 6 keywords, got %d", added)
+	}
+
+	places, _ := catalog.GetKeywordByName("Places")
+	france, _ := catalog.GetKeywordByName("France")
+	if france == nil || *france.ParentID != places.ID {
+		t.Fatalf("Expected France under Places, got %+v", france)
+	}
+	paris, _ := catalog.getKeywordUnder(catalog.db, "paris", &france.ID)
+	if paris == nil {
+		t.Fatal("Expected Paris under France")
+	}
+	synonyms, _ := catalog.GetKeywordSynonyms(paris.ID)
+	if len(synonyms) != 1 || synonyms[0] != "City of Light" {
+		t.Errorf("Expected the synonym on Places/France/Paris, got %v", synonyms)
+	}
+	if other, _ := catalog.getKeywordUnder(catalog.db, "Paris", &places.ID); other == nil || other.ID == paris.ID {
+		t.Error("Expected a separate Paris directly under Places")
+	}
+	private, _ := catalog.GetKeywordByName("Private")
+	if private.IncludeOnExport {
+		t.Error("Expected [Private] not to be included on export")
+	}
+
+	// Importing again reuses the keywords
+	added, err = catalog.ImportKeywordList(strings.NewReader(list))
+	if err != nil || added != 0 {
+		t.Errorf("Expected no new keywords, got %d (%v)", added, err)
+	}
+	if synonyms, _ := catalog.GetKeywordSynonyms(paris.ID); len(synonyms) != 1 {
+		t.Errorf("Expected synonyms not to be duplicated, got %v", synonyms)
+	}
+}
+
+func TestImportKeywordListErrors(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	for name, list := range map[string]string{
+		"skipped level":     "Places\n\t\tParis\n",
+		"top-level synonym": "{Car}\n",
+		"empty brackets":    "[]\n",
+	} {
+		if _, err := catalog.ImportKeywordList(strings.NewReader(list)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// A malformed list adds nothing
+	catalog.ImportKeywordList(strings.NewReader("Animals\n\tDogs\n\t\t\tLabrador\n"))
+	if keywords, _ := catalog.ListKeywords(); len(keywords) != 0 {
+		t.Errorf("Expected no keywords, got %d", len(keywords))
+	}
+}
+
+func TestExportKeywordList(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	paris, _ := catalog.CreateHierarchicalKeywords("Places/France/Paris")
+	catalog.CreateHierarchicalKeywords("Places/Belgium")
+	catalog.AddKeywordSynonym(paris.ID, "City of Light")
+	private, _ := catalog.AddKeyword("private", nil)
+	catalog.SetKeywordExportFlags(private.ID, false, true, true)
+	catalog.AddKeyword("Animals", nil)
+
+	var buf bytes.Buffer
+	if err := catalog.ExportKeywordList(&buf); err != nil {
+		t.Fatalf("ExportKeywordList failed: %v", err)
+	}
+	want := "Animals\n" +
+		"Places\n" +
+		"\tBelgium\n" +
+		"\tFrance\n" +
+		"\t\tParis\n" +
+		"\t\t\t{City of Light}\n" +
+		"[private]\n"
+	if buf.String() != want {
+		t.Errorf("Unexpected keyword list:\n%s", buf.String())
+	}
+
+	// The list round-trips into another catalog
+	other := createTestCatalog(t)
+	defer other.Close()
+	if _, err := other.ImportKeywordList(strings.NewReader(want)); err != nil {
+		t.Fatalf("ImportKeywordList failed: %v", err)
+	}
+	var again bytes.Buffer
+	other.ExportKeywordList(&again)
+	if again.String() != want {
+		t.Errorf("Expected the list to round-trip, got:\n%s", again.String())
+	}
+}
+
+func TestExportKeywordListBracketedNames(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	draft, _ := catalog.AddKeyword("[Draft]", nil)
+	var buf bytes.Buffer
+	if err := catalog.ExportKeywordList(&buf); err == nil {
+		t.Error("Expected a keyword named [Draft] to fail")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written, got:\n%s", buf.String())
+	}
+
+	// Not included on export, both names survive inside the brackets
+	catalog.SetKeywordExportFlags(draft.ID, false, true, true)
+	curly, _ := catalog.AddKeyword("{x}", nil)
+	catalog.SetKeywordExportFlags(curly.ID, false, true, true)
+	buf.Reset()
+	if err := catalog.ExportKeywordList(&buf); err != nil {
+		t.Fatalf("ExportKeywordList failed: %v", err)
+	}
+
+	other := createTestCatalog(t)
+	defer other.Close()
+	if _, err := other.ImportKeywordList(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("ImportKeywordList failed: %v", err)
+	}
+	for _, name := range []string{"[Draft]", "{x}"} {
+		kw, _ := other.GetKeywordByName(name)
+		if kw == nil || kw.IncludeOnExport {
+			t.Errorf("Expected %s to round-trip as a keyword not included on export, got %+v", name, kw)
+		}
+	}
+}
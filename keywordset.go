@@ -0,0 +1,209 @@
+package lrcat
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxKeywordSetSize is the number of keywords a keyword set holds
+const MaxKeywordSetSize = 9
+
+// keywordSetVariablePrefix prefixes the Adobe_variables names of keyword sets
+const keywordSetVariablePrefix = "lrcat.keywordSet."
+
+// KeywordSet is a named group of up to nine keywords for quick tagging, like
+// Lightroom's keyword sets
+type KeywordSet struct {
+	Name string
+	// Keywords are keyword paths such as "Places/France/Paris". An empty
+	// string marks an empty slot.
+	Keywords []string
+}
+
+// keywordSetValue is the stored form of a keyword set
+type keywordSetValue struct {
+	Keywords []string `json:"keywords"`
+}
+
+// Validate checks the set's name and size and trims its keyword paths
+func (s *KeywordSet) Validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("keyword set name is empty")
+	}
+	if len(s.Keywords) > MaxKeywordSetSize {
+		return fmt.Errorf("keyword set %s has %d keywords, at most %d are allowed", s.Name, len(s.Keywords), MaxKeywordSetSize)
+	}
+	for i, path := range s.Keywords {
+		s.Keywords[i] = strings.Trim(strings.TrimSpace(path), "/ ")
+	}
+	return nil
+}
+
+// CreateKeywordSet stores a new keyword set. A set with the same name is an error.
+func (c *Catalog) CreateKeywordSet(set *KeywordSet) error {
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	existing, err := c.GetKeywordSet(set.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("keyword set already exists: %s", set.Name)
+	}
+
+	value, err := json.Marshal(keywordSetValue{Keywords: set.Keywords})
+	if err != nil {
+		return err
+	}
+	if _, err := c.db.Exec(
+		`INSERT INTO Adobe_variables (id_global, name, value) VALUES (?, ?, ?)`,
+		NewUUID(), keywordSetVariablePrefix+set.Name, string(value),
+	); err != nil {
+		return fmt.Errorf("failed to create keyword set: %w", err)
+	}
+	return nil
+}
+
+// GetKeywordSet retrieves a keyword set by name, or nil if there is none
+func (c *Catalog) GetKeywordSet(name string) (*KeywordSet, error) {
+	var value string
+	err := c.db.QueryRow(
+		`SELECT value FROM Adobe_variables WHERE name = ?`,
+		keywordSetVariablePrefix+strings.TrimSpace(name),
+	).Scan(&value)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseKeywordSet(strings.TrimSpace(name), value)
+}
+
+// ListKeywordSets returns all keyword sets sorted by name
+func (c *Catalog) ListKeywordSets() ([]*KeywordSet, error) {
+	rows, err := c.db.Query(
+		`SELECT name, value FROM Adobe_variables WHERE substr(name, 1, length(?)) = ? ORDER BY name`,
+		keywordSetVariablePrefix, keywordSetVariablePrefix,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sets []*KeywordSet
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		set, err := parseKeywordSet(strings.TrimPrefix(name, keywordSetVariablePrefix), value)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
+
+// UpdateKeywordSet replaces the keyword set named name with set, which may
+// rename it
+func (c *Catalog) UpdateKeywordSet(name string, set *KeywordSet) error {
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	name = strings.TrimSpace(name)
+	if set.Name != name {
+		existing, err := c.GetKeywordSet(set.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("keyword set already exists: %s", set.Name)
+		}
+	}
+
+	value, err := json.Marshal(keywordSetValue{Keywords: set.Keywords})
+	if err != nil {
+		return err
+	}
+	result, err := c.db.Exec(
+		`UPDATE Adobe_variables SET name = ?, value = ? WHERE name = ?`,
+		keywordSetVariablePrefix+set.Name, string(value), keywordSetVariablePrefix+name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update keyword set: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("keyword set not found: %s", name)
+	}
+	return nil
+}
+
+// DeleteKeywordSet deletes a keyword set. The keywords are not touched.
+func (c *Catalog) DeleteKeywordSet(name string) error {
+	result, err := c.db.Exec(
+		`DELETE FROM Adobe_variables WHERE name = ?`,
+		keywordSetVariablePrefix+strings.TrimSpace(name),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete keyword set: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("keyword set not found: %s", name)
+	}
+	return nil
+}
+
+// ApplyKeywordSet adds the keyword in slot index (0 to 8, Lightroom's
+// Alt+1 to Alt+9) of a keyword set to each image, creating the keyword if
+// it does not exist
+func (c *Catalog) ApplyKeywordSet(imageIDs []int64, setName string, index int) error {
+	set, err := c.GetKeywordSet(setName)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		return fmt.Errorf("keyword set not found: %s", setName)
+	}
+	if index < 0 || index >= len(set.Keywords) || set.Keywords[index] == "" {
+		return fmt.Errorf("keyword set %s has no keyword at index %d", set.Name, index)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	keyword, err := c.createHierarchicalKeywords(tx, set.Keywords[index])
+	if err != nil {
+		return err
+	}
+	for _, imageID := range imageIDs {
+		var exists int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM Adobe_images WHERE id_local = ?`, imageID).Scan(&exists); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return fmt.Errorf("image not found: %d", imageID)
+		}
+		if err := c.addKeywordToImage(tx, imageID, keyword.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// parseKeywordSet decodes a stored keyword set
+func parseKeywordSet(name, value string) (*KeywordSet, error) {
+	var stored keywordSetValue
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("invalid keyword set %s: %w", name, err)
+	}
+	return &KeywordSet{Name: name, Keywords: stored.Keywords}, nil
+}
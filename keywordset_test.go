@@ -0,0 +1,101 @@
+package lrcat
+
+import "testing"
+
+func TestKeywordSets(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	set := &KeywordSet{Name: "Travel", Keywords: []string{"Places/France/Paris", "", " Food "}}
+	if err := catalog.CreateKeywordSet(set); err != nil {
+		t.Fatalf("Failed to create keyword set: %v", err)
+	}
+	if err := catalog.CreateKeywordSet(&KeywordSet{Name: "Travel"}); err == nil {
+		t.Error("Expected a duplicate name to fail")
+	}
+	if err := catalog.CreateKeywordSet(&KeywordSet{Name: "Big", Keywords: make([]string, 10)}); err == nil {
+		t.Error("Expected more than nine keywords to fail")
+	}
+	catalog.CreateKeywordSet(&KeywordSet{Name: "Family", Keywords: []string{"People/Anna"}})
+
+	got, err := catalog.GetKeywordSet("Travel")
+	if err != nil || got == nil {
+		t.Fatalf("Failed to get keyword set: %v", err)
+	}
+	if len(got.Keywords) != 3 || got.Keywords[2] != "Food" {
+		t.Errorf("Unexpected keywords: %q", got.Keywords)
+	}
+	if missing, err := catalog.GetKeywordSet("Nope"); missing != nil || err != nil {
+		t.Errorf("Expected nil for a missing set, got %v %v", missing, err)
+	}
+
+	sets, err := catalog.ListKeywordSets()
+	if err != nil {
+		t.Fatalf("Failed to list keyword sets: %v", err)
+	}
+	if len(sets) != 2 || sets[0].Name != "Family" || sets[1].Name != "Travel" {
+		t.Errorf("Expected Family and Travel, got %+v", sets)
+	}
+
+	if err := catalog.UpdateKeywordSet("Travel", &KeywordSet{Name: "Family"}); err == nil {
+		t.Error("Expected renaming onto another set to fail")
+	}
+	if err := catalog.UpdateKeywordSet("Travel", &KeywordSet{Name: "Trips", Keywords: []string{"Places/Italy"}}); err != nil {
+		t.Fatalf("Failed to update keyword set: %v", err)
+	}
+	if old, _ := catalog.GetKeywordSet("Travel"); old != nil {
+		t.Error("Expected the old name to be gone")
+	}
+	if err := catalog.UpdateKeywordSet("Nope", &KeywordSet{Name: "Nope"}); err == nil {
+		t.Error("Expected updating a missing set to fail")
+	}
+
+	if err := catalog.DeleteKeywordSet("Family"); err != nil {
+		t.Fatalf("Failed to delete keyword set: %v", err)
+	}
+	if err := catalog.DeleteKeywordSet("Family"); err == nil {
+		t.Error("Expected deleting twice to fail")
+	}
+	if sets, _ := catalog.ListKeywordSets(); len(sets) != 1 || sets[0].Name != "Trips" {
+		t.Errorf("Expected only Trips, got %+v", sets)
+	}
+}
+
+func TestApplyKeywordSet(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	a, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	b, _ := catalog.AddImage(&ImageInput{FilePath: "/photos/b.jpg"})
+	catalog.CreateKeywordSet(&KeywordSet{Name: "Travel", Keywords: []string{"Places/France/Paris", "", "/ /"}})
+
+	if err := catalog.ApplyKeywordSet([]int64{a.ID, b.ID}, "Travel", 0); err != nil {
+		t.Fatalf("Failed to apply keyword set: %v", err)
+	}
+	kw, _ := catalog.GetKeywordByPath("Places/France/Paris")
+	if kw == nil {
+		t.Fatal("Expected the keyword to be created")
+	}
+	for _, id := range []int64{a.ID, b.ID} {
+		keywords, _ := catalog.GetImageKeywords(id)
+		if len(keywords) != 1 || keywords[0].ID != kw.ID {
+			t.Errorf("Expected image %d to have Paris, got %+v", id, keywords)
+		}
+	}
+
+	if err := catalog.ApplyKeywordSet([]int64{a.ID}, "Travel", 1); err == nil {
+		t.Error("Expected an empty slot to fail")
+	}
+	if err := catalog.ApplyKeywordSet([]int64{a.ID}, "Travel", 2); err == nil {
+		t.Error("Expected a slot without keyword names to fail")
+	}
+	if err := catalog.ApplyKeywordSet([]int64{a.ID}, "Travel", 5); err == nil {
+		t.Error("Expected an index past the set to fail")
+	}
+	if err := catalog.ApplyKeywordSet([]int64{a.ID}, "Nope", 0); err == nil {
+		t.Error("Expected a missing set to fail")
+	}
+	if err := catalog.ApplyKeywordSet([]int64{a.ID, 9999}, "Travel", 0); err == nil {
+		t.Error("Expected a missing image to fail")
+	}
+}
@@ -0,0 +1,506 @@
+package lrcat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidManifest is returned by ImportManifest when rows fail validation
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// manifestListSeparator separates keywords and collections in a CSV cell
+const manifestListSeparator = ";"
+
+// manifestTimeLayouts are the accepted captureTime formats, tried in order
+var manifestTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006:01:02 15:04:05",
+	"2006-01-02",
+}
+
+// ManifestRow is one image of an import manifest
+type ManifestRow struct {
+	// Line is the line number in the manifest file
+	Line  int
+	Input ImageInput
+	// Keywords are keyword paths such as "Places/France/Paris"
+	Keywords []string
+	// Collections are collection paths such as "Clients/2024/Smith"
+	Collections []string
+	IPTC        IPTCMetadata
+}
+
+// ManifestError reports a problem with a single manifest row
+type ManifestError struct {
+	Line int
+	Path string
+	Err  error
+}
+
+// Error implements the error interface
+func (e *ManifestError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %v", e.Line, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ManifestError) Unwrap() error {
+	return e.Err
+}
+
+// ManifestSkip reports a valid row that was not imported
+type ManifestSkip struct {
+	Line   int
+	Path   string
+	Action PlanAction
+}
+
+// ManifestResult is the outcome of a manifest import
+type ManifestResult struct {
+	// Rows is the number of rows read from the manifest
+	Rows    int
+	Session *ImportSession
+	// Images are the imported images in manifest order
+	Images []*Image
+	// Skipped lists rows whose file is already cataloged
+	Skipped []*ManifestSkip
+	// Errors lists every invalid row. Nothing is imported if it is non-empty.
+	Errors []*ManifestError
+}
+
+// manifestRecord is the JSON Lines form of a manifest row. CSV columns use
+// the same names.
+type manifestRecord struct {
+	Path        string   `json:"path"`
+	CaptureTime string   `json:"captureTime"`
+	Rating      *int     `json:"rating"`
+	ColorLabel  string   `json:"colorLabel"`
+	Pick        int      `json:"pick"`
+	Keywords    []string `json:"keywords"`
+	Collections []string `json:"collections"`
+	IPTCMetadata
+}
+
+// manifestColumns sets a manifestRecord field from a CSV cell, keyed by the
+// lower-case column name
+var manifestColumns = map[string]func(r *manifestRecord, value string) error{
+	"path":        func(r *manifestRecord, v string) error { r.Path = v; return nil },
+	"capturetime": func(r *manifestRecord, v string) error { r.CaptureTime = v; return nil },
+	"rating": func(r *manifestRecord, v string) error {
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid rating %q", v)
+		}
+		r.Rating = &n
+		return nil
+	},
+	"colorlabel": func(r *manifestRecord, v string) error { r.ColorLabel = v; return nil },
+	"label":      func(r *manifestRecord, v string) error { r.ColorLabel = v; return nil },
+	"pick": func(r *manifestRecord, v string) error {
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid pick %q", v)
+		}
+		r.Pick = n
+		return nil
+	},
+	"keywords":       func(r *manifestRecord, v string) error { r.Keywords = splitManifestList(v); return nil },
+	"collections":    func(r *manifestRecord, v string) error { r.Collections = splitManifestList(v); return nil },
+	"caption":        func(r *manifestRecord, v string) error { r.Caption = v; return nil },
+	"copyright":      func(r *manifestRecord, v string) error { r.Copyright = v; return nil },
+	"creator":        func(r *manifestRecord, v string) error { r.Creator = v; return nil },
+	"jobidentifier":  func(r *manifestRecord, v string) error { r.JobIdentifier = v; return nil },
+	"location":       func(r *manifestRecord, v string) error { r.Location = v; return nil },
+	"city":           func(r *manifestRecord, v string) error { r.City = v; return nil },
+	"state":          func(r *manifestRecord, v string) error { r.State = v; return nil },
+	"country":        func(r *manifestRecord, v string) error { r.Country = v; return nil },
+	"isocountrycode": func(r *manifestRecord, v string) error { r.ISOCountryCode = v; return nil },
+}
+
+// LoadManifest reads a .csv, .jsonl or .ndjson manifest. Relative paths are
+// resolved against the manifest's directory. Rows that cannot be parsed are
+// returned as ManifestErrors; the error is reserved for unreadable files.
+func LoadManifest(path string) ([]*ManifestRow, []*ManifestError, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer f.Close()
+
+	rows, rowErrs, err := ParseManifest(f, strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load manifest %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for _, row := range rows {
+		if !filepath.IsAbs(row.Input.FilePath) {
+			row.Input.FilePath = filepath.Join(dir, row.Input.FilePath)
+		}
+	}
+	return rows, rowErrs, nil
+}
+
+// ParseManifest parses a manifest. format is "csv", "jsonl" or "ndjson".
+// CSV manifests need a header row naming the columns (path, captureTime,
+// rating, colorLabel, pick, keywords, collections and the IPTCMetadata JSON
+// names); keywords and collections cells hold ";"-separated paths.
+func ParseManifest(r io.Reader, format string) ([]*ManifestRow, []*ManifestError, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return parseCSVManifest(r)
+	case "jsonl", "ndjson":
+		return parseJSONLManifest(r)
+	default:
+		return nil, nil, fmt.Errorf("unsupported manifest format: %q", format)
+	}
+}
+
+// parseCSVManifest parses a CSV manifest with a header row
+func parseCSVManifest(r io.Reader) ([]*ManifestRow, []*ManifestError, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	setters := make([]func(*manifestRecord, string) error, len(header))
+	hasPath := false
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		setter, ok := manifestColumns[key]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown manifest column %q", name)
+		}
+		setters[i] = setter
+		hasPath = hasPath || key == "path"
+	}
+	if !hasPath {
+		return nil, nil, fmt.Errorf("manifest has no path column")
+	}
+
+	var rows []*ManifestRow
+	var rowErrs []*ManifestError
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrs = append(rowErrs, &ManifestError{Line: parseErr.StartLine, Err: parseErr.Err})
+				continue
+			}
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		rec := &manifestRecord{}
+		var fieldErr error
+		for i, value := range record {
+			if err := setters[i](rec, strings.TrimSpace(value)); err != nil && fieldErr == nil {
+				fieldErr = err
+			}
+		}
+		row, err := rec.toRow(line)
+		if fieldErr != nil {
+			err = fieldErr
+		}
+		if err != nil {
+			rowErrs = append(rowErrs, &ManifestError{Line: line, Path: rec.Path, Err: err})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrs, nil
+}
+
+// parseJSONLManifest parses a manifest with one JSON object per line
+func parseJSONLManifest(r io.Reader) ([]*ManifestRow, []*ManifestError, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var rows []*ManifestRow
+	var rowErrs []*ManifestError
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		rec := &manifestRecord{}
+		if err := dec.Decode(rec); err != nil {
+			rowErrs = append(rowErrs, &ManifestError{Line: line, Path: rec.Path, Err: err})
+			continue
+		}
+		row, err := rec.toRow(line)
+		if err != nil {
+			rowErrs = append(rowErrs, &ManifestError{Line: line, Path: rec.Path, Err: err})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return rows, rowErrs, nil
+}
+
+// toRow validates the record and converts it into a ManifestRow
+func (r *manifestRecord) toRow(line int) (*ManifestRow, error) {
+	if r.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	row := &ManifestRow{
+		Line:        line,
+		Input:       ImageInput{FilePath: r.Path, Rating: r.Rating, ColorLabel: r.ColorLabel, Pick: r.Pick},
+		Keywords:    r.Keywords,
+		Collections: r.Collections,
+		IPTC:        r.IPTCMetadata,
+	}
+
+	if r.CaptureTime != "" {
+		t, err := parseManifestTime(r.CaptureTime)
+		if err != nil {
+			return nil, err
+		}
+		row.Input.CaptureTime = t
+	}
+	if err := row.Validate(); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// Validate checks the row for values the catalog cannot store. Whether the
+// file exists and can be imported is checked by ImportManifestRows.
+func (r *ManifestRow) Validate() error {
+	if r.Input.FilePath == "" {
+		return fmt.Errorf("path is required")
+	}
+	if r.Input.Rating != nil && (*r.Input.Rating < 0 || *r.Input.Rating > 5) {
+		return fmt.Errorf("rating must be between 0 and 5, got %d", *r.Input.Rating)
+	}
+	if r.Input.Pick < -1 || r.Input.Pick > 1 {
+		return fmt.Errorf("pick must be -1, 0 or 1, got %d", r.Input.Pick)
+	}
+	for _, path := range r.Keywords {
+		if strings.Trim(path, "/ ") == "" {
+			return fmt.Errorf("empty keyword path")
+		}
+	}
+	for _, path := range r.Collections {
+		if strings.Trim(path, "/ ") == "" {
+			return fmt.Errorf("empty collection path")
+		}
+	}
+	return nil
+}
+
+// ImportManifest loads a manifest and imports it with ImportManifestRows.
+// Rows that cannot be parsed are reported like any other invalid row.
+func (c *Catalog) ImportManifest(path string, opts *ImportOptions) (*ManifestResult, error) {
+	rows, rowErrs, err := LoadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	return c.importManifestRows(rows, rowErrs, opts)
+}
+
+// ImportManifestRows validates every row and then imports all of them in a
+// single transaction, applying each row's keywords, collections and IPTC
+// metadata on top of any preset in opts. If any row is invalid nothing is
+// written and the returned result lists the errors alongside
+// ErrInvalidManifest. Rows whose file is already cataloged are skipped.
+func (c *Catalog) ImportManifestRows(rows []*ManifestRow, opts *ImportOptions) (*ManifestResult, error) {
+	return c.importManifestRows(rows, nil, opts)
+}
+
+// importManifestRows imports rows, treating rowErrs from parsing as validation failures
+func (c *Catalog) importManifestRows(rows []*ManifestRow, rowErrs []*ManifestError, opts *ImportOptions) (*ManifestResult, error) {
+	result := &ManifestResult{Rows: len(rows) + len(rowErrs), Errors: rowErrs}
+	if result.Rows == 0 {
+		return nil, fmt.Errorf("manifest has no rows")
+	}
+
+	planOpts := &ImportOptions{}
+	if opts != nil {
+		*planOpts = *opts
+		planOpts.Plan = nil
+	}
+
+	firstLine := map[string]int{}
+	inputs := make([]*ImageInput, len(rows))
+	for i, row := range rows {
+		if err := row.Validate(); err != nil {
+			result.Errors = append(result.Errors, &ManifestError{Line: row.Line, Path: row.Input.FilePath, Err: err})
+		}
+		path := normalizePath(row.Input.FilePath)
+		if line, ok := firstLine[path]; ok {
+			result.Errors = append(result.Errors, &ManifestError{
+				Line: row.Line, Path: row.Input.FilePath, Err: fmt.Errorf("duplicate of line %d", line),
+			})
+		} else {
+			firstLine[path] = row.Line
+		}
+		input := row.Input
+		inputs[i] = &input
+	}
+
+	var plan *ImportPlan
+	if len(rows) > 0 {
+		var err error
+		if plan, err = c.PlanImport(inputs, planOpts); err != nil {
+			return nil, err
+		}
+		for i, f := range plan.Files {
+			switch f.Action {
+			case PlanError:
+				result.Errors = append(result.Errors, &ManifestError{Line: rows[i].Line, Path: f.Source, Err: f.Err})
+			case PlanAdd:
+			default:
+				result.Skipped = append(result.Skipped, &ManifestSkip{Line: rows[i].Line, Path: f.Source, Action: f.Action})
+			}
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Line < result.Errors[j].Line })
+		return result, fmt.Errorf("%w: %d of %d rows have errors", ErrInvalidManifest, len(result.Errors), result.Rows)
+	}
+
+	items, err := c.planItems(plan, inputs)
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		items[i].metadata = &itemMetadata{
+			keywords:    row.Keywords,
+			collections: row.Collections,
+			iptc:        mergeIPTC(planOpts.Preset, &row.IPTC),
+		}
+	}
+
+	result.Session, result.Images, err = c.importItems(items, &plan.opts)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// itemMetadata is per-file metadata applied during an import
+type itemMetadata struct {
+	keywords    []string
+	collections []string
+	iptc        *IPTCMetadata
+}
+
+// applyItemMetadata assigns keywords, collections and IPTC metadata to an image
+func (c *Catalog) applyItemMetadata(db dbExecutor, image *Image, m *itemMetadata) error {
+	for _, path := range m.keywords {
+		keyword, err := c.createHierarchicalKeywords(db, path)
+		if err != nil {
+			return fmt.Errorf("failed to create keyword %s: %w", path, err)
+		}
+		if err := c.addKeywordToImage(db, image.ID, keyword.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range m.collections {
+		collection, err := c.getOrCreateCollectionPath(db, path)
+		if err != nil {
+			return fmt.Errorf("failed to create collection %s: %w", path, err)
+		}
+		if err := c.addImageToCollection(db, image.ID, collection.ID); err != nil {
+			return err
+		}
+	}
+
+	if !m.iptc.IsEmpty() {
+		return c.setIPTC(db, image.ID, m.iptc)
+	}
+	return nil
+}
+
+// mergeIPTC returns the preset's IPTC metadata overridden by the non-empty
+// fields of row, or nil if row is empty so the preset's metadata stays as is
+func mergeIPTC(preset *ImportPreset, row *IPTCMetadata) *IPTCMetadata {
+	if row.IsEmpty() {
+		return nil
+	}
+	merged := IPTCMetadata{}
+	if preset != nil && preset.IPTC != nil {
+		merged = *preset.IPTC
+	}
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&merged.Caption, row.Caption},
+		{&merged.Copyright, row.Copyright},
+		{&merged.Creator, row.Creator},
+		{&merged.JobIdentifier, row.JobIdentifier},
+		{&merged.Location, row.Location},
+		{&merged.City, row.City},
+		{&merged.State, row.State},
+		{&merged.Country, row.Country},
+		{&merged.ISOCountryCode, row.ISOCountryCode},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	return &merged
+}
+
+// parseManifestTime parses a captureTime value in one of manifestTimeLayouts
+func parseManifestTime(value string) (time.Time, error) {
+	for _, layout := range manifestTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid captureTime %q", value)
+}
+
+// splitManifestList splits a CSV cell into its non-empty, trimmed parts
+func splitManifestList(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, manifestListSeparator) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,172 @@
+package lrcat
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseManifestCSV(t *testing.T) {
+	data := `path,captureTime,rating,label,keywords,collections,caption,city
+a.jpg,2024-06-15 14:30:00,4,Red,Places/France/Paris; Events/Wedding,Clients/Smith,"First dance, evening",Paris
+b.jpg,,,,,,,
+c.jpg,yesterday,,,,,,
+d.jpg,,9,,,,,
+,,,,,,,
+e.jpg,,x,,,,,
+`
+	rows, rowErrs, err := ParseManifest(strings.NewReader(data), "csv")
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 valid rows, got %d", len(rows))
+	}
+
+	row := rows[0]
+	if row.Line != 2 || row.Input.FilePath != "a.jpg" || *row.Input.Rating != 4 || row.Input.ColorLabel != "Red" {
+		t.Errorf("Unexpected first row: %+v", row)
+	}
+	if !row.Input.CaptureTime.Equal(time.Date(2024, 6, 15, 14, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected capture time: %v", row.Input.CaptureTime)
+	}
+	if len(row.Keywords) != 2 || row.Keywords[1] != "Events/Wedding" {
+		t.Errorf("Unexpected keywords: %v", row.Keywords)
+	}
+	if len(row.Collections) != 1 || row.IPTC.Caption != "First dance, evening" || row.IPTC.City != "Paris" {
+		t.Errorf("Unexpected collections or IPTC: %v %+v", row.Collections, row.IPTC)
+	}
+	if rows[1].Input.Rating != nil {
+		t.Error("Expected an empty rating cell to leave the rating unset")
+	}
+
+	wantLines := []int{4, 5, 6, 7}
+	if len(rowErrs) != len(wantLines) {
+		t.Fatalf("Expected %d row errors, got %v", len(wantLines), rowErrs)
+	}
+	for i, e := range rowErrs {
+		if e.Line != wantLines[i] {
+			t.Errorf("Expected error on line %d, got %v", wantLines[i], e)
+		}
+	}
+
+	if _, _, err := ParseManifest(strings.NewReader("path,shutter\na.jpg,1/250\n"), "csv"); err == nil {
+		t.Error("Expected an error for an unknown column")
+	}
+	if _, _, err := ParseManifest(strings.NewReader("rating\n3\n"), "csv"); err == nil {
+		t.Error("Expected an error for a missing path column")
+	}
+}
+
+func TestParseManifestJSONL(t *testing.T) {
+	data := `{"path": "a.jpg", "rating": 2, "keywords": ["People/Clients"], "creator": "Jane Doe"}
+
+{"path": "b.jpg", "exposure": 1}
+{"path": "c.jpg", "pick": 1, "captureTime": "2024-06-15T14:30:00Z"}
+`
+	rows, rowErrs, err := ParseManifest(strings.NewReader(data), "jsonl")
+	if err != nil {
+		t.Fatalf("ParseManifest failed: %v", err)
+	}
+	if len(rows) != 2 || rows[0].IPTC.Creator != "Jane Doe" || rows[1].Line != 4 || rows[1].Input.Pick != 1 {
+		t.Errorf("Unexpected rows: %+v %+v", rows[0], rows[1])
+	}
+	if len(rowErrs) != 1 || rowErrs[0].Line != 3 {
+		t.Errorf("Expected an unknown field error on line 3, got %v", rowErrs)
+	}
+}
+
+func TestImportManifest(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "photos/a.jpg", []byte("a"))
+	writeTestFile(t, dir, "photos/b.jpg", []byte("b"))
+	manifest := writeTestFile(t, dir, "manifest.csv", []byte(
+		"path,rating,keywords,collections,caption\n"+
+			"photos/a.jpg,5,Places/Paris;People/Clients,Clients/Smith;Portfolio,Eiffel Tower\n"+
+			"photos/b.jpg,,Places/Paris,,\n",
+	))
+
+	creator := &ImportPreset{IPTC: &IPTCMetadata{Creator: "Jane Doe", Caption: "Default"}}
+	result, err := catalog.ImportManifest(manifest, &ImportOptions{SessionName: "DAM", Preset: creator})
+	if err != nil {
+		t.Fatalf("ImportManifest failed: %v", err)
+	}
+	if result.Rows != 2 || len(result.Images) != 2 || result.Session.Name != "DAM" {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	a := result.Images[0]
+	if a.Rating == nil || *a.Rating != 5 {
+		t.Errorf("Expected rating 5, got %v", a.Rating)
+	}
+	keywords, _ := catalog.GetImageKeywords(a.ID)
+	if len(keywords) != 2 {
+		t.Errorf("Expected 2 keywords, got %d", len(keywords))
+	}
+	collections, _ := catalog.GetImageCollections(a.ID)
+	if len(collections) != 2 {
+		t.Errorf("Expected 2 collections, got %v", collections)
+	}
+	iptc, _ := catalog.GetIPTC(a.ID)
+	if iptc.Caption != "Eiffel Tower" || iptc.Creator != "Jane Doe" {
+		t.Errorf("Expected row caption over preset creator, got %+v", iptc)
+	}
+	iptc, _ = catalog.GetIPTC(result.Images[1].ID)
+	if iptc.Caption != "Default" {
+		t.Errorf("Expected the preset caption for a row without one, got %+v", iptc)
+	}
+
+	// Importing again skips the cataloged files
+	result, err = catalog.ImportManifest(manifest, nil)
+	if err != nil {
+		t.Fatalf("Second ImportManifest failed: %v", err)
+	}
+	if len(result.Images) != 0 || len(result.Skipped) != 2 || result.Skipped[0].Action != PlanSkipCataloged {
+		t.Errorf("Expected both rows to be skipped, got %+v", result)
+	}
+}
+
+func TestImportManifestValidation(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.jpg", []byte("a"))
+	writeTestFile(t, dir, "notes.txt", []byte("notes"))
+	manifest := writeTestFile(t, dir, "manifest.jsonl", []byte(
+		`{"path": "a.jpg", "keywords": ["Places/Paris"]}`+"\n"+
+			`{"path": "missing.jpg"}`+"\n"+
+			`{"path": "notes.txt"}`+"\n"+
+			`{"path": "a.jpg"}`+"\n"+
+			`{"path": "a.jpg", "rating": 7}`+"\n",
+	))
+
+	result, err := catalog.ImportManifest(manifest, nil)
+	if !errors.Is(err, ErrInvalidManifest) {
+		t.Fatalf("Expected ErrInvalidManifest, got %v", err)
+	}
+	wantLines := []int{2, 3, 4, 5}
+	if len(result.Errors) != len(wantLines) {
+		t.Fatalf("Expected %d row errors, got %v", len(wantLines), result.Errors)
+	}
+	for i, e := range result.Errors {
+		if e.Line != wantLines[i] {
+			t.Errorf("Expected error on line %d, got %v", wantLines[i], e)
+		}
+	}
+	if filepath.Base(result.Errors[0].Path) != "missing.jpg" {
+		t.Errorf("Expected the row path in the error, got %q", result.Errors[0].Path)
+	}
+
+	// Nothing was written
+	images, _ := catalog.ListImages()
+	keyword, _ := catalog.GetKeywordByName("Paris")
+	if len(images) != 0 || keyword != nil {
+		t.Errorf("Expected no changes, got %d images and keyword %v", len(images), keyword)
+	}
+}
@@ -0,0 +1,212 @@
+package lrcat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathMapping rewrites paths stored in the catalog to paths on this machine,
+// e.g. CatalogPrefix "D:/Photos/" to LocalPrefix "/mnt/photos/" when a
+// catalog written on Windows is used on Linux
+type PathMapping struct {
+	CatalogPrefix string
+	LocalPrefix   string
+}
+
+// SetPathMappings replaces the path mappings. Paths read from the catalog
+// are translated with the longest matching CatalogPrefix; paths passed in,
+// for example to AddImage or ImageExists, with the longest matching
+// LocalPrefix. Paths that match no mapping are used as they are.
+func (c *Catalog) SetPathMappings(mappings ...PathMapping) error {
+	normalized := make([]PathMapping, 0, len(mappings))
+	for _, m := range mappings {
+		normalized = append(normalized, PathMapping{
+			CatalogPrefix: folderPath(m.CatalogPrefix),
+			LocalPrefix:   folderPath(m.LocalPrefix),
+		})
+	}
+
+	c.rootMu.Lock()
+	c.pathMappings = normalized
+	c.rootMu.Unlock()
+	return c.invalidateRootIndex()
+}
+
+// PathMappings returns the mappings set by SetPathMappings
+func (c *Catalog) PathMappings() []PathMapping {
+	c.rootMu.Lock()
+	defer c.rootMu.Unlock()
+	return append([]PathMapping(nil), c.pathMappings...)
+}
+
+// localPath translates a path stored in the catalog to this machine
+func (c *Catalog) localPath(catalogPath string) string {
+	c.rootMu.Lock()
+	defer c.rootMu.Unlock()
+	return mapPathPrefix(catalogPath, c.pathMappings, c.rootMappings, false)
+}
+
+// catalogPath translates a path on this machine to the form stored in the catalog
+func (c *Catalog) catalogPath(localPath string) string {
+	localPath = normalizePath(localPath)
+	c.rootMu.Lock()
+	defer c.rootMu.Unlock()
+	return mapPathPrefix(localPath, c.pathMappings, c.rootMappings, true)
+}
+
+// mapPathPrefix replaces the longest matching prefix of path, preferring
+// explicit mappings over those discovered through relativePathFromCatalog
+func mapPathPrefix(path string, explicit, discovered []PathMapping, toCatalog bool) string {
+	for _, mappings := range [][]PathMapping{explicit, discovered} {
+		var best *PathMapping
+		bestLen := 0
+		for i := range mappings {
+			from := mappings[i].CatalogPrefix
+			if toCatalog {
+				from = mappings[i].LocalPrefix
+			}
+			if (strings.HasPrefix(path, from) || path+"/" == from) && len(from) > bestLen {
+				best, bestLen = &mappings[i], len(from)
+			}
+		}
+		if best == nil {
+			continue
+		}
+		from, to := best.CatalogPrefix, best.LocalPrefix
+		if toCatalog {
+			from, to = to, from
+		}
+		if path+"/" == from {
+			return strings.TrimSuffix(to, "/")
+		}
+		return to + strings.TrimPrefix(path, from)
+	}
+	return path
+}
+
+// resolveRootPath returns the local path of a root folder. If no mapping
+// applies and the stored path does not exist, the root is looked up next to
+// the catalog through relativePathFromCatalog, and the mapping found is
+// remembered for the files below it.
+func (c *Catalog) resolveRootPath(catalogPath, relativePath string) string {
+	local := c.localPath(catalogPath)
+	if local != catalogPath {
+		return local
+	}
+	m, ok := c.discoverRootMapping(catalogPath, relativePath)
+	if !ok {
+		return local
+	}
+	c.rootMu.Lock()
+	c.addRootMapping(m)
+	c.rootMu.Unlock()
+	return m.LocalPrefix
+}
+
+// resolveRootMappings looks up every root folder next to the catalog, so
+// that paths below a moved root translate in both directions before anything
+// else has read that root. It reads through c.db and must not be called
+// while a transaction is open.
+func (c *Catalog) resolveRootMappings() error {
+	c.rootMu.Lock()
+	explicit := c.pathMappings
+	c.rootMu.Unlock()
+	if c.path == "" {
+		return nil
+	}
+
+	rows, err := c.db.Query(`SELECT absolutePath, COALESCE(relativePathFromCatalog, '') FROM AgLibraryRootFolder`)
+	if err != nil {
+		return fmt.Errorf("failed to query root folders: %w", err)
+	}
+	defer rows.Close()
+
+	var found []PathMapping
+	for rows.Next() {
+		var absolutePath, relativePath string
+		if err := rows.Scan(&absolutePath, &relativePath); err != nil {
+			return fmt.Errorf("failed to scan root folder: %w", err)
+		}
+		if mapPathPrefix(absolutePath, explicit, nil, false) != absolutePath {
+			continue
+		}
+		if m, ok := c.discoverRootMapping(absolutePath, relativePath); ok {
+			found = append(found, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read root folders: %w", err)
+	}
+
+	c.rootMu.Lock()
+	defer c.rootMu.Unlock()
+	for _, m := range found {
+		c.addRootMapping(m)
+	}
+	return nil
+}
+
+// discoverRootMapping finds a root folder whose stored path does not exist
+// at relativePath from the catalog's directory
+func (c *Catalog) discoverRootMapping(catalogPath, relativePath string) (PathMapping, bool) {
+	if relativePath == "" || c.path == "" {
+		return PathMapping{}, false
+	}
+	if _, err := os.Stat(catalogPath); err == nil {
+		return PathMapping{}, false
+	}
+
+	candidate := folderPath(filepath.Join(filepath.Dir(c.path), filepath.FromSlash(relativePath)))
+	if candidate == catalogPath {
+		return PathMapping{}, false
+	}
+	if info, err := os.Stat(candidate); err != nil || !info.IsDir() {
+		return PathMapping{}, false
+	}
+	return PathMapping{CatalogPrefix: catalogPath, LocalPrefix: candidate}, true
+}
+
+// addRootMapping records a discovered mapping unless it is already known.
+// The caller must hold rootMu.
+func (c *Catalog) addRootMapping(m PathMapping) {
+	for _, existing := range c.rootMappings {
+		if existing == m {
+			return
+		}
+	}
+	c.rootMappings = append(c.rootMappings, m)
+}
+
+// relativePathFromCatalog returns the path of a root folder relative to the
+// catalog's directory, or "" if the root is on another volume
+func (c *Catalog) relativePathFromCatalog(absolutePath string) string {
+	if c.path == "" {
+		return ""
+	}
+	catalogDir, err := filepath.Abs(filepath.Dir(c.path))
+	if err != nil {
+		return ""
+	}
+	catalogDir = folderPath(catalogDir)
+	absolutePath = folderPath(absolutePath)
+	if volumeRoot(catalogDir) != volumeRoot(absolutePath) {
+		return ""
+	}
+
+	rel, err := filepath.Rel(filepath.FromSlash(catalogDir), filepath.FromSlash(absolutePath))
+	if err != nil {
+		return ""
+	}
+	return folderPath(rel)
+}
+
+// folderPath normalizes a directory path to forward slashes with a trailing "/"
+func folderPath(path string) string {
+	path = normalizePath(path)
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path
+}
@@ -0,0 +1,226 @@
+package lrcat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPathMappings(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	// Written on a Windows workstation
+	root, err := catalog.AddRootFolder("D:/Photos")
+	if err != nil {
+		t.Fatalf("Failed to add root folder: %v", err)
+	}
+	image, err := catalog.AddImage(&ImageInput{FilePath: "D:/Photos/2024/a.jpg"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+
+	// Used on a Linux box
+	local := normalizePath(t.TempDir()) + "/photos"
+	writeTestFile(t, local, "2024/b.jpg", []byte("b"))
+	if err := catalog.SetPathMappings(PathMapping{CatalogPrefix: "D:/Photos", LocalPrefix: local}); err != nil {
+		t.Fatalf("Failed to set path mappings: %v", err)
+	}
+
+	path, err := catalog.GetImagePath(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get image path: %v", err)
+	}
+	if path != local+"/2024/a.jpg" {
+		t.Errorf("Expected mapped path, got %s", path)
+	}
+	if exists, _ := catalog.ImageExists(local + "/2024/a.jpg"); !exists {
+		t.Error("Expected ImageExists to find the mapped path")
+	}
+
+	rf, err := catalog.GetRootFolderByPath(local)
+	if err != nil || rf == nil || rf.ID != root.ID {
+		t.Fatalf("Expected to find the root by its local path, got %v %v", rf, err)
+	}
+	if rf.AbsolutePath != local+"/" || rf.CatalogPath != "D:/Photos/" {
+		t.Errorf("Unexpected root paths: %s %s", rf.AbsolutePath, rf.CatalogPath)
+	}
+
+	// New images below the mapped root are stored in catalog form
+	b, err := catalog.AddImage(&ImageInput{FilePath: local + "/2024/b.jpg"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	roots, _ := catalog.ListRootFolders()
+	if len(roots) != 1 {
+		t.Errorf("Expected the mapped root to be reused, got %d roots", len(roots))
+	}
+	var stored string
+	catalog.DB().QueryRow(
+		`SELECT rf.absolutePath || fo.pathFromRoot || f.baseName || '.' || f.extension
+		 FROM Adobe_images i
+		 JOIN AgLibraryFile f ON i.rootFile = f.id_local
+		 JOIN AgLibraryFolder fo ON f.folder = fo.id_local
+		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+		 WHERE i.id_local = ?`, b.ID,
+	).Scan(&stored)
+	if stored != "D:/Photos/2024/b.jpg" {
+		t.Errorf("Expected the catalog path to be stored, got %s", stored)
+	}
+
+	// Synchronizing works on local paths
+	result, err := catalog.SyncFolderPath(local+"/2024", &SyncOptions{Missing: MissingFileIgnore})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Added) != 0 || len(result.Missing) != 1 {
+		t.Errorf("Expected only a.jpg to be missing, got %+v", result)
+	}
+}
+
+func TestRelativePathFromCatalog(t *testing.T) {
+	base := t.TempDir()
+	photo := writeTestFile(t, base, "shoot/photos/a.jpg", []byte("a"))
+
+	catalogPath := filepath.Join(base, "shoot", "catalog", "shoot.lrcat")
+	catalog, err := NewCatalog(catalogPath)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	image, err := catalog.AddImage(&ImageInput{FilePath: photo})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	roots, _ := catalog.ListRootFolders()
+	if len(roots) != 1 || roots[0].RelativePathFromCatalog != "../photos/" {
+		t.Fatalf("Expected relativePathFromCatalog ../photos/, got %+v", roots)
+	}
+	catalog.Close()
+
+	// Move the catalog together with its photos
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err := os.Rename(filepath.Join(base, "shoot"), moved); err != nil {
+		t.Fatalf("Failed to move shoot: %v", err)
+	}
+	catalog, err = OpenCatalog(filepath.Join(moved, "catalog", "shoot.lrcat"), nil)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	want := normalizePath(filepath.Join(moved, "photos", "a.jpg"))
+	path, err := catalog.GetImagePath(image.ID)
+	if err != nil || path != want {
+		t.Errorf("Expected %s, got %s (%v)", want, path, err)
+	}
+	if exists, _ := catalog.ImageExists(want); !exists {
+		t.Error("Expected ImageExists to find the moved file")
+	}
+	roots, _ = catalog.ListRootFolders()
+	if roots[0].AbsolutePath != normalizePath(filepath.Join(moved, "photos"))+"/" {
+		t.Errorf("Unexpected root path after move: %s", roots[0].AbsolutePath)
+	}
+}
+
+func TestImageExistsAfterMovingCatalog(t *testing.T) {
+	base := t.TempDir()
+	photo := writeTestFile(t, base, "shoot/photos/a.jpg", []byte("a"))
+
+	catalogPath := filepath.Join(base, "shoot", "catalog", "shoot.lrcat")
+	catalog, err := NewCatalog(catalogPath)
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	if _, err := catalog.AddImage(&ImageInput{FilePath: photo}); err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	catalog.Close()
+
+	moved := filepath.Join(t.TempDir(), "moved")
+	if err := os.Rename(filepath.Join(base, "shoot"), moved); err != nil {
+		t.Fatalf("Failed to move shoot: %v", err)
+	}
+	catalog, err = OpenCatalog(filepath.Join(moved, "catalog", "shoot.lrcat"), nil)
+	if err != nil {
+		t.Fatalf("Failed to open catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	// No other call has read the root folder yet
+	path := filepath.Join(moved, "photos", "a.jpg")
+	if exists, err := catalog.ImageExists(path); err != nil || !exists {
+		t.Errorf("Expected ImageExists to find %s right after opening, got %v %v", path, exists, err)
+	}
+	if cataloged, err := catalog.fileInCatalog(catalog.db, path); err != nil || !cataloged {
+		t.Errorf("Expected the file to be found in the catalog, got %v %v", cataloged, err)
+	}
+}
+
+func TestAddImageWithSingleConnection(t *testing.T) {
+	base := t.TempDir()
+	photo := writeTestFile(t, base, "photos/a.jpg", []byte("a"))
+
+	catalog, err := NewCatalog(filepath.Join(base, "catalog", "test.lrcat"))
+	if err != nil {
+		t.Fatalf("Failed to create catalog: %v", err)
+	}
+	defer catalog.Close()
+	catalog.DB().SetMaxOpenConns(1)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := catalog.AddImage(&ImageInput{FilePath: photo})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to add image: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("AddImage did not return with a single database connection")
+	}
+}
+
+func TestRelocateRootFolder(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, _ := catalog.AddImage(&ImageInput{FilePath: "/old/photos/2024/a.jpg"})
+	other, _ := catalog.AddRootFolder("/other")
+	roots, _ := catalog.ListRootFolders()
+	var root *RootFolder
+	for _, rf := range roots {
+		if rf.ID != other.ID {
+			root = rf
+		}
+	}
+
+	if _, err := catalog.RelocateRootFolder(root.ID, "/other"); err == nil {
+		t.Error("Expected relocating onto another root to fail")
+	}
+
+	relocated, err := catalog.RelocateRootFolder(root.ID, "/new/pictures")
+	if err != nil {
+		t.Fatalf("Failed to relocate root folder: %v", err)
+	}
+	if relocated.AbsolutePath != "/new/pictures/" || relocated.Name != "pictures" {
+		t.Errorf("Unexpected relocated root: %+v", relocated)
+	}
+	path, _ := catalog.GetImagePath(image.ID)
+	if path != "/new/pictures/a.jpg" {
+		t.Errorf("Expected image under the new location, got %s", path)
+	}
+
+	// The cached root index follows the relocation
+	next, err := catalog.AddImage(&ImageInput{FilePath: "/new/pictures/b.jpg"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	file, _ := catalog.GetImageFile(next.ID)
+	folder, _ := catalog.GetFolder(file.FolderID)
+	if folder.RootFolderID != root.ID {
+		t.Errorf("Expected the relocated root to be used, got root %d", folder.RootFolderID)
+	}
+}
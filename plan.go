@@ -0,0 +1,281 @@
+package lrcat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PlanAction is what an import plan does with a single file
+type PlanAction int
+
+const (
+	// PlanAdd imports the file
+	PlanAdd PlanAction = iota
+	// PlanSkipCollision skips a file whose destination exists under CollisionSkip
+	PlanSkipCollision
+	// PlanSkipCataloged skips a file the catalog already references
+	PlanSkipCataloged
+	// PlanSkipDuplicate skips a file listed more than once in the same import
+	PlanSkipDuplicate
+	// PlanError marks a file that cannot be imported; see PlannedFile.Err
+	PlanError
+)
+
+// String returns a short description of the action
+func (a PlanAction) String() string {
+	switch a {
+	case PlanAdd:
+		return "add"
+	case PlanSkipCollision:
+		return "skip (destination exists)"
+	case PlanSkipCataloged:
+		return "skip (already cataloged)"
+	case PlanSkipDuplicate:
+		return "skip (duplicate)"
+	case PlanError:
+		return "error"
+	default:
+		return fmt.Sprintf("PlanAction(%d)", int(a))
+	}
+}
+
+// PlannedFile describes what an import will do with one input
+type PlannedFile struct {
+	// Source is the input file path
+	Source string
+	// Destination is the path the catalog will reference. It equals Source
+	// for ImportModeAdd and is the copy or move target otherwise.
+	Destination      string
+	OriginalFilename string
+	Action           PlanAction
+	// FileFormat and Raw are the Lightroom fileFormat and isRawFile values
+	FileFormat string
+	Raw        bool
+	// Mismatch is set when DetectContent found content disagreeing with the extension
+	Mismatch *FormatMismatch
+	// Err explains a PlanError
+	Err error
+
+	input *ImageInput
+}
+
+// ImportPlan is a dry run of an import. Pass it as ImportOptions.Plan to
+// AddImagesWithOptions to carry out exactly the planned work.
+type ImportPlan struct {
+	Files []*PlannedFile
+	// RootFolders are the absolute paths of root folders the import would create
+	RootFolders []string
+	// Folders are the absolute paths of folders the import would create,
+	// including the top folder of every new root
+	Folders []string
+	// Errors collects the errors of all PlanError files
+	Errors []error
+
+	catalog *Catalog
+	inputs  []*ImageInput
+	opts    ImportOptions
+}
+
+// Count returns the number of files planned with action
+func (p *ImportPlan) Count(action PlanAction) int {
+	n := 0
+	for _, f := range p.Files {
+		if f.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns an error summarizing the plan's validation errors, or nil
+func (p *ImportPlan) Err() error {
+	switch len(p.Errors) {
+	case 0:
+		return nil
+	case 1:
+		return p.Errors[0]
+	default:
+		return fmt.Errorf("%v (and %d more errors)", p.Errors[0], len(p.Errors)-1)
+	}
+}
+
+// PlanImport works out what AddImagesWithOptions would do with inputs and
+// opts without touching the catalog or the filesystem. Files that cannot be
+// imported are reported in the plan rather than as an error; an error is
+// returned only for invalid options.
+//
+// Unlike an unplanned import, executing a plan also skips files listed more
+// than once and, in add mode, files the catalog already references.
+func (c *Catalog) PlanImport(inputs []*ImageInput, opts *ImportOptions) (*ImportPlan, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no images to add")
+	}
+	plan := &ImportPlan{catalog: c, inputs: inputs}
+	if opts != nil {
+		plan.opts = *opts
+		plan.opts.Plan = nil
+	}
+
+	items, err := resolveImportItems(inputs, &plan.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, item := range items {
+		f := &PlannedFile{
+			Source:           item.sourcePath,
+			Destination:      item.destPath,
+			OriginalFilename: item.originalFilename,
+			Mismatch:         item.mismatch,
+			Err:              item.err,
+			input:            item.input,
+		}
+		plan.Files = append(plan.Files, f)
+
+		if f.Err == nil {
+			if _, err := os.Stat(f.Source); err != nil {
+				f.Err = fmt.Errorf("failed to read %s: %w", f.Source, err)
+			}
+		}
+		if f.Err == nil {
+			ext := strings.TrimPrefix(filepath.Ext(f.Destination), ".")
+			f.FileFormat, f.Raw, f.Err = resolveFileFormat(item.input, ext)
+		}
+
+		source := normalizePath(f.Source)
+		switch {
+		case f.Err != nil:
+			f.Action = PlanError
+			plan.Errors = append(plan.Errors, f.Err)
+		case seen[source]:
+			f.Action = PlanSkipDuplicate
+		case item.skip:
+			f.Action = PlanSkipCollision
+		default:
+			f.Action = PlanAdd
+		}
+		seen[source] = true
+	}
+
+	if err := c.planFolders(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planFolders marks cataloged files and records the root folders and folders
+// the planned files need. Folders are resolved in a transaction that is rolled
+// back, so the result matches what the import itself will create.
+func (c *Catalog) planFolders(plan *ImportPlan) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastRoot, lastFolder int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(id_local), 0) FROM AgLibraryRootFolder`).Scan(&lastRoot); err != nil {
+		return err
+	}
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(id_local), 0) FROM AgLibraryFolder`).Scan(&lastFolder); err != nil {
+		return err
+	}
+
+	dirs := map[string]bool{}
+	for _, f := range plan.Files {
+		if f.Action != PlanAdd {
+			continue
+		}
+		cataloged, err := c.fileInCatalog(tx, f.Destination)
+		if err != nil {
+			return err
+		}
+		if cataloged {
+			f.Action = PlanSkipCataloged
+			continue
+		}
+
+		dir := filepath.Dir(normalizePath(f.Destination))
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if _, _, err := c.ensureFolderPath(tx, dir); err != nil {
+			return fmt.Errorf("failed to resolve folder %s: %w", dir, err)
+		}
+	}
+
+	rows, err := tx.Query(
+		`SELECT absolutePath FROM AgLibraryRootFolder WHERE id_local > ? ORDER BY absolutePath`,
+		lastRoot,
+	)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return err
+		}
+		plan.RootFolders = append(plan.RootFolders, c.localPath(path))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = tx.Query(
+		`SELECT rf.absolutePath || fo.pathFromRoot FROM AgLibraryFolder fo
+		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+		 WHERE fo.id_local > ?
+		 ORDER BY 1`,
+		lastFolder,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return err
+		}
+		plan.Folders = append(plan.Folders, c.localPath(path))
+	}
+	return rows.Err()
+}
+
+// planItems converts a plan back into import items for execution. inputs must
+// be the slice the plan was made for.
+func (c *Catalog) planItems(plan *ImportPlan, inputs []*ImageInput) ([]*importItem, error) {
+	if plan.catalog != c {
+		return nil, fmt.Errorf("import plan belongs to a different catalog")
+	}
+	if len(inputs) != len(plan.inputs) {
+		return nil, fmt.Errorf("import plan covers %d files, got %d", len(plan.inputs), len(inputs))
+	}
+	for i, input := range inputs {
+		if input.FilePath != plan.inputs[i].FilePath {
+			return nil, fmt.Errorf("import plan does not match input %d: %s", i, input.FilePath)
+		}
+	}
+	if err := plan.Err(); err != nil {
+		return nil, fmt.Errorf("import plan has errors: %w", err)
+	}
+
+	items := make([]*importItem, 0, len(plan.Files))
+	for _, f := range plan.Files {
+		items = append(items, &importItem{
+			input:            f.input,
+			sourcePath:       f.Source,
+			destPath:         f.Destination,
+			originalFilename: f.OriginalFilename,
+			skip:             f.Action != PlanAdd,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,137 @@
+package lrcat
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlanImport(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	existingDir := t.TempDir()
+	newDir := t.TempDir()
+	cataloged := writeTestFile(t, existingDir, "a.jpg", []byte("a"))
+	fresh := writeTestFile(t, existingDir, "b.jpg", []byte("b"))
+	other := writeTestFile(t, newDir, "sub/c.jpg", []byte("c"))
+	text := writeTestFile(t, newDir, "notes.txt", []byte("notes"))
+
+	if _, err := catalog.AddImage(&ImageInput{FilePath: cataloged}); err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	rootsBefore, _ := catalog.ListRootFolders()
+
+	inputs := []*ImageInput{
+		{FilePath: cataloged},
+		{FilePath: fresh},
+		{FilePath: other},
+		{FilePath: other},
+		{FilePath: filepath.Join(newDir, "missing.jpg")},
+		{FilePath: text},
+	}
+	plan, err := catalog.PlanImport(inputs, nil)
+	if err != nil {
+		t.Fatalf("PlanImport failed: %v", err)
+	}
+
+	expected := []PlanAction{PlanSkipCataloged, PlanAdd, PlanAdd, PlanSkipDuplicate, PlanError, PlanError}
+	for i, f := range plan.Files {
+		if f.Action != expected[i] {
+			t.Errorf("File %d (%s): expected %s, got %s (%v)", i, f.Source, expected[i], f.Action, f.Err)
+		}
+	}
+	if plan.Files[1].FileFormat != FileFormatJPG || plan.Files[1].Destination != fresh {
+		t.Errorf("Unexpected plan for %s: %+v", fresh, plan.Files[1])
+	}
+	if !errors.Is(plan.Files[5].Err, ErrUnknownFileType) {
+		t.Errorf("Expected ErrUnknownFileType for notes.txt, got %v", plan.Files[5].Err)
+	}
+	if len(plan.Errors) != 2 || plan.Err() == nil {
+		t.Errorf("Expected 2 errors, got %v", plan.Errors)
+	}
+
+	subDir := normalizePath(filepath.Join(newDir, "sub")) + "/"
+	if len(plan.RootFolders) != 1 || plan.RootFolders[0] != subDir {
+		t.Errorf("Expected new root %s, got %v", subDir, plan.RootFolders)
+	}
+	if len(plan.Folders) != 1 || plan.Folders[0] != subDir {
+		t.Errorf("Expected new folder %s, got %v", subDir, plan.Folders)
+	}
+
+	// Planning leaves the catalog untouched
+	rootsAfter, _ := catalog.ListRootFolders()
+	if len(rootsAfter) != len(rootsBefore) {
+		t.Errorf("Planning created root folders: %d -> %d", len(rootsBefore), len(rootsAfter))
+	}
+
+	// A plan with errors cannot be executed
+	if _, _, err := catalog.AddImagesWithOptions(inputs, &ImportOptions{Plan: plan}); err == nil {
+		t.Error("Expected executing a plan with errors to fail")
+	}
+
+	// Without the invalid files the plan executes as previewed
+	inputs = inputs[:4]
+	plan, err = catalog.PlanImport(inputs, &ImportOptions{SessionName: "Planned"})
+	if err != nil {
+		t.Fatalf("PlanImport failed: %v", err)
+	}
+	session, images, err := catalog.AddImagesWithOptions(inputs, &ImportOptions{Plan: plan})
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	if session.Name != "Planned" || len(images) != plan.Count(PlanAdd) || len(images) != 2 {
+		t.Errorf("Expected 2 images in session Planned, got %d in %q", len(images), session.Name)
+	}
+	root, _ := catalog.GetRootFolderByPath(subDir)
+	if root == nil {
+		t.Errorf("Expected root folder %s to be created", subDir)
+	}
+
+	if _, _, err := catalog.AddImagesWithOptions(inputs[:3], &ImportOptions{Plan: plan}); err == nil {
+		t.Error("Expected a plan for different inputs to be rejected")
+	}
+}
+
+func TestPlanImportCopy(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	card := t.TempDir()
+	library := t.TempDir()
+	captured := time.Date(2024, 6, 15, 14, 30, 0, 0, time.UTC)
+	src := writeTestFile(t, card, "DCIM/IMG_001.jpg", []byte("image data"))
+	writeTestFile(t, library, "2024/2024-06-15/IMG_001.jpg", []byte("existing"))
+
+	inputs := []*ImageInput{{FilePath: src, CaptureTime: captured}}
+	opts := &ImportOptions{Mode: ImportModeCopy, DestinationRoot: library}
+	plan, err := catalog.PlanImport(inputs, opts)
+	if err != nil {
+		t.Fatalf("PlanImport failed: %v", err)
+	}
+
+	dest := filepath.Join(library, "2024", "2024-06-15", "IMG_001-1.jpg")
+	if plan.Files[0].Destination != dest || plan.Files[0].Action != PlanAdd {
+		t.Errorf("Expected copy to %s, got %+v", dest, plan.Files[0])
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("Planning should not copy files")
+	}
+	if len(plan.RootFolders) != 1 || len(plan.Folders) != 1 {
+		t.Errorf("Expected one new root and folder, got %v %v", plan.RootFolders, plan.Folders)
+	}
+
+	_, images, err := catalog.AddImagesWithOptions(inputs, &ImportOptions{Plan: plan})
+	if err != nil {
+		t.Fatalf("Failed to execute plan: %v", err)
+	}
+	path, _ := catalog.GetImagePath(images[0].ID)
+	if path != normalizePath(dest) {
+		t.Errorf("Expected image at %s, got %s", dest, path)
+	}
+	if images[0].FileFormat != plan.Files[0].FileFormat {
+		t.Errorf("Expected format %s, got %s", plan.Files[0].FileFormat, images[0].FileFormat)
+	}
+}
@@ -0,0 +1,369 @@
+package lrcat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ImportPreset describes metadata applied to every image of an import.
+// Presets can be built in code or loaded from JSON or YAML with LoadImportPreset:
+//
+//	name: Wedding
+//	keywords:
+//	  - Events/Wedding
+//	  - People/Clients
+//	iptc:
+//	  creator: Jane Doe
+//	  copyright: "© 2024 Jane Doe"
+//	rating: 3
+//	colorLabel: Green
+//	collection: Clients/2024/Smith Wedding
+//	developPreset:
+//	  name: Warm
+//	  settings:
+//	    Exposure2012: 0.35
+//	    Temperature: 5600
+type ImportPreset struct {
+	// Name identifies the preset
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Keywords are keyword paths such as "Places/France/Paris"; missing
+	// keywords are created
+	Keywords []string `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	// IPTC replaces the IPTC metadata of every image
+	IPTC *IPTCMetadata `json:"iptc,omitempty" yaml:"iptc,omitempty"`
+	// Rating is applied to images whose input has no rating (0-5)
+	Rating *int `json:"rating,omitempty" yaml:"rating,omitempty"`
+	// ColorLabel is applied to images whose input has no color label
+	ColorLabel string `json:"colorLabel,omitempty" yaml:"colorLabel,omitempty"`
+	// Collection is a collection path such as "Clients/2024/Smith"; leading
+	// parts become collection sets and missing ones are created
+	Collection string `json:"collection,omitempty" yaml:"collection,omitempty"`
+	// DevelopPreset is stored as each image's develop settings
+	DevelopPreset *DevelopPreset `json:"developPreset,omitempty" yaml:"developPreset,omitempty"`
+}
+
+// DevelopPreset is a named set of Camera Raw develop settings
+type DevelopPreset struct {
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Settings maps Camera Raw setting names (e.g. "Exposure2012") to values
+	Settings DevelopSettings `json:"settings,omitempty" yaml:"settings,omitempty"`
+}
+
+// DevelopSettings maps Camera Raw setting names to their values
+type DevelopSettings map[string]string
+
+// UnmarshalJSON accepts strings, numbers and booleans as setting values
+func (s *DevelopSettings) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	settings := make(DevelopSettings, len(raw))
+	for key, value := range raw {
+		var str string
+		if err := json.Unmarshal(value, &str); err == nil {
+			settings[key] = str
+			continue
+		}
+		var scalar interface{}
+		dec := json.NewDecoder(bytes.NewReader(value))
+		dec.UseNumber()
+		if err := dec.Decode(&scalar); err != nil {
+			return err
+		}
+		switch v := scalar.(type) {
+		case json.Number:
+			settings[key] = v.String()
+		case bool:
+			settings[key] = strconv.FormatBool(v)
+		default:
+			return fmt.Errorf("develop setting %s must be a string, number or boolean", key)
+		}
+	}
+	*s = settings
+	return nil
+}
+
+// UnmarshalYAML accepts scalars as setting values, keeping their text as
+// written so that e.g. 0.10 is not turned into 0.1
+func (s *DevelopSettings) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: develop settings must be a mapping", node.Line)
+	}
+
+	settings := make(DevelopSettings, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Tag == "!!null" {
+			return fmt.Errorf("line %d: develop setting %s must be a string, number or boolean", value.Line, key.Value)
+		}
+		settings[key.Value] = value.Value
+	}
+	*s = settings
+	return nil
+}
+
+// LoadImportPreset reads an import preset from a .json, .yaml or .yml file
+func LoadImportPreset(path string) (*ImportPreset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preset: %w", err)
+	}
+
+	preset, err := ParseImportPreset(data, strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load preset %s: %w", path, err)
+	}
+	return preset, nil
+}
+
+// ParseImportPreset parses an import preset. format is "json", "yaml" or "yml".
+func ParseImportPreset(data []byte, format string) (*ImportPreset, error) {
+	var preset ImportPreset
+	var err error
+	switch strings.ToLower(format) {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&preset)
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&preset)
+	default:
+		return nil, fmt.Errorf("unsupported preset format: %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid preset: %w", err)
+	}
+	if err := preset.Validate(); err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// Validate checks the preset for values the catalog cannot store
+func (p *ImportPreset) Validate() error {
+	if p.Rating != nil && (*p.Rating < 0 || *p.Rating > 5) {
+		return fmt.Errorf("preset rating must be between 0 and 5, got %d", *p.Rating)
+	}
+	for _, path := range p.Keywords {
+		if strings.Trim(path, "/ ") == "" {
+			return fmt.Errorf("preset contains an empty keyword path")
+		}
+	}
+	if p.DevelopPreset != nil {
+		for key := range p.DevelopPreset.Settings {
+			if !isLuaIdentifier(key) {
+				return fmt.Errorf("invalid develop setting name: %q", key)
+			}
+		}
+	}
+	return nil
+}
+
+// resolvedPreset holds the catalog records an ImportPreset refers to,
+// looked up once per import
+type resolvedPreset struct {
+	preset     *ImportPreset
+	keywords   []*Keyword
+	collection *Collection
+}
+
+// resolveImportPreset creates the preset's keywords and collection
+func (c *Catalog) resolveImportPreset(db dbExecutor, preset *ImportPreset) (*resolvedPreset, error) {
+	if err := preset.Validate(); err != nil {
+		return nil, err
+	}
+
+	resolved := &resolvedPreset{preset: preset}
+	for _, path := range preset.Keywords {
+		keyword, err := c.createHierarchicalKeywords(db, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create preset keyword %s: %w", path, err)
+		}
+		resolved.keywords = append(resolved.keywords, keyword)
+	}
+
+	if preset.Collection != "" {
+		collection, err := c.getOrCreateCollectionPath(db, preset.Collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create preset collection %s: %w", preset.Collection, err)
+		}
+		resolved.collection = collection
+	}
+	return resolved, nil
+}
+
+// applyRatingAndLabel fills the input's rating and color label from the preset
+// where the input leaves them unset
+func (r *resolvedPreset) applyRatingAndLabel(input *ImageInput) {
+	if input.Rating == nil && r.preset.Rating != nil {
+		rating := *r.preset.Rating
+		input.Rating = &rating
+	}
+	if input.ColorLabel == "" {
+		input.ColorLabel = r.preset.ColorLabel
+	}
+}
+
+// applyImportPreset adds the preset's keywords, collection, IPTC metadata and
+// develop settings to a newly added image
+func (c *Catalog) applyImportPreset(db dbExecutor, image *Image, r *resolvedPreset) error {
+	for _, keyword := range r.keywords {
+		if err := c.addKeywordToImage(db, image.ID, keyword.ID); err != nil {
+			return err
+		}
+	}
+
+	if r.collection != nil {
+		if err := c.addImageToCollection(db, image.ID, r.collection.ID); err != nil {
+			return err
+		}
+	}
+
+	if !r.preset.IPTC.IsEmpty() {
+		if err := c.setIPTC(db, image.ID, r.preset.IPTC); err != nil {
+			return err
+		}
+	}
+
+	if r.preset.DevelopPreset != nil && len(r.preset.DevelopPreset.Settings) > 0 {
+		if err := c.setDevelopSettings(db, image, r.preset.DevelopPreset.Settings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDevelopSettings stores develop settings for an image, both as the
+// Adobe_imageDevelopSettings text Lightroom reads and as crs: attributes
+// in the image's stored XMP
+func (c *Catalog) setDevelopSettings(db dbExecutor, image *Image, settings DevelopSettings) error {
+	if _, err := db.Exec(`DELETE FROM Adobe_imageDevelopSettings WHERE image = ?`, image.ID); err != nil {
+		return fmt.Errorf("failed to clear develop settings: %w", err)
+	}
+	_, err := db.Exec(
+		`INSERT INTO Adobe_imageDevelopSettings (image, text, hasDevelopAdjustments, processVersion)
+		 VALUES (?, ?, 1, ?)`,
+		image.ID, formatDevelopSettings(settings), nullIfEmpty(settings["ProcessVersion"]),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set develop settings: %w", err)
+	}
+
+	var data []byte
+	if err := db.QueryRow(`SELECT xmp FROM Adobe_AdditionalMetadata WHERE image = ?`, image.ID).Scan(&data); err != nil {
+		return fmt.Errorf("failed to get XMP: %w", err)
+	}
+	xmp := ""
+	if len(data) > 0 {
+		if xmp, err = DecompressXMP(data); err != nil {
+			return err
+		}
+	}
+	if xmp == "" {
+		xmp = GenerateBasicXMP(image.Rating, image.ColorLabel, FormatCaptureTime(image.CaptureTime))
+	}
+
+	attrs := make(map[string]string, len(settings))
+	for key, value := range settings {
+		attrs["crs:"+key] = value
+	}
+	if xmp, err = SetXMPAttributes(xmp, attrs); err != nil {
+		return err
+	}
+	compressed, err := CompressXMP(xmp)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE Adobe_AdditionalMetadata SET xmp = ? WHERE image = ?`, compressed, image.ID); err != nil {
+		return fmt.Errorf("failed to update XMP: %w", err)
+	}
+	return nil
+}
+
+// formatDevelopSettings renders settings as the Lua table text Lightroom
+// stores in Adobe_imageDevelopSettings.text. Numbers and booleans are written
+// bare, everything else as a quoted string.
+func formatDevelopSettings(settings DevelopSettings) string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("s = {\n")
+	for _, key := range keys {
+		value := settings[key]
+		if !isLuaLiteral(value) {
+			value = quoteLuaString(value)
+		}
+		fmt.Fprintf(&sb, "\t%s = %s,\n", key, value)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// quoteLuaString quotes s as a Lua 5.1 string literal. Backslashes, quotes
+// and line breaks are escaped and other control bytes written as \ddd; all
+// remaining bytes, including UTF-8 sequences, are kept as they are.
+func quoteLuaString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch b := s[i]; {
+		case b == '\\' || b == '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case b == '\n':
+			sb.WriteString(`\n`)
+		case b == '\r':
+			sb.WriteString(`\r`)
+		case b < 0x20 || b == 0x7f:
+			fmt.Fprintf(&sb, `\%03d`, b)
+		default:
+			sb.WriteByte(b)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// isLuaLiteral reports whether value can be written unquoted as a Lua number or boolean
+func isLuaLiteral(value string) bool {
+	if value == "true" || value == "false" {
+		return true
+	}
+	if value == "" || strings.ContainsAny(value, "xXpPnN_") {
+		return false
+	}
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// isLuaIdentifier reports whether s can be used as a bare Lua table key
+func isLuaIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
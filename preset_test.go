@@ -0,0 +1,289 @@
+package lrcat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPresetYAML = `# Wedding import preset
+name: Wedding
+keywords:
+  - Events/Wedding
+  - People/Clients
+iptc:
+  creator: Jane Doe
+  copyright: "© 2024 Jane Doe"
+  city: Paris
+rating: 3
+colorLabel: Green
+collection: Clients/2024/Smith Wedding
+developPreset:
+  name: Warm
+  settings:
+    Exposure2012: 0.35
+    Clarity2012: 0.10
+    Temperature: 5600
+    WhiteBalance: Custom
+    AutoLateralCA: true
+`
+
+func TestParseImportPresetYAML(t *testing.T) {
+	preset, err := ParseImportPreset([]byte(testPresetYAML), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse preset: %v", err)
+	}
+
+	if preset.Name != "Wedding" {
+		t.Errorf("Expected name 'Wedding', got '%s'", preset.Name)
+	}
+	if len(preset.Keywords) != 2 || preset.Keywords[0] != "Events/Wedding" {
+		t.Errorf("Unexpected keywords: %v", preset.Keywords)
+	}
+	if preset.IPTC == nil || preset.IPTC.Copyright != "© 2024 Jane Doe" || preset.IPTC.City != "Paris" {
+		t.Errorf("Unexpected IPTC: %+v", preset.IPTC)
+	}
+	if preset.Rating == nil || *preset.Rating != 3 {
+		t.Errorf("Expected rating 3, got %v", preset.Rating)
+	}
+	if preset.Collection != "Clients/2024/Smith Wedding" {
+		t.Errorf("Unexpected collection: %s", preset.Collection)
+	}
+	settings := preset.DevelopPreset.Settings
+	if settings["Exposure2012"] != "0.35" || settings["Clarity2012"] != "0.10" || settings["Temperature"] != "5600" || settings["AutoLateralCA"] != "true" {
+		t.Errorf("Unexpected develop settings: %v", settings)
+	}
+}
+
+func TestParseImportPresetYAMLSyntax(t *testing.T) {
+	// Flow mappings, explicit signs and single quotes
+	data := `
+iptc: {creator: Jane Doe, caption: "Line"}
+keywords: [Events/Wedding, "People/Smith, Ann"]
+developPreset:
+  settings: {Exposure2012: +0.50, WhiteBalance: 'As Shot'}
+`
+	preset, err := ParseImportPreset([]byte(data), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse preset: %v", err)
+	}
+	if len(preset.Keywords) != 2 || preset.Keywords[1] != "People/Smith, Ann" {
+		t.Errorf("Unexpected keywords: %q", preset.Keywords)
+	}
+	if preset.IPTC.Creator != "Jane Doe" {
+		t.Errorf("Unexpected IPTC: %+v", preset.IPTC)
+	}
+	settings := preset.DevelopPreset.Settings
+	if settings["Exposure2012"] != "+0.50" || settings["WhiteBalance"] != "As Shot" {
+		t.Errorf("Unexpected develop settings: %v", settings)
+	}
+}
+
+func TestParseImportPresetJSON(t *testing.T) {
+	data := `{
+		"name": "Studio",
+		"keywords": ["Studio/Portraits"],
+		"rating": 2,
+		"developPreset": {"settings": {"Contrast2012": 15, "WhiteBalance": "Flash"}}
+	}`
+	preset, err := ParseImportPreset([]byte(data), "json")
+	if err != nil {
+		t.Fatalf("Failed to parse preset: %v", err)
+	}
+	if preset.DevelopPreset.Settings["Contrast2012"] != "15" {
+		t.Errorf("Expected Contrast2012 '15', got '%s'", preset.DevelopPreset.Settings["Contrast2012"])
+	}
+}
+
+func TestParseImportPresetErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		format string
+	}{
+		{"unknown field", `{"ratings": 3}`, "json"},
+		{"unknown yaml field", "ratings: 3\n", "yaml"},
+		{"nested setting", "developPreset:\n  settings:\n    Exposure2012: [1, 2]\n", "yaml"},
+		{"rating out of range", `{"rating": 6}`, "json"},
+		{"empty keyword", "keywords:\n  - \"/\"\n", "yaml"},
+		{"bad setting name", `{"developPreset": {"settings": {"bad key": 1}}}`, "json"},
+		{"unsupported format", `name = "x"`, "toml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseImportPreset([]byte(tt.data), tt.format); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestLoadImportPreset(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wedding.yml")
+	if err := os.WriteFile(path, []byte(testPresetYAML), 0644); err != nil {
+		t.Fatalf("Failed to write preset: %v", err)
+	}
+
+	preset, err := LoadImportPreset(path)
+	if err != nil {
+		t.Fatalf("Failed to load preset: %v", err)
+	}
+	if preset.Name != "Wedding" {
+		t.Errorf("Expected name 'Wedding', got '%s'", preset.Name)
+	}
+
+	if _, err := LoadImportPreset(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestImportWithPreset(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	preset, err := ParseImportPreset([]byte(testPresetYAML), "yaml")
+	if err != nil {
+		t.Fatalf("Failed to parse preset: %v", err)
+	}
+
+	dir := t.TempDir()
+	five := 5
+	inputs := []*ImageInput{
+		{FilePath: writeTestFile(t, dir, "IMG_001.jpg", []byte("a"))},
+		{FilePath: writeTestFile(t, dir, "IMG_002.jpg", []byte("b")), Rating: &five, ColorLabel: "Red"},
+	}
+
+	_, images, err := catalog.AddImagesWithOptions(inputs, &ImportOptions{Preset: preset})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	if images[0].Rating == nil || *images[0].Rating != 3 || images[0].ColorLabel != "Green" {
+		t.Errorf("Expected preset rating and label on first image, got %v %s", images[0].Rating, images[0].ColorLabel)
+	}
+	if *images[1].Rating != 5 || images[1].ColorLabel != "Red" {
+		t.Errorf("Input rating and label should win over the preset, got %d %s", *images[1].Rating, images[1].ColorLabel)
+	}
+
+	for _, image := range images {
+		keywords, err := catalog.GetImageKeywords(image.ID)
+		if err != nil {
+			t.Fatalf("Failed to get keywords: %v", err)
+		}
+		if len(keywords) != 2 {
+			t.Errorf("Expected 2 keywords, got %d", len(keywords))
+		}
+
+		collections, err := catalog.GetImageCollections(image.ID)
+		if err != nil {
+			t.Fatalf("Failed to get collections: %v", err)
+		}
+		if len(collections) != 1 || collections[0].Name != "Smith Wedding" {
+			t.Errorf("Expected image in 'Smith Wedding', got %v", collections)
+		}
+
+		iptc, err := catalog.GetIPTC(image.ID)
+		if err != nil {
+			t.Fatalf("Failed to get IPTC: %v", err)
+		}
+		if iptc.Creator != "Jane Doe" || iptc.City != "Paris" {
+			t.Errorf("Unexpected IPTC: %+v", iptc)
+		}
+
+		var text string
+		if err := catalog.DB().QueryRow(
+			`SELECT text FROM Adobe_imageDevelopSettings WHERE image = ?`, image.ID,
+		).Scan(&text); err != nil {
+			t.Fatalf("Failed to get develop settings: %v", err)
+		}
+		if !strings.Contains(text, "Exposure2012 = 0.35,") || !strings.Contains(text, `WhiteBalance = "Custom",`) {
+			t.Errorf("Unexpected develop settings text: %s", text)
+		}
+
+		xmp, err := catalog.GetXMP(image.ID)
+		if err != nil {
+			t.Fatalf("Failed to get XMP: %v", err)
+		}
+		if ExtractXMPValue(xmp, "crs:Temperature") != "5600" {
+			t.Errorf("Expected crs:Temperature in XMP, got %s", xmp)
+		}
+	}
+
+	// Keyword and collection paths are shared, not duplicated per image
+	var count int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryKeyword WHERE name = 'Wedding'`).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 'Wedding' keyword, got %d", count)
+	}
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryCollection WHERE name = 'Smith Wedding'`).Scan(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 'Smith Wedding' collection, got %d", count)
+	}
+}
+
+func TestImportPresetRollsBack(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	// Make the develop settings insert fail after the keywords were created
+	if _, err := catalog.DB().Exec(`DROP TABLE Adobe_imageDevelopSettings`); err != nil {
+		t.Fatalf("Failed to drop table: %v", err)
+	}
+
+	dir := t.TempDir()
+	preset := &ImportPreset{
+		Keywords:      []string{"Events/Concert"},
+		DevelopPreset: &DevelopPreset{Settings: DevelopSettings{"Exposure2012": "1"}},
+	}
+	_, _, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: writeTestFile(t, dir, "IMG_001.jpg", []byte("a"))},
+	}, &ImportOptions{Preset: preset})
+	if err == nil {
+		t.Fatal("Expected import to fail")
+	}
+
+	keyword, err := catalog.GetKeywordByName("Concert")
+	if err != nil {
+		t.Fatalf("Failed to look up keyword: %v", err)
+	}
+	if keyword != nil {
+		t.Error("Preset keyword should be rolled back with the failed import")
+	}
+	images, _ := catalog.ListImages()
+	if len(images) != 0 {
+		t.Errorf("Expected no images after failed import, got %d", len(images))
+	}
+}
+
+func TestFormatDevelopSettings(t *testing.T) {
+	text := formatDevelopSettings(DevelopSettings{
+		"Exposure2012": "-0.5",
+		"Look":         "Adobe Color",
+		"Infinity":     "Inf",
+		"Grayscale":    "false",
+	})
+	expected := "s = {\n\tExposure2012 = -0.5,\n\tGrayscale = false,\n\tInfinity = \"Inf\",\n\tLook = \"Adobe Color\",\n}\n"
+	if text != expected {
+		t.Errorf("Unexpected settings text:\n%s", text)
+	}
+}
+
+func TestQuoteLuaString(t *testing.T) {
+	tests := []struct {
+		value, expected string
+	}{
+		{"Adobe Color", `"Adobe Color"`},
+		{`a "b" \ c`, `"a \"b\" \\ c"`},
+		{"line\nbreak", `"line\nbreak"`},
+		{"\x01" + "2", `"\0012"`},
+		{"zero\u200bwidth café", "\"zero\u200bwidth café\""},
+	}
+	for _, tc := range tests {
+		if got := quoteLuaString(tc.value); got != tc.expected {
+			t.Errorf("quoteLuaString(%q): expected %s, got %s", tc.value, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package lrcat
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RenameOptions describes how files are named during import or RenameImages.
+//
+// Template tokens:
+//
+//	{year} {yy} {month} {monthname} {mon} {day} {hour} {minute} {second} {date}  capture date parts
+//	{filename}                    original file name without extension
+//	{seq} {seq:N}                 sequence number, zero-padded to N digits
+//	{camera}                      camera model from EXIF
+//	{job}                         RenameOptions.Job
+//	{ext} {ext:lower} {ext:upper} original extension, optionally re-cased
+//	{anything}                    looked up in RenameOptions.Custom (e.g. {shooter})
+//
+// Example: "{date}_{shooter}_{seq:4}.{ext:lower}" -> "20240615_jdoe_0001.cr2"
+type RenameOptions struct {
+	// Template is the file name template, including the extension. A name
+	// rendered without an extension is an error.
+	Template string
+	// Job is the text substituted for {job}
+	Job string
+	// Custom maps additional token names to text
+	Custom map[string]string
+	// StartSequence is the first {seq} value. Defaults to 1.
+	StartSequence int
+	// RenameFiles also renames the files on disk (RenameImages only;
+	// imports always write files under their new name)
+	RenameFiles bool
+}
+
+// FilenameTemplateData holds the per-file values a filename template is rendered with
+type FilenameTemplateData struct {
+	CaptureTime      time.Time
+	OriginalFilename string
+	Sequence         int
+	CameraModel      string
+}
+
+// FilenameTemplate is a parsed file name template
+type FilenameTemplate struct {
+	text   string
+	job    string
+	custom map[string]string
+}
+
+// NewFilenameTemplate validates the template in opts and returns it ready for rendering
+func NewFilenameTemplate(opts *RenameOptions) (*FilenameTemplate, error) {
+	if opts == nil || strings.TrimSpace(opts.Template) == "" {
+		return nil, fmt.Errorf("filename template is empty")
+	}
+
+	t := &FilenameTemplate{text: opts.Template, job: opts.Job, custom: opts.Custom}
+
+	// Render once with sample data so unknown tokens are reported up front
+	sample := &FilenameTemplateData{CaptureTime: LightroomEpoch, OriginalFilename: "sample.jpg", Sequence: 1}
+	if _, err := t.Render(sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Render expands the template for a single file
+func (t *FilenameTemplate) Render(data *FilenameTemplateData) (string, error) {
+	origExt := filepath.Ext(data.OriginalFilename)
+	origBase := strings.TrimSuffix(data.OriginalFilename, origExt)
+	origExt = strings.TrimPrefix(origExt, ".")
+
+	name, err := renderTemplate(t.text, func(name, arg string) (string, error) {
+		if value, ok := dateTemplateToken(name, data.CaptureTime); ok {
+			return value, nil
+		}
+
+		switch name {
+		case "filename":
+			return origBase, nil
+		case "seq":
+			width := 1
+			if arg != "" {
+				w, err := strconv.Atoi(arg)
+				if err != nil || w < 1 || w > 12 {
+					return "", fmt.Errorf("invalid sequence width in {seq:%s}", arg)
+				}
+				width = w
+			}
+			return fmt.Sprintf("%0*d", width, data.Sequence), nil
+		case "camera":
+			return sanitizeFilenamePart(data.CameraModel), nil
+		case "job":
+			return sanitizeFilenamePart(t.job), nil
+		case "ext":
+			switch arg {
+			case "":
+				return origExt, nil
+			case "lower":
+				return strings.ToLower(origExt), nil
+			case "upper":
+				return strings.ToUpper(origExt), nil
+			}
+			return "", fmt.Errorf("invalid extension case in {ext:%s}", arg)
+		}
+
+		if value, ok := t.custom[name]; ok {
+			return sanitizeFilenamePart(value), nil
+		}
+		return "", fmt.Errorf("unknown filename template token: {%s}", name)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("template %q produced an invalid file name %q", t.text, name)
+	}
+	if strings.TrimPrefix(filepath.Ext(name), ".") == "" {
+		return "", fmt.Errorf("template %q produced file name %q without an extension", t.text, name)
+	}
+	return name, nil
+}
+
+// sanitizeFilenamePart replaces characters that are not safe in file names
+func sanitizeFilenamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+}
+
+// RenameImages renames the files of the given images using opts.Template.
+// AgLibraryFile baseName, extension and index columns are updated while
+// originalFilename is kept. Sequence numbers follow the order of imageIDs.
+// With opts.RenameFiles the files on disk are renamed too, and renamed back
+// if the catalog update fails.
+func (c *Catalog) RenameImages(imageIDs []int64, opts *RenameOptions) ([]*ImageFile, error) {
+	tmpl, err := NewFilenameTemplate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := opts.StartSequence
+	if seq == 0 {
+		seq = 1
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var renamed [][2]string
+	undoRenames := func() {
+		for i := len(renamed) - 1; i >= 0; i-- {
+			os.Rename(renamed[i][1], renamed[i][0])
+		}
+	}
+
+	var files []*ImageFile
+	for _, imageID := range imageIDs {
+		file, dir, err := c.getImageFile(tx, imageID)
+		if err != nil {
+			undoRenames()
+			return nil, err
+		}
+
+		var captureTime time.Time
+		var captureTimeStr sql.NullString
+		if err := tx.QueryRow(`SELECT captureTime FROM Adobe_images WHERE id_local = ?`, imageID).Scan(&captureTimeStr); err != nil {
+			undoRenames()
+			return nil, err
+		}
+		if captureTimeStr.Valid && captureTimeStr.String != "" {
+			if captureTime, err = parseTime(captureTimeStr.String); err != nil {
+				undoRenames()
+				return nil, fmt.Errorf("failed to read capture time of image %d: %w", imageID, err)
+			}
+		}
+
+		var cameraModel sql.NullString
+		if err := tx.QueryRow(
+			`SELECT cm.value FROM AgHarvestedExifMetadata e
+			 JOIN AgInternedExifCameraModel cm ON e.cameraModelRef = cm.id_local
+			 WHERE e.image = ?`,
+			imageID,
+		).Scan(&cameraModel); err != nil && err != sql.ErrNoRows {
+			undoRenames()
+			return nil, fmt.Errorf("failed to read camera model of image %d: %w", imageID, err)
+		}
+
+		original := file.OriginalFilename
+		if original == "" {
+			original = file.BaseName + "." + file.Extension
+		}
+		newName, err := tmpl.Render(&FilenameTemplateData{
+			CaptureTime:      captureTime,
+			OriginalFilename: original,
+			Sequence:         seq,
+			CameraModel:      cameraModel.String,
+		})
+		if err != nil {
+			undoRenames()
+			return nil, err
+		}
+		seq++
+
+		ext := filepath.Ext(newName)
+		baseName := strings.TrimSuffix(newName, ext)
+		ext = strings.TrimPrefix(ext, ".")
+		if baseName == file.BaseName && ext == file.Extension {
+			files = append(files, file)
+			continue
+		}
+
+		var conflicts int
+		if err := tx.QueryRow(
+			`SELECT COUNT(*) FROM AgLibraryFile WHERE folder = ? AND lc_idx_filename = ? AND id_local != ?`,
+			file.FolderID, strings.ToLower(newName), file.ID,
+		).Scan(&conflicts); err != nil {
+			undoRenames()
+			return nil, err
+		}
+		if conflicts > 0 {
+			undoRenames()
+			return nil, fmt.Errorf("a file named %s already exists in the folder", newName)
+		}
+
+		if opts.RenameFiles {
+			oldPath := filepath.Join(dir, file.BaseName+"."+file.Extension)
+			newPath := filepath.Join(dir, newName)
+			if _, err := os.Lstat(newPath); err == nil {
+				undoRenames()
+				return nil, fmt.Errorf("destination file already exists: %s", newPath)
+			}
+			if err := os.Rename(oldPath, newPath); err != nil {
+				undoRenames()
+				return nil, fmt.Errorf("failed to rename %s: %w", oldPath, err)
+			}
+			renamed = append(renamed, [2]string{oldPath, newPath})
+		}
+
+		if err := updateFileName(tx, file.ID, baseName, ext); err != nil {
+			undoRenames()
+			return nil, err
+		}
+		file.BaseName = baseName
+		file.Extension = ext
+		files = append(files, file)
+	}
+
+	if err := tx.Commit(); err != nil {
+		undoRenames()
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return files, nil
+}
+
+// updateFileName sets the name columns of an AgLibraryFile row
+func updateFileName(db dbExecutor, fileID int64, baseName, extension string) error {
+	idxFilename := baseName + "." + extension
+	_, err := db.Exec(
+		`UPDATE AgLibraryFile SET baseName = ?, extension = ?, idx_filename = ?, lc_idx_filename = ?,
+		 lc_idx_filenameExtension = ? WHERE id_local = ?`,
+		baseName, extension, idxFilename, strings.ToLower(idxFilename), strings.ToLower(extension), fileID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update file name: %w", err)
+	}
+	return nil
+}
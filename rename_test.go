@@ -0,0 +1,195 @@
+package lrcat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilenameTemplateRender(t *testing.T) {
+	data := &FilenameTemplateData{
+		CaptureTime:      time.Date(2024, 6, 15, 14, 30, 0, 0, time.UTC),
+		OriginalFilename: "IMG_0042.CR2",
+		Sequence:         7,
+		CameraModel:      "Canon EOS R5",
+	}
+
+	tests := []struct {
+		opts     RenameOptions
+		expected string
+	}{
+		{RenameOptions{Template: "{date}_{shooter}_{seq:4}.{ext}", Custom: map[string]string{"shooter": "jdoe"}}, "20240615_jdoe_0007.CR2"},
+		{RenameOptions{Template: "{filename}.{ext:lower}"}, "IMG_0042.cr2"},
+		{RenameOptions{Template: "{year}-{month}-{day}_{camera}_{seq}.{ext:upper}"}, "2024-06-15_Canon EOS R5_7.CR2"},
+		{RenameOptions{Template: "{job}_{seq:3}.{ext}", Job: "Smith/Wedding"}, "Smith_Wedding_007.CR2"},
+	}
+
+	for _, tc := range tests {
+		tmpl, err := NewFilenameTemplate(&tc.opts)
+		if err != nil {
+			t.Errorf("NewFilenameTemplate(%q): unexpected error: %v", tc.opts.Template, err)
+			continue
+		}
+		got, err := tmpl.Render(data)
+		if err != nil {
+			t.Errorf("Render(%q): unexpected error: %v", tc.opts.Template, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("Render(%q): expected %q, got %q", tc.opts.Template, tc.expected, got)
+		}
+	}
+}
+
+func TestFilenameTemplateInvalid(t *testing.T) {
+	for _, tmpl := range []string{"", "{unknown}.{ext}", "{seq:x}.{ext}", "{ext:title}", "a/{seq}.{ext}", "{date}_{seq:4}", "{filename}."} {
+		if _, err := NewFilenameTemplate(&RenameOptions{Template: tmpl}); err == nil {
+			t.Errorf("NewFilenameTemplate(%q): expected error", tmpl)
+		}
+	}
+}
+
+func TestImportWithRenameTemplate(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	card := t.TempDir()
+	library := t.TempDir()
+	a := writeTestFile(t, card, "IMG_0001.JPG", []byte("a"))
+	b := writeTestFile(t, card, "IMG_0002.JPG", []byte("b"))
+	captureTime := time.Date(2024, 6, 15, 9, 0, 0, 0, time.UTC)
+
+	_, images, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: a, CaptureTime: captureTime},
+		{FilePath: b, CaptureTime: captureTime},
+	}, &ImportOptions{
+		Mode:            ImportModeCopy,
+		DestinationRoot: library,
+		FolderTemplate:  "{year}",
+		Rename: &RenameOptions{
+			Template: "{date}_{shooter}_{seq:4}.{ext:lower}",
+			Custom:   map[string]string{"shooter": "jdoe"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	for i, expected := range []string{"20240615_jdoe_0001.jpg", "20240615_jdoe_0002.jpg"} {
+		if _, err := os.Stat(filepath.Join(library, "2024", expected)); err != nil {
+			t.Errorf("Expected renamed file %s: %v", expected, err)
+		}
+		file, err := catalog.GetImageFile(images[i].ID)
+		if err != nil {
+			t.Fatalf("Failed to get image file: %v", err)
+		}
+		if file.BaseName+"."+file.Extension != expected {
+			t.Errorf("Expected catalog name %s, got %s.%s", expected, file.BaseName, file.Extension)
+		}
+	}
+
+	file, _ := catalog.GetImageFile(images[0].ID)
+	if file.OriginalFilename != "IMG_0001.JPG" {
+		t.Errorf("Expected originalFilename IMG_0001.JPG, got %s", file.OriginalFilename)
+	}
+}
+
+func TestImportRenameRequiresTransfer(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	_, _, err := catalog.AddImagesWithOptions([]*ImageInput{{FilePath: "/photos/a.jpg"}}, &ImportOptions{
+		Rename: &RenameOptions{Template: "{seq}.{ext}"},
+	})
+	if err == nil {
+		t.Error("Expected error when renaming in add mode")
+	}
+}
+
+func TestRenameImages(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	a := writeTestFile(t, dir, "IMG_0001.jpg", []byte("a"))
+	b := writeTestFile(t, dir, "IMG_0002.jpg", []byte("b"))
+
+	_, images, err := catalog.AddImages([]*ImageInput{
+		{FilePath: a, CaptureTime: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{FilePath: b, CaptureTime: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add images: %v", err)
+	}
+
+	files, err := catalog.RenameImages([]int64{images[0].ID, images[1].ID}, &RenameOptions{
+		Template:      "{date}_{job}_{seq:2}.{ext:upper}",
+		Job:           "trip",
+		StartSequence: 10,
+		RenameFiles:   true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to rename images: %v", err)
+	}
+
+	if files[0].BaseName != "20240102_trip_10" || files[1].BaseName != "20240103_trip_11" {
+		t.Errorf("Unexpected names: %s, %s", files[0].BaseName, files[1].BaseName)
+	}
+
+	path, _ := catalog.GetImagePath(images[0].ID)
+	if filepath.Base(path) != "20240102_trip_10.JPG" {
+		t.Errorf("Unexpected catalog path: %s", path)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20240102_trip_10.JPG")); err != nil {
+		t.Errorf("Expected file renamed on disk: %v", err)
+	}
+
+	var lcName, original string
+	catalog.DB().QueryRow(`SELECT lc_idx_filename, originalFilename FROM AgLibraryFile WHERE id_local = ?`, files[0].ID).Scan(&lcName, &original)
+	if lcName != "20240102_trip_10.jpg" {
+		t.Errorf("Expected lc_idx_filename to be updated, got %s", lcName)
+	}
+	if original != "IMG_0001.jpg" {
+		t.Errorf("Expected originalFilename to be kept, got %s", original)
+	}
+}
+
+func TestRenameImagesConflict(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	_, images, err := catalog.AddImages([]*ImageInput{
+		{FilePath: "/photos/a.jpg", CaptureTime: time.Now()},
+		{FilePath: "/photos/b.jpg", CaptureTime: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add images: %v", err)
+	}
+
+	_, err = catalog.RenameImages([]int64{images[0].ID, images[1].ID}, &RenameOptions{Template: "same.{ext}"})
+	if err == nil {
+		t.Fatal("Expected conflict error")
+	}
+
+	// The transaction is rolled back, so the first file keeps its name
+	file, _ := catalog.GetImageFile(images[0].ID)
+	if file.BaseName != "a" {
+		t.Errorf("Expected rename to be rolled back, got %s", file.BaseName)
+	}
+}
+
+func TestRenameImagesInvalidCaptureTime(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	image, err := catalog.AddImage(&ImageInput{FilePath: "/photos/a.jpg"})
+	if err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	catalog.DB().Exec(`UPDATE Adobe_images SET captureTime = 'yesterday' WHERE id_local = ?`, image.ID)
+
+	if _, err := catalog.RenameImages([]int64{image.ID}, &RenameOptions{Template: "{date}.{ext}"}); err == nil {
+		t.Error("Expected an unreadable capture time to fail")
+	}
+}
@@ -0,0 +1,427 @@
+package lrcat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaptureTimeSource identifies where a scanned file's capture time is read from
+type CaptureTimeSource int
+
+const (
+	// CaptureTimeFromEXIF uses EXIF DateTimeOriginal embedded in the file
+	CaptureTimeFromEXIF CaptureTimeSource = iota
+	// CaptureTimeFromXMPSidecar uses exif:DateTimeOriginal from an .xmp sidecar
+	CaptureTimeFromXMPSidecar
+	// CaptureTimeFromFilename parses a date/time from the file name
+	CaptureTimeFromFilename
+	// CaptureTimeFromModTime uses the file modification time
+	CaptureTimeFromModTime
+)
+
+// DefaultCaptureTimeSources is the fallback chain used when ScanOptions does not specify one
+var DefaultCaptureTimeSources = []CaptureTimeSource{
+	CaptureTimeFromEXIF,
+	CaptureTimeFromXMPSidecar,
+	CaptureTimeFromFilename,
+	CaptureTimeFromModTime,
+}
+
+// DefaultFilenameTimePatterns match common camera and phone naming schemes such as
+// "IMG_20240615_143000.jpg", "2024-06-15 14.30.00.jpg" and "PXL_20240615.jpg".
+// Patterns use the named groups year, month, day and optionally hour, minute, second.
+var DefaultFilenameTimePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?P<year>(?:19|20)\d{2})[-_.]?(?P<month>[01]\d)[-_.]?(?P<day>[0-3]\d)[-_ T.]?(?P<hour>[0-2]\d)[-_.:h]?(?P<minute>[0-5]\d)[-_.:m]?(?P<second>[0-5]\d)`),
+	regexp.MustCompile(`(?P<year>(?:19|20)\d{2})[-_.]?(?P<month>[01]\d)[-_.]?(?P<day>[0-3]\d)`),
+}
+
+// ScanOptions controls how ScanDirectoryWithOptions finds files and reads their metadata
+type ScanOptions struct {
+	// Recursive descends into subdirectories
+	Recursive bool
+	// CaptureTimeSources is the ordered fallback chain for capture time.
+	// Defaults to DefaultCaptureTimeSources.
+	CaptureTimeSources []CaptureTimeSource
+	// FilenamePatterns are used by CaptureTimeFromFilename.
+	// Defaults to DefaultFilenameTimePatterns.
+	FilenamePatterns []*regexp.Regexp
+	// Location is the time zone for capture times that carry no offset. Defaults to UTC.
+	Location *time.Location
+	// Workers is the number of concurrent metadata readers. Defaults to runtime.NumCPU().
+	Workers int
+	// Progress, if set, is called after every file is seen or processed.
+	// Calls are serialized and must return quickly.
+	Progress func(ScanProgress)
+}
+
+// ScanProgress reports the running totals of a directory scan
+type ScanProgress struct {
+	// FilesSeen is the number of files found by the directory walk
+	FilesSeen int
+	// FilesMatched is the number of files with a supported extension
+	FilesMatched int
+	// FilesProcessed is the number of matched files whose metadata has been read
+	FilesProcessed int
+	// Errors is the number of files or directories that could not be read
+	Errors int
+	// Bytes is the total size of the matched files
+	Bytes int64
+}
+
+// ScanError records a file or directory that could not be scanned
+type ScanError struct {
+	Path string
+	Err  error
+}
+
+// Error implements the error interface
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// ScanResult is the outcome of ScanDirectoryContext
+type ScanResult struct {
+	// Inputs are the scanned files in directory walk (lexical) order
+	Inputs []*ImageInput
+	// Errors lists every file or directory that could not be read, in walk order
+	Errors []*ScanError
+	// Progress holds the final totals
+	Progress ScanProgress
+}
+
+// ScanDirectory scans a directory for image files and returns ImageInputs.
+// Capture time, dimensions and orientation are read using the default fallback chain.
+func ScanDirectory(dir string, recursive bool) ([]*ImageInput, error) {
+	return ScanDirectoryWithOptions(dir, &ScanOptions{Recursive: recursive})
+}
+
+// ScanDirectoryWithOptions scans a directory for image files and returns ImageInputs
+// populated from embedded metadata, .xmp sidecars, file names and modification times.
+// Files that cannot be read are skipped; use ScanDirectoryContext to collect them.
+func ScanDirectoryWithOptions(dir string, opts *ScanOptions) ([]*ImageInput, error) {
+	result, err := ScanDirectoryContext(context.Background(), dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Inputs, nil
+}
+
+// scanJob is a matched file waiting for metadata extraction
+type scanJob struct {
+	index int
+	path  string
+	info  os.FileInfo
+}
+
+// ScanDirectoryContext scans a directory using a bounded pool of metadata readers.
+// Unreadable files and directories are collected in ScanResult.Errors instead of
+// aborting the scan. If ctx is cancelled, the partial result is returned with ctx.Err().
+func ScanDirectoryContext(ctx context.Context, dir string, opts *ScanOptions) (*ScanResult, error) {
+	if opts == nil {
+		opts = &ScanOptions{}
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+
+	var (
+		mu       sync.Mutex
+		progress ScanProgress
+		inputs   = map[int]*ImageInput{}
+		errs     = map[int]*ScanError{}
+		next     int
+	)
+
+	// update applies fn to the shared state and reports progress
+	update := func(fn func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn()
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	jobs := make(chan scanJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				input, err := readFileMetadata(job.path, job.info, opts)
+				update(func() {
+					progress.FilesProcessed++
+					if err != nil {
+						progress.Errors++
+						errs[job.index] = &ScanError{Path: job.path, Err: err}
+						return
+					}
+					inputs[job.index] = input
+				})
+			}
+		}()
+	}
+
+	walkErr := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			update(func() {
+				progress.Errors++
+				errs[next] = &ScanError{Path: path, Err: err}
+				next++
+			})
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if !opts.Recursive && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if !isImageExtension(ext) {
+			update(func() { progress.FilesSeen++ })
+			return nil
+		}
+
+		info, err := d.Info()
+		var index int
+		update(func() {
+			progress.FilesSeen++
+			index = next
+			next++
+			if err != nil {
+				progress.Errors++
+				errs[index] = &ScanError{Path: path, Err: err}
+				return
+			}
+			progress.FilesMatched++
+			progress.Bytes += info.Size()
+		})
+		if err != nil {
+			return nil
+		}
+
+		select {
+		case jobs <- scanJob{index: index, path: path, info: info}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	close(jobs)
+	wg.Wait()
+
+	result := &ScanResult{Progress: progress}
+	for i := 0; i < next; i++ {
+		if input, ok := inputs[i]; ok {
+			result.Inputs = append(result.Inputs, input)
+		}
+		if scanErr, ok := errs[i]; ok {
+			result.Errors = append(result.Errors, scanErr)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if walkErr != nil {
+		return result, walkErr
+	}
+	return result, nil
+}
+
+// readFileMetadata builds an ImageInput for path using the configured fallback chain.
+// An error is returned only if the file itself cannot be read; missing or
+// malformed metadata simply falls through to the next source.
+func readFileMetadata(path string, info os.FileInfo, opts *ScanOptions) (*ImageInput, error) {
+	input := &ImageInput{FilePath: path}
+
+	sources := opts.CaptureTimeSources
+	if len(sources) == 0 {
+		sources = DefaultCaptureTimeSources
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	exif, err := readEmbeddedMetadata(path)
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return nil, err
+	}
+	if exif != nil {
+		input.EXIF = exif
+		input.Width, input.Height = exif.Width, exif.Height
+		input.Orientation = exif.Orientation
+	}
+
+	var sidecar string
+	var sidecarLoaded bool
+	loadSidecar := func() string {
+		if !sidecarLoaded {
+			sidecar = readXMPSidecar(path)
+			sidecarLoaded = true
+		}
+		return sidecar
+	}
+
+	for _, source := range sources {
+		var t time.Time
+		switch source {
+		case CaptureTimeFromEXIF:
+			if exif != nil && !exif.DateTimeOriginal.IsZero() {
+				t = exif.DateTimeOriginal
+				if t.Location() == time.UTC && loc != time.UTC {
+					t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+				}
+			}
+		case CaptureTimeFromXMPSidecar:
+			if xmp := loadSidecar(); xmp != "" {
+				t, _ = parseXMPDate(ExtractXMPValue(xmp, "exif:DateTimeOriginal"), loc)
+			}
+		case CaptureTimeFromFilename:
+			t, _ = parseFilenameTime(filepath.Base(path), opts.FilenamePatterns, loc)
+		case CaptureTimeFromModTime:
+			t = info.ModTime()
+		}
+		if !t.IsZero() {
+			input.CaptureTime = t
+			break
+		}
+	}
+
+	// Fill dimensions and orientation from the sidecar when the file has none
+	if input.Width == nil || input.Height == nil || input.Orientation == nil {
+		if xmp := loadSidecar(); xmp != "" {
+			if input.Width == nil || input.Height == nil {
+				width := xmpIntValue(xmp, "exif:PixelXDimension", "tiff:ImageWidth")
+				height := xmpIntValue(xmp, "exif:PixelYDimension", "tiff:ImageLength")
+				if width != nil && height != nil {
+					input.Width, input.Height = width, height
+				}
+			}
+			if input.Orientation == nil {
+				input.Orientation = xmpIntValue(xmp, "tiff:Orientation")
+			}
+		}
+	}
+
+	return input, nil
+}
+
+// readXMPSidecar returns the content of the .xmp sidecar for path, if any.
+// Both "IMG_001.xmp" and "IMG_001.CR2.xmp" naming conventions are checked.
+func readXMPSidecar(path string) string {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, candidate := range []string{base + ".xmp", base + ".XMP", path + ".xmp"} {
+		data, err := os.ReadFile(candidate)
+		if err == nil {
+			return string(data)
+		}
+	}
+	return ""
+}
+
+// xmpIntValue returns the first integer value found for any of keys
+func xmpIntValue(xmp string, keys ...string) *int {
+	for _, key := range keys {
+		if v, err := strconv.Atoi(ExtractXMPValue(xmp, key)); err == nil {
+			return &v
+		}
+	}
+	return nil
+}
+
+// parseXMPDate parses an XMP date such as "2024-06-15T14:30:00.25+02:00".
+// Values without an offset are interpreted in loc.
+func parseXMPDate(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, &time.ParseError{Value: s, Message: ": unrecognized XMP date"}
+}
+
+// parseFilenameTime extracts a capture time from a file name using patterns
+func parseFilenameTime(name string, patterns []*regexp.Regexp, loc *time.Location) (time.Time, bool) {
+	if len(patterns) == 0 {
+		patterns = DefaultFilenameTimePatterns
+	}
+
+	for _, re := range patterns {
+		match := re.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+
+		parts := map[string]int{}
+		for i, group := range re.SubexpNames() {
+			if group == "" || match[i] == "" {
+				continue
+			}
+			if v, err := strconv.Atoi(match[i]); err == nil {
+				parts[group] = v
+			}
+		}
+
+		year, month, day := parts["year"], parts["month"], parts["day"]
+		if year == 0 || month < 1 || month > 12 || day < 1 || day > 31 {
+			continue
+		}
+		if parts["hour"] > 23 || parts["minute"] > 59 || parts["second"] > 59 {
+			continue
+		}
+
+		t := time.Date(year, time.Month(month), day, parts["hour"], parts["minute"], parts["second"], 0, loc)
+		if t.Day() != day {
+			continue // e.g. February 30th
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,274 @@
+package lrcat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestFile writes data to name inside dir and returns the full path
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// findInput returns the scanned input for the given file name
+func findInput(inputs []*ImageInput, name string) *ImageInput {
+	for _, input := range inputs {
+		if filepath.Base(input.FilePath) == name {
+			return input
+		}
+	}
+	return nil
+}
+
+func TestScanDirectoryUsesEXIF(t *testing.T) {
+	dir := t.TempDir()
+
+	ifd := sampleEXIFIFD()
+	exifIFD := ifd.entries[3].value.(*testIFD)
+	exifIFD.entries = append(exifIFD.entries,
+		testIFDEntry{tagSubSecTimeOriginal, 2, "25"},
+		testIFDEntry{tagOffsetTimeOriginal, 2, "+02:00"},
+	)
+	writeTestFile(t, dir, "IMG_001.jpg", buildTestJPEG(buildTestTIFF(ifd), 1920, 1280))
+
+	inputs, err := ScanDirectory(dir, false)
+	if err != nil {
+		t.Fatalf("Failed to scan directory: %v", err)
+	}
+	if len(inputs) != 1 {
+		t.Fatalf("Expected 1 input, got %d", len(inputs))
+	}
+
+	input := inputs[0]
+	expected := time.Date(2024, 6, 15, 14, 30, 0, 250000000, time.FixedZone("", 2*3600))
+	if !input.CaptureTime.Equal(expected) {
+		t.Errorf("Expected capture time %v, got %v", expected, input.CaptureTime)
+	}
+	if FormatCaptureTime(input.CaptureTime) != "2024-06-15T14:30:00.25" {
+		t.Errorf("Unexpected formatted capture time: %s", FormatCaptureTime(input.CaptureTime))
+	}
+	if input.Width == nil || *input.Width != 1920 {
+		t.Errorf("Expected width 1920, got %v", input.Width)
+	}
+	if input.Orientation == nil || *input.Orientation != 6 {
+		t.Errorf("Expected orientation 6, got %v", input.Orientation)
+	}
+	if input.EXIF == nil {
+		t.Error("Expected EXIF to be attached to the input")
+	}
+}
+
+func TestScanDirectoryFallbackChain(t *testing.T) {
+	dir := t.TempDir()
+
+	writeTestFile(t, dir, "export.png", []byte("png"))
+	writeTestFile(t, dir, "export.xmp", []byte(`<rdf:Description
+   exif:DateTimeOriginal="2023-12-24T18:00:00"
+   exif:PixelXDimension="800"
+   exif:PixelYDimension="600"
+   tiff:Orientation="1"/>`))
+	writeTestFile(t, dir, "IMG_20220301_091500.png", []byte("png"))
+	mtimeFile := writeTestFile(t, dir, "scan.png", []byte("png"))
+
+	mtime := time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(mtimeFile, mtime, mtime); err != nil {
+		t.Fatalf("Failed to set mtime: %v", err)
+	}
+
+	inputs, err := ScanDirectoryWithOptions(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to scan directory: %v", err)
+	}
+	if len(inputs) != 3 {
+		t.Fatalf("Expected 3 inputs, got %d", len(inputs))
+	}
+
+	sidecar := findInput(inputs, "export.png")
+	if !sidecar.CaptureTime.Equal(time.Date(2023, 12, 24, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected sidecar capture time, got %v", sidecar.CaptureTime)
+	}
+	if sidecar.Width == nil || *sidecar.Width != 800 || sidecar.Height == nil || *sidecar.Height != 600 {
+		t.Errorf("Expected 800x600 from sidecar, got %v x %v", sidecar.Width, sidecar.Height)
+	}
+
+	named := findInput(inputs, "IMG_20220301_091500.png")
+	if !named.CaptureTime.Equal(time.Date(2022, 3, 1, 9, 15, 0, 0, time.UTC)) {
+		t.Errorf("Expected filename capture time, got %v", named.CaptureTime)
+	}
+
+	fallback := findInput(inputs, "scan.png")
+	if !fallback.CaptureTime.Equal(mtime) {
+		t.Errorf("Expected mtime capture time, got %v", fallback.CaptureTime)
+	}
+}
+
+func TestScanDirectoryPartialSidecarDimensions(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "half.png", []byte("png"))
+	writeTestFile(t, dir, "half.xmp", []byte(`<rdf:Description exif:PixelXDimension="800"/>`))
+
+	inputs, err := ScanDirectoryWithOptions(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to scan directory: %v", err)
+	}
+	if inputs[0].Width != nil || inputs[0].Height != nil {
+		t.Errorf("Expected no dimensions from a sidecar with only a width, got %v x %v", inputs[0].Width, inputs[0].Height)
+	}
+}
+
+func TestScanDirectoryCustomSources(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_20220301_091500.png", []byte("png"))
+
+	inputs, err := ScanDirectoryWithOptions(dir, &ScanOptions{
+		CaptureTimeSources: []CaptureTimeSource{CaptureTimeFromEXIF},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan directory: %v", err)
+	}
+	if !inputs[0].CaptureTime.IsZero() {
+		t.Errorf("Expected zero capture time when no source matches, got %v", inputs[0].CaptureTime)
+	}
+}
+
+func TestScanDirectoryRecursive(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.jpg", []byte("jpg"))
+	writeTestFile(t, dir, "sub/b.jpg", []byte("jpg"))
+	writeTestFile(t, dir, "notes.txt", []byte("txt"))
+
+	flat, _ := ScanDirectory(dir, false)
+	if len(flat) != 1 {
+		t.Errorf("Expected 1 input without recursion, got %d", len(flat))
+	}
+
+	all, _ := ScanDirectory(dir, true)
+	if len(all) != 2 {
+		t.Errorf("Expected 2 inputs with recursion, got %d", len(all))
+	}
+}
+
+func TestParseFilenameTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected time.Time
+		ok       bool
+	}{
+		{"IMG_20240615_143000.jpg", time.Date(2024, 6, 15, 14, 30, 0, 0, time.UTC), true},
+		{"2024-06-15 14.30.45.jpg", time.Date(2024, 6, 15, 14, 30, 45, 0, time.UTC), true},
+		{"PXL_20240615.jpg", time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), true},
+		{"IMG_0001.jpg", time.Time{}, false},
+		{"20240230.jpg", time.Time{}, false},
+	}
+
+	for _, tc := range tests {
+		got, ok := parseFilenameTime(tc.name, nil, time.UTC)
+		if ok != tc.ok || !got.Equal(tc.expected) {
+			t.Errorf("parseFilenameTime(%q): expected %v/%v, got %v/%v", tc.name, tc.expected, tc.ok, got, ok)
+		}
+	}
+}
+
+func TestScanDirectoryContextOrderingAndProgress(t *testing.T) {
+	dir := t.TempDir()
+	var expected []string
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("IMG_%04d.jpg", i)
+		writeTestFile(t, dir, name, []byte("jpg"))
+		expected = append(expected, name)
+	}
+	writeTestFile(t, dir, "readme.txt", []byte("text"))
+
+	var calls int
+	var last ScanProgress
+	result, err := ScanDirectoryContext(context.Background(), dir, &ScanOptions{
+		Workers: 8,
+		Progress: func(p ScanProgress) {
+			calls++
+			last = p
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan directory: %v", err)
+	}
+
+	if len(result.Inputs) != len(expected) {
+		t.Fatalf("Expected %d inputs, got %d", len(expected), len(result.Inputs))
+	}
+	for i, input := range result.Inputs {
+		if filepath.Base(input.FilePath) != expected[i] {
+			t.Fatalf("Expected deterministic order: position %d is %s, want %s", i, filepath.Base(input.FilePath), expected[i])
+		}
+	}
+
+	if result.Progress.FilesSeen != 41 || result.Progress.FilesMatched != 40 || result.Progress.FilesProcessed != 40 {
+		t.Errorf("Unexpected progress totals: %+v", result.Progress)
+	}
+	if result.Progress.Bytes != 120 {
+		t.Errorf("Expected 120 bytes, got %d", result.Progress.Bytes)
+	}
+	if calls == 0 || last != result.Progress {
+		t.Errorf("Expected progress callbacks ending with final totals, got %d calls, last %+v", calls, last)
+	}
+}
+
+func TestScanDirectoryContextCollectsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "good.jpg", []byte("jpg"))
+	if err := os.Symlink(filepath.Join(dir, "missing-target.jpg"), filepath.Join(dir, "broken.jpg")); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	result, err := ScanDirectoryContext(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to scan directory: %v", err)
+	}
+
+	if len(result.Inputs) != 1 {
+		t.Errorf("Expected 1 input, got %d", len(result.Inputs))
+	}
+	if len(result.Errors) != 1 {
+		t.Fatalf("Expected 1 scan error, got %d", len(result.Errors))
+	}
+	if filepath.Base(result.Errors[0].Path) != "broken.jpg" {
+		t.Errorf("Unexpected error path: %s", result.Errors[0].Path)
+	}
+	if result.Progress.Errors != 1 {
+		t.Errorf("Expected 1 error in progress, got %d", result.Progress.Errors)
+	}
+}
+
+func TestScanDirectoryContextCancelled(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.jpg", []byte("jpg"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := ScanDirectoryContext(ctx, dir, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if result == nil || len(result.Inputs) != 0 {
+		t.Error("Expected empty partial result")
+	}
+}
+
+func TestScanDirectoryContextMissingDir(t *testing.T) {
+	if _, err := ScanDirectoryContext(context.Background(), "/nonexistent/scan/dir", nil); err == nil {
+		t.Error("Expected error for missing directory")
+	}
+}
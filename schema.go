@@ -194,6 +194,42 @@ var schemaSQL = []string{
 		value
 	)`,
 
+	`CREATE TABLE AgInternedIptcCity (
+		id_local INTEGER PRIMARY KEY,
+		searchIndex,
+		value
+	)`,
+
+	`CREATE TABLE AgInternedIptcState (
+		id_local INTEGER PRIMARY KEY,
+		searchIndex,
+		value
+	)`,
+
+	`CREATE TABLE AgInternedIptcCountry (
+		id_local INTEGER PRIMARY KEY,
+		searchIndex,
+		value
+	)`,
+
+	`CREATE TABLE AgInternedIptcIsoCountryCode (
+		id_local INTEGER PRIMARY KEY,
+		searchIndex,
+		value
+	)`,
+
+	`CREATE TABLE AgInternedIptcLocation (
+		id_local INTEGER PRIMARY KEY,
+		searchIndex,
+		value
+	)`,
+
+	`CREATE TABLE AgInternedIptcJobIdentifier (
+		id_local INTEGER PRIMARY KEY,
+		searchIndex,
+		value
+	)`,
+
 	// Keywords tables
 	`CREATE TABLE AgLibraryKeyword (
 		id_local INTEGER PRIMARY KEY,
@@ -217,6 +253,13 @@ var schemaSQL = []string{
 		tag INTEGER NOT NULL DEFAULT 0
 	)`,
 
+	`CREATE TABLE AgLibraryKeywordSynonym (
+		id_local INTEGER PRIMARY KEY,
+		keyword INTEGER NOT NULL DEFAULT 0,
+		lc_name,
+		name
+	)`,
+
 	// Collections tables
 	`CREATE TABLE AgLibraryCollection (
 		id_local INTEGER PRIMARY KEY,
@@ -409,11 +452,25 @@ var schemaSQL = []string{
 	`CREATE INDEX idx_AgHarvestedExifMetadata_image ON AgHarvestedExifMetadata (image)`,
 	`CREATE INDEX idx_AgLibraryKeywordImage_image ON AgLibraryKeywordImage (image)`,
 	`CREATE INDEX idx_AgLibraryKeywordImage_tag ON AgLibraryKeywordImage (tag)`,
+	`CREATE INDEX idx_AgLibraryKeywordSynonym_keyword ON AgLibraryKeywordSynonym (keyword)`,
 	`CREATE INDEX idx_AgLibraryCollectionImage_collection ON AgLibraryCollectionImage (collection)`,
 	`CREATE INDEX idx_AgLibraryCollectionImage_image ON AgLibraryCollectionImage (image)`,
 	`CREATE INDEX idx_Adobe_AdditionalMetadata_image ON Adobe_AdditionalMetadata (image)`,
 }
 
+// schemaUpgrades creates tables that older catalogs written by this library
+// may be missing. They are applied when a catalog is opened for writing.
+var schemaUpgrades = []string{
+	`CREATE TABLE IF NOT EXISTS AgInternedIptcCity (id_local INTEGER PRIMARY KEY, searchIndex, value)`,
+	`CREATE TABLE IF NOT EXISTS AgInternedIptcState (id_local INTEGER PRIMARY KEY, searchIndex, value)`,
+	`CREATE TABLE IF NOT EXISTS AgInternedIptcCountry (id_local INTEGER PRIMARY KEY, searchIndex, value)`,
+	`CREATE TABLE IF NOT EXISTS AgInternedIptcIsoCountryCode (id_local INTEGER PRIMARY KEY, searchIndex, value)`,
+	`CREATE TABLE IF NOT EXISTS AgInternedIptcLocation (id_local INTEGER PRIMARY KEY, searchIndex, value)`,
+	`CREATE TABLE IF NOT EXISTS AgInternedIptcJobIdentifier (id_local INTEGER PRIMARY KEY, searchIndex, value)`,
+	`CREATE TABLE IF NOT EXISTS AgLibraryKeywordSynonym (id_local INTEGER PRIMARY KEY, keyword INTEGER NOT NULL DEFAULT 0, lc_name, name)`,
+	`CREATE INDEX IF NOT EXISTS idx_AgLibraryKeywordSynonym_keyword ON AgLibraryKeywordSynonym (keyword)`,
+}
+
 var requiredVariables = map[string]string{
 	"Adobe_DBVersion":            schemaVersion,
 	"AgLibraryKeyword_rootTagID": "",
@@ -0,0 +1,178 @@
+package lrcat
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ListImports returns all import sessions, most recent first
+func (c *Catalog) ListImports() ([]*ImportSession, error) {
+	rows, err := c.db.Query(
+		`SELECT id_local, importDate, imageCount, name FROM AgLibraryImport
+		 ORDER BY importDate DESC, id_local DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*ImportSession
+	for rows.Next() {
+		session, err := scanImportSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// GetImport retrieves an import session by its ID
+func (c *Catalog) GetImport(importID int64) (*ImportSession, error) {
+	session, err := scanImportSession(c.db.QueryRow(
+		`SELECT id_local, importDate, imageCount, name FROM AgLibraryImport WHERE id_local = ?`,
+		importID,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("import not found: %d", importID)
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetLastImport returns the most recent import session, like Lightroom's
+// "Previous Import" source, or nil if the catalog has no imports
+func (c *Catalog) GetLastImport() (*ImportSession, error) {
+	session, err := scanImportSession(c.db.QueryRow(
+		`SELECT id_local, importDate, imageCount, name FROM AgLibraryImport
+		 ORDER BY importDate DESC, id_local DESC LIMIT 1`,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return session, err
+}
+
+// scanImportSession reads an AgLibraryImport row
+func scanImportSession(row interface{ Scan(...interface{}) error }) (*ImportSession, error) {
+	session := &ImportSession{}
+	var importDate, name sql.NullString
+	var imageCount sql.NullInt64
+	if err := row.Scan(&session.ID, &importDate, &imageCount, &name); err != nil {
+		return nil, err
+	}
+	if importDate.Valid {
+		session.ImportDate, _ = parseTime(importDate.String)
+	}
+	session.ImageCount = int(imageCount.Int64)
+	session.Name = name.String
+	return session, nil
+}
+
+// GetImportImages returns the images added by an import session
+func (c *Catalog) GetImportImages(importID int64) ([]*Image, error) {
+	rows, err := c.db.Query(
+		`SELECT i.id_local, i.id_global, i.rootFile, i.captureTime, i.rating, i.colorLabels, i.pick,
+		        i.fileFormat, i.fileWidth, i.fileHeight, i.orientation
+		 FROM Adobe_images i
+		 JOIN AgLibraryImportImage ii ON i.id_local = ii.image
+		 WHERE ii.import = ?
+		 ORDER BY i.id_local`,
+		importID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*Image
+	for rows.Next() {
+		img := &Image{}
+		var captureTimeStr sql.NullString
+		var rating sql.NullInt64
+		var width, height, orientation sql.NullInt64
+
+		if err := rows.Scan(&img.ID, &img.UUID, &img.FileID, &captureTimeStr, &rating, &img.ColorLabel, &img.Pick,
+			&img.FileFormat, &width, &height, &orientation); err != nil {
+			return nil, err
+		}
+
+		if captureTimeStr.Valid {
+			img.CaptureTime, _ = parseTime(captureTimeStr.String)
+		}
+		if rating.Valid {
+			r := int(rating.Int64)
+			img.Rating = &r
+		}
+		if width.Valid {
+			w := int(width.Int64)
+			img.Width = &w
+		}
+		if height.Valid {
+			h := int(height.Int64)
+			img.Height = &h
+		}
+		if orientation.Valid {
+			o := int(orientation.Int64)
+			img.Orientation = &o
+		}
+
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+// UndoImport removes the images added by an import session, together with
+// their keywords, collection memberships and metadata, and then the session
+// itself. Images from other imports are untouched. Files on disk are not
+// deleted, including copies made by ImportModeCopy or ImportModeMove.
+func (c *Catalog) UndoImport(importID int64) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM AgLibraryImport WHERE id_local = ?`, importID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("import not found: %d", importID)
+	}
+
+	rows, err := tx.Query(`SELECT DISTINCT image FROM AgLibraryImportImage WHERE import = ?`, importID)
+	if err != nil {
+		return err
+	}
+	var imageIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		imageIDs = append(imageIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range imageIDs {
+		if err := c.removeImage(tx, id); err != nil {
+			return fmt.Errorf("failed to remove image %d: %w", id, err)
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM AgLibraryImportImage WHERE import = ?`, importID); err != nil {
+		return fmt.Errorf("failed to delete import: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM AgLibraryImport WHERE id_local = ?`, importID); err != nil {
+		return fmt.Errorf("failed to delete import: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,141 @@
+package lrcat
+
+import (
+	"testing"
+)
+
+func TestListImports(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	first, _, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: "/photos/a.jpg"},
+	}, &ImportOptions{SessionName: "Card 1"})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	second, _, err := catalog.AddImages([]*ImageInput{
+		{FilePath: "/photos/b.jpg"},
+		{FilePath: "/photos/c.jpg"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	sessions, err := catalog.ListImports()
+	if err != nil {
+		t.Fatalf("Failed to list imports: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 imports, got %d", len(sessions))
+	}
+	if sessions[0].ID != second.ID || sessions[1].ID != first.ID {
+		t.Errorf("Expected most recent import first, got %d, %d", sessions[0].ID, sessions[1].ID)
+	}
+	if sessions[1].Name != "Card 1" || sessions[0].Name != "" {
+		t.Errorf("Unexpected names: %q, %q", sessions[0].Name, sessions[1].Name)
+	}
+	if sessions[0].ImageCount != 2 || sessions[0].ImportDate.IsZero() {
+		t.Errorf("Unexpected session: %+v", sessions[0])
+	}
+
+	last, err := catalog.GetLastImport()
+	if err != nil {
+		t.Fatalf("Failed to get last import: %v", err)
+	}
+	if last.ID != second.ID {
+		t.Errorf("Expected last import %d, got %d", second.ID, last.ID)
+	}
+}
+
+func TestGetImport(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	last, err := catalog.GetLastImport()
+	if err != nil || last != nil {
+		t.Errorf("Expected no last import in an empty catalog, got %v, %v", last, err)
+	}
+
+	session, images, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: "/photos/a.jpg"},
+		{FilePath: "/photos/b.jpg"},
+	}, &ImportOptions{SessionName: "Wedding"})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	got, err := catalog.GetImport(session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get import: %v", err)
+	}
+	if got.Name != "Wedding" || got.ImageCount != 2 {
+		t.Errorf("Unexpected import: %+v", got)
+	}
+
+	importImages, err := catalog.GetImportImages(session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get import images: %v", err)
+	}
+	if len(importImages) != 2 || importImages[0].ID != images[0].ID {
+		t.Errorf("Expected the 2 imported images, got %d", len(importImages))
+	}
+
+	if _, err := catalog.GetImport(99999); err == nil {
+		t.Error("Expected error for missing import")
+	}
+}
+
+func TestUndoImport(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	keep, _, err := catalog.AddImages([]*ImageInput{{FilePath: "/photos/keep.jpg"}})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	bad, images, err := catalog.AddImagesWithOptions([]*ImageInput{
+		{FilePath: "/photos/bad1.jpg"},
+		{FilePath: "/photos/bad2.jpg"},
+	}, &ImportOptions{Preset: &ImportPreset{Keywords: []string{"Oops"}, Collection: "Ingest"}})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	if err := catalog.UndoImport(bad.ID); err != nil {
+		t.Fatalf("Failed to undo import: %v", err)
+	}
+
+	count, _ := catalog.ImageCount()
+	if count != 1 {
+		t.Errorf("Expected 1 image after undo, got %d", count)
+	}
+	if _, err := catalog.GetImage(images[0].ID); err == nil {
+		t.Error("Expected undone image to be removed")
+	}
+	if _, err := catalog.GetImport(bad.ID); err == nil {
+		t.Error("Expected undone import to be removed")
+	}
+	if got, err := catalog.GetImport(keep.ID); err != nil || got.ImageCount != 1 {
+		t.Errorf("Expected other import to be untouched, got %+v, %v", got, err)
+	}
+
+	collection, _ := catalog.GetOrCreateCollectionPath("Ingest")
+	if collection.ImageCount == nil || *collection.ImageCount != 0 {
+		t.Errorf("Expected empty collection after undo, got %v", collection.ImageCount)
+	}
+	keyword, _ := catalog.GetKeywordByName("Oops")
+	if kwImages, _ := catalog.GetKeywordImages(keyword.ID); len(kwImages) != 0 {
+		t.Errorf("Expected no images with keyword after undo, got %d", len(kwImages))
+	}
+
+	var files int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryFile`).Scan(&files)
+	if files != 1 {
+		t.Errorf("Expected 1 file record after undo, got %d", files)
+	}
+
+	if err := catalog.UndoImport(bad.ID); err == nil {
+		t.Error("Expected error undoing a missing import")
+	}
+}
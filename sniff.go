@@ -0,0 +1,327 @@
+package lrcat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// sniffHeaderSize is the number of leading bytes examined by SniffFileType
+const sniffHeaderSize = 512
+
+// tagDNGVersion marks a TIFF structure as DNG
+const tagDNGVersion = 0xC612
+
+// Tags and values that identify IFDs holding sensor data
+const (
+	tagPhotometricInterpretation = 0x0106
+	tagCFAPattern                = 0x828E
+	photometricCFA               = 32803
+	photometricLinearRaw         = 34892
+)
+
+// tiffMakeExtensions maps the IFD0 Make of TIFF-based raw files to their
+// extension. The Make alone is not enough: scanners and cameras write plain
+// TIFFs with the same Make, so sniffTIFF also requires sensor data.
+var tiffMakeExtensions = []struct {
+	prefix string
+	ext    string
+}{
+	{"NIKON", "nef"},
+	{"SONY", "arw"},
+	{"PENTAX", "pef"},
+	{"RICOH", "pef"},
+	{"SAMSUNG", "srw"},
+	{"HASSELBLAD", "3fr"},
+	{"PHASE ONE", "iiq"},
+	{"LEAF", "mos"},
+	{"KODAK", "dcr"},
+	{"EASTMAN KODAK", "dcr"},
+	{"SEIKO EPSON", "erf"},
+	{"MAMIYA", "mef"},
+	{"LEICA", "rwl"},
+	{"CANON", "cr2"},
+}
+
+// isoBMFFBrands maps ISO base media file format brands to extensions
+var isoBMFFBrands = map[string]string{
+	"crx ": "cr3",
+	"heic": "heic", "heix": "heic", "heim": "heic", "heis": "heic", "hevc": "heic", "hevx": "heic",
+	"mif1": "heif", "msf1": "heif",
+	"avif": "avif", "avis": "avif",
+	"qt  ": "mov",
+	"M4V ": "m4v", "M4VH": "m4v", "M4VP": "m4v",
+	"3gp4": "3gp", "3gp5": "3gp", "3gp6": "3gp", "3g2a": "3gp",
+	"isom": "mp4", "iso2": "mp4", "iso4": "mp4", "iso5": "mp4", "iso6": "mp4",
+	"mp41": "mp4", "mp42": "mp4", "avc1": "mp4", "dash": "mp4", "MSNV": "mp4",
+}
+
+// FormatMismatch reports a file whose content does not match its extension
+type FormatMismatch struct {
+	Path string
+	// Extension is the file's extension without the dot
+	Extension string
+	// ExtensionFormat is the Lightroom format registered for the extension,
+	// or empty if the extension is unknown
+	ExtensionFormat string
+	// Detected is the file type identified from the content
+	Detected FileType
+}
+
+// Error implements the error interface so mismatches can be reported as warnings
+func (m *FormatMismatch) Error() string {
+	if m.ExtensionFormat == "" {
+		return fmt.Sprintf("%s: unknown extension %q, content is %s (%s)", m.Path, m.Extension, m.Detected.Extension, m.Detected.Format)
+	}
+	return fmt.Sprintf("%s: extension %q suggests %s but content is %s (%s)",
+		m.Path, m.Extension, m.ExtensionFormat, m.Detected.Extension, m.Detected.Format)
+}
+
+// SniffFile identifies the type of the file at path from its content
+func SniffFile(path string) (FileType, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileType{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return FileType{}, err
+	}
+	ft, err := SniffFileType(f, info.Size())
+	if err != nil {
+		return FileType{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return ft, nil
+}
+
+// SniffFileType identifies a file from its magic bytes and returns the
+// registered FileType for it. ErrUnknownFileType is returned if the content
+// is not recognized or the detected type is not registered.
+func SniffFileType(r io.ReaderAt, size int64) (FileType, error) {
+	ext := sniffExtension(r, size)
+	if ext == "" {
+		return FileType{}, ErrUnknownFileType
+	}
+	ft, ok := LookupFileType(ext)
+	if !ok {
+		return FileType{}, fmt.Errorf("%w: .%s", ErrUnknownFileType, ext)
+	}
+	return ft, nil
+}
+
+// DetectFileType determines a file's type from its content, falling back to
+// the extension when the content is not recognized. If both are known and
+// their Lightroom formats differ, the content wins and a *FormatMismatch is
+// returned alongside the detected type.
+func DetectFileType(path string) (FileType, *FormatMismatch, error) {
+	ext := strings.ToLower(fileExtension(path))
+	byExt, extKnown := LookupFileType(ext)
+
+	sniffed, err := SniffFile(path)
+	if err != nil {
+		if extKnown {
+			return byExt, nil, nil
+		}
+		return FileType{}, nil, fmt.Errorf("%w: %s", ErrUnknownFileType, path)
+	}
+
+	if extKnown && byExt.Format == sniffed.Format && byExt.Raw == sniffed.Raw {
+		return byExt, nil, nil
+	}
+	mismatch := &FormatMismatch{Path: path, Extension: ext, Detected: sniffed}
+	if extKnown {
+		mismatch.ExtensionFormat = byExt.Format
+	}
+	return sniffed, mismatch, nil
+}
+
+// sniffExtension returns the canonical extension for the content of r, or ""
+func sniffExtension(r io.ReaderAt, size int64) string {
+	header := make([]byte, sniffHeaderSize)
+	n, _ := r.ReadAt(header, 0)
+	header = header[:n]
+	if len(header) < 4 {
+		return ""
+	}
+
+	hasPrefix := func(prefix string) bool { return bytes.HasPrefix(header, []byte(prefix)) }
+	at := func(offset int, s string) bool {
+		return len(header) >= offset+len(s) && string(header[offset:offset+len(s)]) == s
+	}
+
+	switch {
+	case hasPrefix("\xFF\xD8\xFF"):
+		return "jpg"
+	case hasPrefix("\x89PNG\r\n\x1A\n"):
+		return "png"
+	case hasPrefix("8BPS"):
+		if len(header) >= 6 && binary.BigEndian.Uint16(header[4:6]) == 2 {
+			return "psb"
+		}
+		return "psd"
+	case hasPrefix("FUJIFILMCCD-RAW"):
+		return "raf"
+	case hasPrefix("FOVb"):
+		return "x3f"
+	case hasPrefix("\x00MRM"):
+		return "mrw"
+	case hasPrefix("II\x1A\x00\x00\x00HEAPCCDR"):
+		return "crw"
+	case hasPrefix("IIII"):
+		return "iiq"
+	case hasPrefix("IIRO"), hasPrefix("IIRS"), hasPrefix("MMOR"):
+		return "orf"
+	case hasPrefix("IIU\x00"):
+		return "rw2"
+	case hasPrefix("II*\x00"), hasPrefix("MM\x00*"):
+		return sniffTIFF(r, size, header)
+	case hasPrefix("\xFF\x0A"), hasPrefix("\x00\x00\x00\x0CJXL \r\n\x87\n"):
+		return "jxl"
+	case at(4, "ftyp"):
+		return sniffISOBMFF(header)
+	case hasPrefix("RIFF") && at(8, "AVI "):
+		return "avi"
+	case hasPrefix("\x1A\x45\xDF\xA3"):
+		return "mkv"
+	case hasPrefix("\x00\x00\x01\xBA"):
+		return "mpg"
+	case hasPrefix("\x30\x26\xB2\x75\x8E\x66\xCF\x11"):
+		return "wmv"
+	case len(header) > 188 && header[0] == 0x47 && header[188] == 0x47:
+		return "mts"
+	case len(header) > 196 && header[4] == 0x47 && header[196] == 0x47:
+		return "m2ts"
+	}
+	return ""
+}
+
+// sniffTIFF distinguishes DNG and TIFF-based raw formats from plain TIFF
+func sniffTIFF(r io.ReaderAt, size int64, header []byte) string {
+	// Canon CR2 stores "CR" and major version 2 right after the TIFF header
+	if len(header) >= 11 && header[8] == 'C' && header[9] == 'R' && header[10] == 2 {
+		return "cr2"
+	}
+
+	tr := &tiffReader{r: io.NewSectionReader(r, 0, size), visited: make(map[uint32]bool)}
+	if header[0] == 'I' {
+		tr.order = binary.LittleEndian
+	} else {
+		tr.order = binary.BigEndian
+	}
+	if len(header) < 8 {
+		return "tif"
+	}
+	ifd0 := tr.order.Uint32(header[4:8])
+	entries, err := tr.readIFD(ifd0)
+	if err != nil {
+		return "tif"
+	}
+
+	var cameraMake string
+	for _, e := range entries {
+		switch e.tag {
+		case tagDNGVersion:
+			return "dng"
+		case tagMake:
+			cameraMake = strings.ToUpper(tr.asciiValue(e))
+		}
+	}
+	for _, m := range tiffMakeExtensions {
+		if cameraMake != "" && strings.HasPrefix(cameraMake, m.prefix) {
+			// Canon TIFFs without the CR2 marker are regular TIFF exports
+			if m.ext == "cr2" || !tr.holdsSensorData(ifd0, entries, 0) {
+				break
+			}
+			return m.ext
+		}
+	}
+	return "tif"
+}
+
+// holdsSensorData reports whether the IFD at offset, an IFD following it or
+// one of their sub-IFDs stores a CFA or linear raw image rather than a
+// rendered one
+func (tr *tiffReader) holdsSensorData(offset uint32, entries []tiffEntry, depth int) bool {
+	for {
+		for _, e := range entries {
+			switch e.tag {
+			case tagCFAPattern:
+				return true
+			case tagPhotometricInterpretation:
+				if v, ok := tr.intValue(e); ok && (v == photometricCFA || v == photometricLinearRaw) {
+					return true
+				}
+			case tagSubIFDs:
+				if depth >= 2 {
+					continue
+				}
+				for i := 0; i < int(e.count); i++ {
+					sub, ok := tr.uintAt(e, i)
+					if !ok {
+						break
+					}
+					if subEntries, err := tr.readIFD(sub); err == nil && tr.holdsSensorData(sub, subEntries, depth+1) {
+						return true
+					}
+				}
+			}
+		}
+
+		next := tr.nextIFDOffset(offset)
+		var err error
+		if entries, err = tr.readIFD(next); err != nil {
+			return false
+		}
+		offset = next
+	}
+}
+
+// nextIFDOffset returns the offset of the IFD following the one at offset, or 0
+func (tr *tiffReader) nextIFDOffset(offset uint32) uint32 {
+	buf := make([]byte, 4)
+	if _, err := tr.r.ReadAt(buf[:2], int64(offset)); err != nil {
+		return 0
+	}
+	count := int64(tr.order.Uint16(buf[:2]))
+	if _, err := tr.r.ReadAt(buf, int64(offset)+2+count*12); err != nil {
+		return 0
+	}
+	return tr.order.Uint32(buf)
+}
+
+// sniffISOBMFF identifies an ISO base media file (MP4, MOV, HEIF, AVIF, CR3)
+// from its major and compatible brands
+func sniffISOBMFF(header []byte) string {
+	if len(header) < 12 {
+		return ""
+	}
+	boxSize := int(binary.BigEndian.Uint32(header[0:4]))
+	if boxSize < 16 || boxSize > len(header) {
+		boxSize = len(header)
+	}
+
+	brands := []string{string(header[8:12])}
+	for i := 16; i+4 <= boxSize; i += 4 {
+		brands = append(brands, string(header[i:i+4]))
+	}
+
+	// Still-image brands take precedence over the generic mif1/isom brands
+	for _, preferred := range []string{"crx ", "avif", "avis", "heic", "heix"} {
+		for _, brand := range brands {
+			if brand == preferred {
+				return isoBMFFBrands[brand]
+			}
+		}
+	}
+	for _, brand := range brands {
+		if ext, ok := isoBMFFBrands[brand]; ok {
+			return ext
+		}
+	}
+	return ""
+}
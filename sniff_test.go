@@ -0,0 +1,191 @@
+package lrcat
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSniffFileType(t *testing.T) {
+	ftyp := func(major string, compatible ...string) []byte {
+		box := []byte{0, 0, 0, byte(16 + 4*len(compatible)), 'f', 't', 'y', 'p'}
+		box = append(box, major...)
+		box = append(box, 0, 0, 0, 0)
+		for _, brand := range compatible {
+			box = append(box, brand...)
+		}
+		return box
+	}
+	tiffWithMake := func(cameraMake string) []byte {
+		return buildTestTIFF(&testIFD{entries: []testIFDEntry{{tagMake, 2, cameraMake}}})
+	}
+	// Raw files keep the sensor data as a CFA image, in IFD0 or a sub-IFD
+	rawWithMake := func(cameraMake string) []byte {
+		return buildTestTIFF(&testIFD{entries: []testIFDEntry{
+			{tagMake, 2, cameraMake},
+			{tagSubIFDs, 4, &testIFD{entries: []testIFDEntry{
+				{tagPhotometricInterpretation, 3, []uint16{photometricCFA}},
+			}}},
+		}})
+	}
+	cr2 := tiffWithMake("Canon")
+	copy(cr2[8:], "CR\x02\x00")
+	transportStream := make([]byte, 200)
+	transportStream[0], transportStream[188] = 0x47, 0x47
+
+	tests := []struct {
+		name string
+		data []byte
+		ext  string
+	}{
+		{"jpeg", buildTestJPEG(buildTestTIFF(sampleEXIFIFD()), 10, 10), "jpg"},
+		{"png", []byte("\x89PNG\r\n\x1A\n\x00\x00\x00\x0DIHDR"), "png"},
+		{"psd", []byte("8BPS\x00\x01\x00\x00"), "psd"},
+		{"psb", []byte("8BPS\x00\x02\x00\x00"), "psb"},
+		{"tiff", tiffWithMake("Scanner Co"), "tif"},
+		{"dng", buildTestTIFF(&testIFD{entries: []testIFDEntry{{tagMake, 2, "Canon"}, {tagDNGVersion, 1, "\x01\x04\x00"}}}), "dng"},
+		{"cr2", cr2, "cr2"},
+		{"canon tiff", tiffWithMake("Canon"), "tif"},
+		{"nef", rawWithMake("NIKON CORPORATION"), "nef"},
+		{"arw", rawWithMake("SONY"), "arw"},
+		{"pef", buildTestTIFF(&testIFD{entries: []testIFDEntry{
+			{tagMake, 2, "PENTAX"}, {tagPhotometricInterpretation, 3, []uint16{photometricCFA}},
+		}}), "pef"},
+		{"epson scanner tiff", tiffWithMake("SEIKO EPSON"), "tif"},
+		{"nikon camera tiff", buildTestTIFF(&testIFD{entries: []testIFDEntry{
+			{tagMake, 2, "NIKON CORPORATION"}, {tagPhotometricInterpretation, 3, []uint16{2}},
+		}}), "tif"},
+		{"orf", []byte("IIRO\x08\x00\x00\x00"), "orf"},
+		{"rw2", []byte("IIU\x00\x08\x00\x00\x00"), "rw2"},
+		{"raf", []byte("FUJIFILMCCD-RAW 0201FF383501"), "raf"},
+		{"crw", []byte("II\x1A\x00\x00\x00HEAPCCDR"), "crw"},
+		{"x3f", []byte("FOVb\x00\x00\x02\x00"), "x3f"},
+		{"cr3", ftyp("crx ", "crx ", "isom"), "cr3"},
+		{"heic", ftyp("heic", "mif1", "heic"), "heic"},
+		{"heif", ftyp("mif1", "mif1"), "heif"},
+		{"avif", ftyp("mif1", "avif", "mif1", "miaf"), "avif"},
+		{"mov", ftyp("qt  ", "qt  "), "mov"},
+		{"mp4", ftyp("isom", "isom", "mp41"), "mp4"},
+		{"jxl codestream", []byte("\xFF\x0A\x00\x00"), "jxl"},
+		{"jxl container", []byte("\x00\x00\x00\x0CJXL \r\n\x87\n"), "jxl"},
+		{"avi", []byte("RIFF\x00\x00\x00\x00AVI LIST"), "avi"},
+		{"mkv", []byte("\x1A\x45\xDF\xA3\x00\x00"), "mkv"},
+		{"mts", transportStream, "mts"},
+	}
+
+	for _, tc := range tests {
+		ft, err := SniffFileType(bytes.NewReader(tc.data), int64(len(tc.data)))
+		if err != nil {
+			t.Errorf("%s: SniffFileType failed: %v", tc.name, err)
+			continue
+		}
+		if ft.Extension != tc.ext {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.ext, ft.Extension)
+		}
+	}
+
+	if _, err := SniffFileType(bytes.NewReader([]byte("plain text")), 10); !errors.Is(err, ErrUnknownFileType) {
+		t.Errorf("Expected ErrUnknownFileType for text, got %v", err)
+	}
+}
+
+func TestDetectFileType(t *testing.T) {
+	dir := t.TempDir()
+	jpeg := buildTestJPEG(buildTestTIFF(sampleEXIFIFD()), 10, 10)
+	dng := buildTestTIFF(&testIFD{entries: []testIFDEntry{{tagDNGVersion, 1, "\x01\x04\x00"}}})
+
+	// Matching extension and content
+	ft, mismatch, err := DetectFileType(writeTestFile(t, dir, "a.jpeg", jpeg))
+	if err != nil || mismatch != nil || ft.Extension != "jpeg" {
+		t.Errorf("Expected jpeg without mismatch, got %+v %v %v", ft, mismatch, err)
+	}
+
+	// Raw content behind a JPEG extension
+	path := writeTestFile(t, dir, "b.jpg", dng)
+	ft, mismatch, err = DetectFileType(path)
+	if err != nil {
+		t.Fatalf("DetectFileType failed: %v", err)
+	}
+	if ft.Format != FileFormatDNG || !ft.Raw {
+		t.Errorf("Expected DNG, got %+v", ft)
+	}
+	if mismatch == nil || mismatch.ExtensionFormat != FileFormatJPG || mismatch.Path != path {
+		t.Errorf("Expected a JPG/DNG mismatch, got %+v", mismatch)
+	}
+
+	// Missing extension
+	ft, mismatch, err = DetectFileType(writeTestFile(t, dir, "IMG_0001", jpeg))
+	if err != nil || ft.Format != FileFormatJPG {
+		t.Errorf("Expected JPG for extensionless file, got %+v %v", ft, err)
+	}
+	if mismatch == nil || mismatch.ExtensionFormat != "" {
+		t.Errorf("Expected a mismatch for the missing extension, got %+v", mismatch)
+	}
+
+	// A scanner TIFF with a camera maker's Make stays a TIFF
+	scan := buildTestTIFF(&testIFD{entries: []testIFDEntry{{tagMake, 2, "SEIKO EPSON"}}})
+	ft, mismatch, err = DetectFileType(writeTestFile(t, dir, "scan.tif", scan))
+	if err != nil || mismatch != nil || ft.Raw || ft.Extension != "tif" {
+		t.Errorf("Expected a plain TIFF, got %+v %v %v", ft, mismatch, err)
+	}
+
+	// Unrecognized content falls back to the extension
+	ft, mismatch, err = DetectFileType(writeTestFile(t, dir, "c.nef", []byte("truncated")))
+	if err != nil || mismatch != nil || ft.Extension != "nef" {
+		t.Errorf("Expected extension fallback, got %+v %v %v", ft, mismatch, err)
+	}
+
+	if _, _, err := DetectFileType(writeTestFile(t, dir, "notes.txt", []byte("hello"))); !errors.Is(err, ErrUnknownFileType) {
+		t.Errorf("Expected ErrUnknownFileType, got %v", err)
+	}
+}
+
+func TestImportDetectContent(t *testing.T) {
+	catalog := createTestCatalog(t)
+	dir := t.TempDir()
+
+	dngAsJPG := writeTestFile(t, dir, "client.jpg", buildTestTIFF(&testIFD{entries: []testIFDEntry{
+		{tagMake, 2, "Canon"}, {tagDNGVersion, 1, "\x01\x04\x00"},
+	}}))
+	noExt := writeTestFile(t, dir, "IMG_0002", buildTestJPEG(buildTestTIFF(sampleEXIFIFD()), 10, 10))
+
+	var warnings []error
+	_, images, err := catalog.AddImagesWithOptions(
+		[]*ImageInput{{FilePath: dngAsJPG}, {FilePath: noExt}},
+		&ImportOptions{DetectContent: true, OnWarning: func(err error) { warnings = append(warnings, err) }},
+	)
+	if err != nil {
+		t.Fatalf("AddImagesWithOptions failed: %v", err)
+	}
+
+	if images[0].FileFormat != FileFormatDNG {
+		t.Errorf("Expected DNG, got %s", images[0].FileFormat)
+	}
+	var isRaw int
+	catalog.DB().QueryRow(`SELECT isRawFile FROM Adobe_AdditionalMetadata WHERE image = ?`, images[0].ID).Scan(&isRaw)
+	if isRaw != 1 {
+		t.Error("Expected isRawFile to be set for DNG content")
+	}
+
+	if images[1].FileFormat != FileFormatJPG {
+		t.Errorf("Expected JPG, got %s", images[1].FileFormat)
+	}
+	var model string
+	catalog.DB().QueryRow(
+		`SELECT COALESCE(m.value, '') FROM AgHarvestedExifMetadata e
+		 LEFT JOIN AgInternedExifCameraModel m ON e.cameraModelRef = m.id_local
+		 WHERE e.image = ?`, images[1].ID,
+	).Scan(&model)
+	if model == "" {
+		t.Error("Expected EXIF to be harvested from the extensionless file")
+	}
+
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	var mismatch *FormatMismatch
+	if !errors.As(warnings[0], &mismatch) || filepath.Base(mismatch.Path) != "client.jpg" {
+		t.Errorf("Expected a mismatch for client.jpg, got %v", warnings[0])
+	}
+}
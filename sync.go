@@ -0,0 +1,509 @@
+package lrcat
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MissingFilePolicy controls what SyncFolder does with catalog files that are no longer on disk
+type MissingFilePolicy int
+
+const (
+	// MissingFileMark records the file as missing in AgLibraryFile.errorMessage
+	MissingFileMark MissingFilePolicy = iota
+	// MissingFileRemove removes the images of missing files from the catalog
+	MissingFileRemove
+	// MissingFileIgnore only reports missing files
+	MissingFileIgnore
+)
+
+// missingFileMessage is the AgLibraryFile.errorMessage recorded for missing files
+const missingFileMessage = "File not found"
+
+// SyncOptions controls how SyncFolder reconciles a folder with the filesystem
+type SyncOptions struct {
+	// Recursive includes subfolders, both in the catalog and on disk
+	Recursive bool
+	// SkipNew reports files that are not in the catalog without importing them
+	SkipNew bool
+	// Missing controls what happens to catalog files that are no longer on disk
+	Missing MissingFilePolicy
+	// DryRun reports the changes without modifying the catalog
+	DryRun bool
+	// Scan controls how metadata of new and changed files is read.
+	// Recursive and Workers are ignored.
+	Scan *ScanOptions
+	// Preset, if set, is applied to newly imported files
+	Preset *ImportPreset
+}
+
+// SyncChange identifies a file affected by SyncFolder
+type SyncChange struct {
+	Path string
+	// ImageID is 0 for new files that were not imported (dry run or SkipNew)
+	ImageID int64
+}
+
+// SyncResult summarizes what SyncFolder found and did
+type SyncResult struct {
+	// Added lists files on disk that were not in the catalog
+	Added []SyncChange
+	// Changed lists files whose modification time or size differs from the catalog;
+	// their metadata is read again
+	Changed []SyncChange
+	// Missing lists catalog files that are no longer on disk
+	Missing []SyncChange
+	// Removed lists missing files removed from the catalog (MissingFileRemove)
+	Removed []SyncChange
+	// Found lists files previously marked missing that are back on disk
+	Found []SyncChange
+	// Unchanged is the number of files that match the catalog
+	Unchanged int
+	// Errors lists files and directories that could not be read
+	Errors []*ScanError
+	// Session is the import session of the added files, if any were imported
+	Session *ImportSession
+	// DryRun reports that the catalog was not modified
+	DryRun bool
+}
+
+// fileFingerprint is the modification time and size recorded for a file,
+// used to detect files changed outside Lightroom
+type fileFingerprint struct {
+	modTime float64
+	size    int64
+}
+
+// newFileFingerprint returns the fingerprint of a file on disk
+func newFileFingerprint(info os.FileInfo) fileFingerprint {
+	return fileFingerprint{modTime: ToLightroomTimestamp(info.ModTime()), size: info.Size()}
+}
+
+// importHash formats the fingerprint like Lightroom's AgLibraryFile.importHash
+// ("<date>#<size>")
+func (f fileFingerprint) importHash() string {
+	return fmt.Sprintf("%s#%d", FromLightroomTimestamp(f.modTime).UTC().Format("20060102_150405"), f.size)
+}
+
+// importHashSize extracts the file size from an importHash; ok is false if there is none
+func importHashSize(hash string) (size int64, ok bool) {
+	i := strings.LastIndexByte(hash, '#')
+	if i == -1 {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(hash[i+1:], 10, 64)
+	return size, err == nil
+}
+
+// syncFile is a catalog file within the synchronized folder
+type syncFile struct {
+	fileID       int64
+	imageID      int64
+	modTime      sql.NullFloat64
+	importHash   sql.NullString
+	errorMessage sql.NullString
+}
+
+// changedOnDisk reports whether info differs from the recorded fingerprint.
+// Files without a recorded fingerprint are never reported as changed.
+func (f *syncFile) changedOnDisk(info os.FileInfo) bool {
+	if !f.modTime.Valid {
+		return false
+	}
+	fp := newFileFingerprint(info)
+	if math.Abs(fp.modTime-f.modTime.Float64) > 0.001 {
+		return true
+	}
+	if size, ok := importHashSize(f.importHash.String); ok && size != fp.size {
+		return true
+	}
+	return false
+}
+
+// SyncFolderPath synchronizes the catalog folder at the given absolute path.
+// See SyncFolder.
+func (c *Catalog) SyncFolderPath(path string, opts *SyncOptions) (*SyncResult, error) {
+	path = normalizePath(path)
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	var folderID int64
+	err := c.db.QueryRow(
+		`SELECT fo.id_local FROM AgLibraryFolder fo
+		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+		 WHERE rf.absolutePath || fo.pathFromRoot = ?`,
+		c.catalogPath(path),
+	).Scan(&folderID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("folder not found: %s", path)
+		}
+		return nil, err
+	}
+	return c.SyncFolder(folderID, opts)
+}
+
+// SyncFolder reconciles a catalog folder with the filesystem, like Lightroom's
+// "Synchronize Folder". Files on disk that are not in the catalog are imported
+// into a new import session, catalog files missing on disk are handled according
+// to opts.Missing, and files whose modification time or size changed have their
+// metadata read again. All catalog changes are made in a single transaction.
+func (c *Catalog) SyncFolder(folderID int64, opts *SyncOptions) (*SyncResult, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	scanOpts := syncScanOptions(opts.Scan)
+
+	var rootID int64
+	var rootPath, pathFromRoot string
+	var relativePath sql.NullString
+	err := c.db.QueryRow(
+		`SELECT fo.rootFolder, rf.absolutePath, rf.relativePathFromCatalog, fo.pathFromRoot FROM AgLibraryFolder fo
+		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+		 WHERE fo.id_local = ?`,
+		folderID,
+	).Scan(&rootID, &rootPath, &relativePath, &pathFromRoot)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("folder not found: %d", folderID)
+		}
+		return nil, err
+	}
+	dir := c.resolveRootPath(rootPath, relativePath.String) + pathFromRoot
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read folder: %w", err)
+	}
+
+	catalogFiles, err := c.listSyncFiles(rootID, pathFromRoot, opts.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{DryRun: opts.DryRun}
+	diskFiles, diskInfo := walkSyncFolder(dir, opts.Recursive, result)
+
+	var changed, found, unchanged []string
+	var added []string
+	for _, path := range diskFiles {
+		file, ok := catalogFiles[path]
+		if !ok {
+			added = append(added, path)
+			continue
+		}
+		if file.errorMessage.String == missingFileMessage {
+			found = append(found, path)
+			result.Found = append(result.Found, SyncChange{Path: path, ImageID: file.imageID})
+		}
+		if file.changedOnDisk(diskInfo[path]) {
+			changed = append(changed, path)
+			result.Changed = append(result.Changed, SyncChange{Path: path, ImageID: file.imageID})
+		} else {
+			unchanged = append(unchanged, path)
+			result.Unchanged++
+		}
+	}
+
+	var missing []string
+	for path := range catalogFiles {
+		if _, ok := diskInfo[path]; !ok {
+			missing = append(missing, path)
+		}
+	}
+	sort.Strings(missing)
+	for _, path := range missing {
+		result.Missing = append(result.Missing, SyncChange{Path: path, ImageID: catalogFiles[path].imageID})
+	}
+
+	if opts.DryRun {
+		for _, path := range added {
+			result.Added = append(result.Added, SyncChange{Path: path})
+		}
+		if opts.Missing == MissingFileRemove {
+			result.Removed = append(result.Removed, result.Missing...)
+		}
+		return result, nil
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Files imported before fingerprints were recorded get one now
+	for _, path := range unchanged {
+		if file := catalogFiles[path]; !file.modTime.Valid {
+			if err := updateFileFingerprint(tx, file.fileID, diskInfo[path]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, path := range found {
+		if _, err := tx.Exec(
+			`UPDATE AgLibraryFile SET errorMessage = NULL, errorTime = NULL WHERE id_local = ?`,
+			catalogFiles[path].fileID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to clear missing flag: %w", err)
+		}
+	}
+
+	for _, path := range changed {
+		file := catalogFiles[path]
+		input, err := readFileMetadata(path, diskInfo[path], scanOpts)
+		if err != nil {
+			result.Errors = append(result.Errors, &ScanError{Path: path, Err: err})
+			continue
+		}
+		if err := c.refreshImageMetadata(tx, file.imageID, input); err != nil {
+			return nil, fmt.Errorf("failed to update %s: %w", path, err)
+		}
+		if err := updateFileFingerprint(tx, file.fileID, diskInfo[path]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, path := range missing {
+		file := catalogFiles[path]
+		switch opts.Missing {
+		case MissingFileMark:
+			if file.errorMessage.String == missingFileMessage {
+				continue
+			}
+			if _, err := tx.Exec(
+				`UPDATE AgLibraryFile SET errorMessage = ?, errorTime = ? WHERE id_local = ?`,
+				missingFileMessage, ToLightroomTimestamp(time.Now()), file.fileID,
+			); err != nil {
+				return nil, fmt.Errorf("failed to mark missing file: %w", err)
+			}
+		case MissingFileRemove:
+			if err := c.removeFileImages(tx, file.fileID); err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+			result.Removed = append(result.Removed, SyncChange{Path: path, ImageID: file.imageID})
+		}
+	}
+
+	if opts.SkipNew {
+		for _, path := range added {
+			result.Added = append(result.Added, SyncChange{Path: path})
+		}
+	} else if len(added) > 0 {
+		var items []*importItem
+		for _, path := range added {
+			input, err := readFileMetadata(path, diskInfo[path], scanOpts)
+			if err != nil {
+				result.Errors = append(result.Errors, &ScanError{Path: path, Err: err})
+				continue
+			}
+			items = append(items, &importItem{input: input, sourcePath: path, destPath: path})
+		}
+		if len(items) > 0 {
+			session, images, err := c.insertImportItemsTx(tx, items, &ImportOptions{Preset: opts.Preset})
+			if err != nil {
+				return nil, err
+			}
+			result.Session = session
+			for i, image := range images {
+				result.Added = append(result.Added, SyncChange{Path: items[i].sourcePath, ImageID: image.ID})
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// syncScanOptions returns the scan options used to read metadata during a sync.
+// Capture times never fall back to the modification time, which changes
+// whenever a file is edited.
+func syncScanOptions(opts *ScanOptions) *ScanOptions {
+	scanOpts := &ScanOptions{}
+	if opts != nil {
+		*scanOpts = *opts
+	}
+	sources := scanOpts.CaptureTimeSources
+	if len(sources) == 0 {
+		sources = DefaultCaptureTimeSources
+	}
+	scanOpts.CaptureTimeSources = nil
+	for _, source := range sources {
+		if source != CaptureTimeFromModTime {
+			scanOpts.CaptureTimeSources = append(scanOpts.CaptureTimeSources, source)
+		}
+	}
+	if len(scanOpts.CaptureTimeSources) == 0 {
+		// An empty chain would mean the defaults again
+		scanOpts.CaptureTimeSources = []CaptureTimeSource{CaptureTimeFromEXIF}
+	}
+	return scanOpts
+}
+
+// listSyncFiles returns the catalog files in a folder (and its subfolders if
+// recursive), keyed by absolute path
+func (c *Catalog) listSyncFiles(rootID int64, pathFromRoot string, recursive bool) (map[string]*syncFile, error) {
+	query := `SELECT f.id_local, COALESCE(MIN(i.id_local), 0), f.modTime, f.importHash, f.errorMessage,
+	                 rf.absolutePath || fo.pathFromRoot || f.baseName || '.' || f.extension
+	          FROM AgLibraryFile f
+	          JOIN AgLibraryFolder fo ON f.folder = fo.id_local
+	          JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+	          LEFT JOIN Adobe_images i ON i.rootFile = f.id_local
+	          WHERE fo.rootFolder = ? AND `
+	args := []interface{}{rootID}
+	if recursive {
+		query += `substr(fo.pathFromRoot, 1, length(?)) = ?`
+		args = append(args, pathFromRoot, pathFromRoot)
+	} else {
+		query += `fo.pathFromRoot = ?`
+		args = append(args, pathFromRoot)
+	}
+	query += ` GROUP BY f.id_local`
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := map[string]*syncFile{}
+	for rows.Next() {
+		file := &syncFile{}
+		var path string
+		if err := rows.Scan(&file.fileID, &file.imageID, &file.modTime, &file.importHash, &file.errorMessage, &path); err != nil {
+			return nil, err
+		}
+		files[c.localPath(path)] = file
+	}
+	return files, rows.Err()
+}
+
+// walkSyncFolder lists the supported files below dir in walk order, recording
+// unreadable entries in result.Errors
+func walkSyncFolder(dir string, recursive bool, result *SyncResult) ([]string, map[string]os.FileInfo) {
+	var paths []string
+	infos := map[string]os.FileInfo{}
+
+	dir = filepath.Clean(dir)
+	filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			result.Errors = append(result.Errors, &ScanError{Path: path, Err: err})
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if !recursive && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isImageExtension(strings.ToLower(filepath.Ext(path))) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			result.Errors = append(result.Errors, &ScanError{Path: path, Err: err})
+			return nil
+		}
+		path = normalizePath(path)
+		paths = append(paths, path)
+		infos[path] = info
+		return nil
+	})
+	return paths, infos
+}
+
+// updateFileFingerprint records the modification time and size of a file
+func updateFileFingerprint(db dbExecutor, fileID int64, info os.FileInfo) error {
+	fp := newFileFingerprint(info)
+	_, err := db.Exec(
+		`UPDATE AgLibraryFile SET modTime = ?, externalModTime = ?, importHash = ? WHERE id_local = ?`,
+		fp.modTime, fp.modTime, fp.importHash(), fileID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update file fingerprint: %w", err)
+	}
+	return nil
+}
+
+// refreshImageMetadata updates an image from metadata read again from its file.
+// Values the file does not provide are left unchanged.
+func (c *Catalog) refreshImageMetadata(db dbExecutor, imageID int64, input *ImageInput) error {
+	var captureTime interface{}
+	if !input.CaptureTime.IsZero() {
+		captureTime = FormatCaptureTime(input.CaptureTime)
+	}
+	var width, height, orientation interface{}
+	if input.Width != nil && input.Height != nil {
+		width, height = *input.Width, *input.Height
+	}
+	if input.Orientation != nil {
+		orientation = *input.Orientation
+	}
+
+	_, err := db.Exec(
+		`UPDATE Adobe_images SET
+		 captureTime = COALESCE(?, captureTime),
+		 fileWidth = COALESCE(?, fileWidth),
+		 fileHeight = COALESCE(?, fileHeight),
+		 orientation = COALESCE(?, orientation),
+		 touchTime = ?
+		 WHERE id_local = ?`,
+		captureTime, width, height, orientation, ToLightroomTimestamp(time.Now()), imageID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if input.EXIF != nil {
+		if _, err := db.Exec(`DELETE FROM AgHarvestedExifMetadata WHERE image = ?`, imageID); err != nil {
+			return err
+		}
+		if err := c.harvestEXIF(db, imageID, input.EXIF); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFileImages removes every image (including virtual copies) of a file
+func (c *Catalog) removeFileImages(db dbExecutor, fileID int64) error {
+	rows, err := db.Query(`SELECT id_local FROM Adobe_images WHERE rootFile = ?`, fileID)
+	if err != nil {
+		return err
+	}
+	var imageIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		imageIDs = append(imageIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range imageIDs {
+		if err := c.removeImage(db, id); err != nil {
+			return err
+		}
+	}
+	// A file without images is not removed by removeImage
+	_, err = db.Exec(`DELETE FROM AgLibraryFile WHERE id_local = ?`, fileID)
+	return err
+}
@@ -0,0 +1,270 @@
+package lrcat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// syncTestFolder imports the given files from a fresh directory and returns
+// the directory and the ID of its catalog folder
+func syncTestFolder(t *testing.T, catalog *Catalog, names ...string) (string, int64) {
+	t.Helper()
+	dir := t.TempDir()
+	var inputs []*ImageInput
+	for _, name := range names {
+		inputs = append(inputs, &ImageInput{FilePath: writeTestFile(t, dir, name, []byte("data-"+name))})
+	}
+	_, images, err := catalog.AddImages(inputs)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	return dir, images[0].FolderID
+}
+
+func TestSyncFolderUnchanged(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	_, folderID := syncTestFolder(t, catalog, "a.jpg", "b.jpg")
+
+	result, err := catalog.SyncFolder(folderID, nil)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if result.Unchanged != 2 || len(result.Added) != 0 || len(result.Changed) != 0 || len(result.Missing) != 0 {
+		t.Errorf("Expected 2 unchanged files, got %+v", result)
+	}
+}
+
+func TestSyncFolderAddsNewFiles(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir, folderID := syncTestFolder(t, catalog, "a.jpg")
+	newPath := writeTestFile(t, dir, "b.jpg", []byte("new"))
+	writeTestFile(t, dir, "notes.txt", []byte("ignored"))
+	subPath := writeTestFile(t, dir, "sub/c.jpg", []byte("nested"))
+
+	result, err := catalog.SyncFolder(folderID, nil)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0].Path != newPath || result.Added[0].ImageID == 0 {
+		t.Fatalf("Expected %s to be added, got %+v", newPath, result.Added)
+	}
+	if result.Session == nil || result.Session.ImageCount != 1 {
+		t.Errorf("Expected an import session with 1 image, got %+v", result.Session)
+	}
+
+	result, err = catalog.SyncFolder(folderID, &SyncOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("Failed to sync recursively: %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0].Path != subPath {
+		t.Errorf("Expected %s to be added, got %+v", subPath, result.Added)
+	}
+	if result.Unchanged != 2 {
+		t.Errorf("Expected 2 unchanged files, got %d", result.Unchanged)
+	}
+
+	count, _ := catalog.ImageCount()
+	if count != 3 {
+		t.Errorf("Expected 3 images, got %d", count)
+	}
+}
+
+func TestSyncFolderDryRun(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir, folderID := syncTestFolder(t, catalog, "a.jpg", "b.jpg")
+	writeTestFile(t, dir, "c.jpg", []byte("new"))
+	os.Remove(filepath.Join(dir, "b.jpg"))
+
+	result, err := catalog.SyncFolder(folderID, &SyncOptions{DryRun: true, Missing: MissingFileRemove})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if !result.DryRun || len(result.Added) != 1 || len(result.Missing) != 1 || len(result.Removed) != 1 {
+		t.Errorf("Unexpected dry-run result: %+v", result)
+	}
+	if result.Added[0].ImageID != 0 {
+		t.Error("Dry run should not import files")
+	}
+
+	count, _ := catalog.ImageCount()
+	if count != 2 {
+		t.Errorf("Dry run should not change the catalog, got %d images", count)
+	}
+}
+
+func TestSyncFolderMissingFiles(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir, folderID := syncTestFolder(t, catalog, "a.jpg", "b.jpg")
+	missingPath := filepath.Join(dir, "b.jpg")
+	data, _ := os.ReadFile(missingPath)
+	os.Remove(missingPath)
+
+	result, err := catalog.SyncFolder(folderID, nil)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Missing) != 1 || result.Missing[0].Path != missingPath {
+		t.Fatalf("Expected %s to be missing, got %+v", missingPath, result.Missing)
+	}
+
+	var message string
+	catalog.DB().QueryRow(`SELECT errorMessage FROM AgLibraryFile WHERE baseName = 'b'`).Scan(&message)
+	if message != missingFileMessage {
+		t.Errorf("Expected file to be marked missing, got %q", message)
+	}
+
+	// Restoring the file clears the flag
+	os.WriteFile(missingPath, data, 0644)
+	stat, _ := os.Stat(missingPath)
+	os.Chtimes(missingPath, stat.ModTime(), stat.ModTime())
+	result, err = catalog.SyncFolder(folderID, nil)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Found) != 1 {
+		t.Errorf("Expected 1 found file, got %+v", result.Found)
+	}
+	var errorMessage *string
+	catalog.DB().QueryRow(`SELECT errorMessage FROM AgLibraryFile WHERE baseName = 'b'`).Scan(&errorMessage)
+	if errorMessage != nil {
+		t.Errorf("Expected missing flag to be cleared, got %q", *errorMessage)
+	}
+
+	// Remove policy deletes the image
+	os.Remove(missingPath)
+	result, err = catalog.SyncFolder(folderID, &SyncOptions{Missing: MissingFileRemove})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Removed) != 1 {
+		t.Errorf("Expected 1 removed file, got %+v", result.Removed)
+	}
+	count, _ := catalog.ImageCount()
+	if count != 1 {
+		t.Errorf("Expected 1 image after removal, got %d", count)
+	}
+	var files int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgLibraryFile`).Scan(&files)
+	if files != 1 {
+		t.Errorf("Expected 1 file record after removal, got %d", files)
+	}
+}
+
+func TestSyncFolderChangedFiles(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "IMG_001.jpg", buildTestJPEG(buildTestTIFF(&testIFD{}), 640, 480))
+	_, images, err := catalog.AddImages([]*ImageInput{{FilePath: path}})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	image := images[0]
+
+	// Replace the file with one carrying full EXIF and a newer modification time
+	exifJPEG := buildTestJPEG(buildTestTIFF(sampleEXIFIFD()), 6000, 4000)
+	if err := os.WriteFile(path, exifJPEG, 0644); err != nil {
+		t.Fatalf("Failed to rewrite file: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(path, later, later)
+
+	result, err := catalog.SyncFolder(image.FolderID, nil)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Changed) != 1 || result.Changed[0].ImageID != image.ID {
+		t.Fatalf("Expected image %d to be changed, got %+v", image.ID, result.Changed)
+	}
+
+	exif, err := catalog.GetImageEXIF(image.ID)
+	if err != nil {
+		t.Fatalf("Failed to get EXIF: %v", err)
+	}
+	if exif == nil || exif.ISO == nil || *exif.ISO != 400 {
+		t.Errorf("Expected EXIF to be harvested again, got %+v", exif)
+	}
+
+	var harvested int
+	catalog.DB().QueryRow(`SELECT COUNT(*) FROM AgHarvestedExifMetadata WHERE image = ?`, image.ID).Scan(&harvested)
+	if harvested != 1 {
+		t.Errorf("Expected 1 EXIF row, got %d", harvested)
+	}
+
+	// A second sync sees the updated fingerprint
+	result, err = catalog.SyncFolder(image.FolderID, nil)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Changed) != 0 || result.Unchanged != 1 {
+		t.Errorf("Expected file to be unchanged after sync, got %+v", result)
+	}
+}
+
+func TestSyncFolderPath(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir, _ := syncTestFolder(t, catalog, "a.jpg")
+	writeTestFile(t, dir, "b.jpg", []byte("new"))
+
+	result, err := catalog.SyncFolderPath(dir, &SyncOptions{SkipNew: true})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Added) != 1 || result.Added[0].ImageID != 0 || result.Session != nil {
+		t.Errorf("Expected new file to be reported but not imported, got %+v", result)
+	}
+
+	if _, err := catalog.SyncFolderPath("/nonexistent/folder", nil); err == nil {
+		t.Error("Expected error for unknown folder")
+	}
+}
+
+func TestSyncFolderNonASCIIPath(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	if _, err := catalog.AddRootFolder(dir); err != nil {
+		t.Fatalf("Failed to add root folder: %v", err)
+	}
+	a := writeTestFile(t, dir, "Café/a.jpg", []byte("a"))
+	b := writeTestFile(t, dir, "Café/sub/b.jpg", []byte("b"))
+	if _, _, err := catalog.AddImages([]*ImageInput{{FilePath: a}, {FilePath: b}}); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+
+	result, err := catalog.SyncFolderPath(filepath.Join(dir, "Café"), &SyncOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if len(result.Added) != 0 || result.Unchanged != 2 {
+		t.Errorf("Expected 2 unchanged files and none added, got %+v", result)
+	}
+	if count, _ := catalog.ImageCount(); count != 2 {
+		t.Errorf("Expected no duplicate imports, got %d images", count)
+	}
+}
+
+func TestImportHashSize(t *testing.T) {
+	fp := fileFingerprint{modTime: 100, size: 12345}
+	size, ok := importHashSize(fp.importHash())
+	if !ok || size != 12345 {
+		t.Errorf("Expected size 12345, got %d (%v)", size, ok)
+	}
+	if _, ok := importHashSize("legacy"); ok {
+		t.Error("Expected no size in hash without '#'")
+	}
+}
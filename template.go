@@ -0,0 +1,84 @@
+package lrcat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// templateResolver returns the expansion of a {name} or {name:arg} token
+type templateResolver func(name, arg string) (string, error)
+
+// renderTemplate expands every {token} in tmpl using resolve.
+// A literal brace can be written as {{ or }}.
+func renderTemplate(tmpl string, resolve templateResolver) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(tmpl); i++ {
+		ch := tmpl[i]
+		switch {
+		case ch == '{' && i+1 < len(tmpl) && tmpl[i+1] == '{':
+			sb.WriteByte('{')
+			i++
+		case ch == '}' && i+1 < len(tmpl) && tmpl[i+1] == '}':
+			sb.WriteByte('}')
+			i++
+		case ch == '{':
+			end := strings.IndexByte(tmpl[i:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated token in template %q", tmpl)
+			}
+			token := tmpl[i+1 : i+end]
+			name, arg, _ := strings.Cut(token, ":")
+			value, err := resolve(name, arg)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i += end
+		case ch == '}':
+			return "", fmt.Errorf("unexpected '}' in template %q", tmpl)
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String(), nil
+}
+
+// dateTemplateToken expands capture-date tokens such as {year} or {month}.
+// The second return value is false if name is not a date token.
+func dateTemplateToken(name string, t time.Time) (string, bool) {
+	switch name {
+	case "year":
+		return t.Format("2006"), true
+	case "yy":
+		return t.Format("06"), true
+	case "month":
+		return t.Format("01"), true
+	case "monthname":
+		return t.Format("January"), true
+	case "mon":
+		return t.Format("Jan"), true
+	case "day":
+		return t.Format("02"), true
+	case "hour":
+		return t.Format("15"), true
+	case "minute":
+		return t.Format("04"), true
+	case "second":
+		return t.Format("05"), true
+	case "date":
+		return t.Format("20060102"), true
+	}
+	return "", false
+}
+
+// renderFolderTemplate expands a destination folder template such as
+// "{year}/{year}-{month}-{day}" for the given capture time
+func renderFolderTemplate(tmpl string, captureTime time.Time) (string, error) {
+	return renderTemplate(tmpl, func(name, arg string) (string, error) {
+		if value, ok := dateTemplateToken(name, captureTime); ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("unknown folder template token: {%s}", name)
+	})
+}
@@ -0,0 +1,40 @@
+package lrcat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderFolderTemplate(t *testing.T) {
+	captureTime := time.Date(2024, 6, 5, 14, 30, 9, 0, time.UTC)
+
+	tests := []struct {
+		tmpl     string
+		expected string
+	}{
+		{DefaultFolderTemplate, "2024/2024-06-05"},
+		{"{yy}{month}{day}", "240605"},
+		{"{year}/{monthname}", "2024/June"},
+		{"{date}_{hour}{minute}{second}", "20240605_143009"},
+		{"shoots/{{raw}}", "shoots/{raw}"},
+	}
+
+	for _, tc := range tests {
+		got, err := renderFolderTemplate(tc.tmpl, captureTime)
+		if err != nil {
+			t.Errorf("renderFolderTemplate(%q): unexpected error: %v", tc.tmpl, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("renderFolderTemplate(%q): expected %q, got %q", tc.tmpl, tc.expected, got)
+		}
+	}
+}
+
+func TestRenderFolderTemplateErrors(t *testing.T) {
+	for _, tmpl := range []string{"{year", "{unknown}", "year}"} {
+		if _, err := renderFolderTemplate(tmpl, time.Now()); err == nil {
+			t.Errorf("renderFolderTemplate(%q): expected error", tmpl)
+		}
+	}
+}
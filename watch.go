@@ -0,0 +1,369 @@
+package lrcat
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default polling settings for Watch
+const (
+	DefaultWatchInterval = 2 * time.Second
+	DefaultWatchSettle   = 3 * time.Second
+)
+
+// WatchOptions controls how a Watcher finds and imports files
+type WatchOptions struct {
+	// Recursive also watches subdirectories
+	Recursive bool
+	// Interval is the polling interval. Defaults to DefaultWatchInterval.
+	Interval time.Duration
+	// Settle is how long a file's size and modification time must stay
+	// unchanged before it is imported, so partially written files are skipped.
+	// Defaults to DefaultWatchSettle; a negative value imports files as soon
+	// as they are seen. Empty files are never imported.
+	Settle time.Duration
+	// IgnoreExisting skips files already present when the watcher starts.
+	// Otherwise they are imported unless the catalog already references them,
+	// or, in copy and move mode, holds a file imported from them: one with
+	// the same original filename, size and modification time.
+	IgnoreExisting bool
+	// SessionName names the import session created for every batch
+	SessionName string
+	// Preset, if set, is applied to every imported image
+	Preset *ImportPreset
+	// Import holds further import settings such as copy or move mode.
+	// SessionName and Preset above take precedence over its own.
+	Import *ImportOptions
+	// Scan controls how capture time and dimensions are read
+	Scan *ScanOptions
+	// OnImport, if set, is called from the watcher goroutine after every
+	// import session: once per batch, or once per file when a batch had to
+	// be split because some of its files failed
+	OnImport func(session *ImportSession, images []*Image)
+}
+
+// Watcher polls directories and imports new image files once they are
+// completely written. Polling works on network mounts where filesystem
+// notifications are unavailable.
+type Watcher struct {
+	catalog *Catalog
+	dirs    []string
+	opts    WatchOptions
+
+	// pending tracks files that have been seen but not yet settled
+	pending map[string]*watchedFile
+	// handled records files that were imported or found in the catalog.
+	// Files that disappear are forgotten, so a new file of the same name is
+	// imported again.
+	handled map[string]bool
+
+	errors   chan error
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// watchedFile is the last observed state of a file that is still being written
+type watchedFile struct {
+	size        int64
+	modTime     time.Time
+	stableSince time.Time
+	// failed is set when the file could not be imported; it is retried once
+	// its size or modification time changes
+	failed bool
+}
+
+// Watch starts a Watcher for dirs. Call Stop to end it.
+func (c *Catalog) Watch(dirs []string, opts *WatchOptions) (*Watcher, error) {
+	w, err := c.newWatcher(dirs, opts)
+	if err != nil {
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// newWatcher validates the directories and records the files present at start
+func (c *Catalog) newWatcher(dirs []string, opts *WatchOptions) (*Watcher, error) {
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no directories to watch")
+	}
+	w := &Watcher{
+		catalog: c,
+		pending: map[string]*watchedFile{},
+		handled: map[string]bool{},
+		errors:  make(chan error, 16),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if opts != nil {
+		w.opts = *opts
+	}
+	if w.opts.Interval <= 0 {
+		w.opts.Interval = DefaultWatchInterval
+	}
+	if w.opts.Settle < 0 {
+		w.opts.Settle = 0
+	} else if w.opts.Settle == 0 {
+		w.opts.Settle = DefaultWatchSettle
+	}
+
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("failed to watch %s: not a directory", dir)
+		}
+		w.dirs = append(w.dirs, filepath.Clean(dir))
+	}
+
+	if w.opts.IgnoreExisting {
+		for path := range w.list() {
+			w.handled[path] = true
+		}
+	}
+	return w, nil
+}
+
+// Errors returns the channel on which import and scan errors are reported.
+// Errors are dropped while the channel buffer is full. The channel is
+// closed when the watcher stops.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Stop ends polling and waits for an import in progress to finish
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// run polls until Stop is called
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer close(w.errors)
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	w.poll(time.Now())
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			w.poll(now)
+		}
+	}
+}
+
+// poll checks every watched directory once and imports files that have settled
+func (w *Watcher) poll(now time.Time) {
+	files := w.list()
+
+	// Forget files that disappeared, whether they settled or not
+	for path := range w.pending {
+		if _, ok := files[path]; !ok {
+			delete(w.pending, path)
+		}
+	}
+	for path := range w.handled {
+		if _, ok := files[path]; !ok {
+			delete(w.handled, path)
+		}
+	}
+
+	var ready []string
+	for path, info := range files {
+		if w.handled[path] {
+			continue
+		}
+		p, ok := w.pending[path]
+		if !ok || p.size != info.Size() || !p.modTime.Equal(info.ModTime()) {
+			p = &watchedFile{size: info.Size(), modTime: info.ModTime(), stableSince: now}
+			w.pending[path] = p
+		}
+		if p.failed {
+			continue
+		}
+		if info.Size() > 0 && now.Sub(p.stableSince) >= w.opts.Settle {
+			ready = append(ready, path)
+		}
+	}
+	sort.Strings(ready)
+
+	if len(ready) > 0 {
+		w.importFiles(ready, files)
+	}
+}
+
+// list returns the supported files in the watched directories
+func (w *Watcher) list() map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+	for _, dir := range w.dirs {
+		err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				w.report(&ScanError{Path: path, Err: err})
+				if d != nil && d.IsDir() && path != dir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				if path != dir && (!w.opts.Recursive || strings.HasPrefix(d.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasPrefix(d.Name(), ".") || !isImageExtension(strings.ToLower(filepath.Ext(path))) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				w.report(&ScanError{Path: path, Err: err})
+				return nil
+			}
+			files[normalizePath(path)] = info
+			return nil
+		})
+		if err != nil {
+			w.report(err)
+		}
+	}
+	return files
+}
+
+// importFiles imports settled files as one batch. If the batch fails, the
+// files are imported one by one so that a single bad file does not hold back
+// the others. Files are marked as handled only once they are in the catalog;
+// failed files are reported and retried after they change.
+func (w *Watcher) importFiles(paths []string, infos map[string]os.FileInfo) {
+	scanOpts := w.opts.Scan
+	if scanOpts == nil {
+		scanOpts = &ScanOptions{}
+	}
+
+	var inputs []*ImageInput
+	var inputPaths []string
+	for _, path := range paths {
+		exists, err := w.alreadyImported(path, infos[path])
+		if err != nil {
+			w.report(fmt.Errorf("failed to check %s: %w", path, err))
+			w.markFailed(path)
+			continue
+		}
+		if exists {
+			w.markHandled(path)
+			continue
+		}
+
+		input, err := readFileMetadata(path, infos[path], scanOpts)
+		if err != nil {
+			w.report(&ScanError{Path: path, Err: err})
+			w.markFailed(path)
+			continue
+		}
+		inputs = append(inputs, input)
+		inputPaths = append(inputPaths, path)
+	}
+	if len(inputs) == 0 {
+		return
+	}
+
+	importOpts := &ImportOptions{}
+	if w.opts.Import != nil {
+		*importOpts = *w.opts.Import
+	}
+	if w.opts.SessionName != "" {
+		importOpts.SessionName = w.opts.SessionName
+	}
+	if w.opts.Preset != nil {
+		importOpts.Preset = w.opts.Preset
+	}
+
+	session, images, err := w.catalog.AddImagesWithOptions(inputs, importOpts)
+	if err == nil {
+		for _, path := range inputPaths {
+			w.markHandled(path)
+		}
+		if w.opts.OnImport != nil {
+			w.opts.OnImport(session, images)
+		}
+		return
+	}
+	if len(inputs) == 1 {
+		w.report(fmt.Errorf("failed to import %s: %w", inputPaths[0], err))
+		w.markFailed(inputPaths[0])
+		return
+	}
+
+	for i, input := range inputs {
+		session, images, err := w.catalog.AddImagesWithOptions([]*ImageInput{input}, importOpts)
+		if err != nil {
+			w.report(fmt.Errorf("failed to import %s: %w", inputPaths[i], err))
+			w.markFailed(inputPaths[i])
+			continue
+		}
+		w.markHandled(inputPaths[i])
+		if w.opts.OnImport != nil {
+			w.opts.OnImport(session, images)
+		}
+	}
+}
+
+// alreadyImported reports whether the file at path is in the catalog. Copy
+// and move imports catalog the destination rather than the source, so there
+// the source is recognized by the original filename and the size and
+// modification time that the copy keeps in its importHash.
+func (w *Watcher) alreadyImported(path string, info os.FileInfo) (bool, error) {
+	if w.opts.Import == nil || w.opts.Import.Mode == ImportModeAdd {
+		return w.catalog.fileInCatalog(w.catalog.db, path)
+	}
+	var count int
+	err := w.catalog.db.QueryRow(
+		`SELECT COUNT(*) FROM AgLibraryFile WHERE originalFilename = ? AND importHash = ?`,
+		filepath.Base(path), newFileFingerprint(info).importHash(),
+	).Scan(&count)
+	return count > 0, err
+}
+
+// markHandled records that a file is in the catalog and needs no more attention
+func (w *Watcher) markHandled(path string) {
+	w.handled[path] = true
+	delete(w.pending, path)
+}
+
+// markFailed keeps a file pending but skips it until it changes
+func (w *Watcher) markFailed(path string) {
+	if p, ok := w.pending[path]; ok {
+		p.failed = true
+	}
+}
+
+// report sends err on the errors channel without blocking
+func (w *Watcher) report(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// fileInCatalog reports whether the catalog references the file at path
+func (c *Catalog) fileInCatalog(db dbExecutor, path string) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		`SELECT COUNT(*) FROM AgLibraryFile f
+		 JOIN AgLibraryFolder fo ON f.folder = fo.id_local
+		 JOIN AgLibraryRootFolder rf ON fo.rootFolder = rf.id_local
+		 WHERE rf.absolutePath || fo.pathFromRoot || f.baseName || '.' || f.extension = ?`,
+		c.catalogPath(path),
+	).Scan(&count)
+	return count > 0, err
+}
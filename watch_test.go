@@ -0,0 +1,286 @@
+package lrcat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcherSettlesPartialFiles(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	var sessions []*ImportSession
+	w, err := catalog.newWatcher([]string{dir}, &WatchOptions{
+		Settle:      5 * time.Second,
+		SessionName: "Tethered",
+		OnImport: func(session *ImportSession, images []*Image) {
+			sessions = append(sessions, session)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	start := time.Now()
+	path := writeTestFile(t, dir, "IMG_001.jpg", []byte("partial"))
+	writeTestFile(t, dir, "notes.txt", []byte("ignored"))
+	w.poll(start)
+	if len(sessions) != 0 {
+		t.Fatal("File should not be imported before it settles")
+	}
+
+	// The file grows: the settle timer restarts
+	if err := os.WriteFile(path, []byte("partial plus the rest"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	w.poll(start.Add(4 * time.Second))
+	w.poll(start.Add(6 * time.Second))
+	if len(sessions) != 0 {
+		t.Fatal("File should not be imported while it is still changing")
+	}
+
+	w.poll(start.Add(10 * time.Second))
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 import, got %d", len(sessions))
+	}
+	if sessions[0].Name != "Tethered" || sessions[0].ImageCount != 1 {
+		t.Errorf("Unexpected session: %+v", sessions[0])
+	}
+
+	// Handled files are not imported again
+	w.poll(start.Add(20 * time.Second))
+	if len(sessions) != 1 {
+		t.Errorf("Expected no further imports, got %d", len(sessions))
+	}
+}
+
+func TestWatcherExistingFiles(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	imported := writeTestFile(t, dir, "a.jpg", []byte("a"))
+	if _, err := catalog.AddImage(&ImageInput{FilePath: imported}); err != nil {
+		t.Fatalf("Failed to add image: %v", err)
+	}
+	writeTestFile(t, dir, "b.jpg", []byte("b"))
+
+	w, err := catalog.newWatcher([]string{dir}, &WatchOptions{Settle: -1})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	w.poll(time.Now())
+
+	count, _ := catalog.ImageCount()
+	if count != 2 {
+		t.Errorf("Expected only b.jpg to be imported, got %d images", count)
+	}
+
+	// With IgnoreExisting, files present at start are left alone
+	writeTestFile(t, dir, "c.jpg", []byte("c"))
+	w, err = catalog.newWatcher([]string{dir}, &WatchOptions{Settle: -1, IgnoreExisting: true})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	w.poll(time.Now())
+	count, _ = catalog.ImageCount()
+	if count != 2 {
+		t.Errorf("Expected existing files to be ignored, got %d images", count)
+	}
+}
+
+func TestWatcherAppliesPresetAndCopies(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	hot := t.TempDir()
+	library := t.TempDir()
+	w, err := catalog.newWatcher([]string{hot}, &WatchOptions{
+		Settle: -1,
+		Preset: &ImportPreset{Keywords: []string{"Studio"}},
+		Import: &ImportOptions{Mode: ImportModeMove, DestinationRoot: library, FolderTemplate: "incoming"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	src := writeTestFile(t, hot, "IMG_001.jpg", []byte("data"))
+	w.poll(time.Now())
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Error("Expected source file to be moved")
+	}
+	if _, err := os.Stat(filepath.Join(library, "incoming", "IMG_001.jpg")); err != nil {
+		t.Errorf("Expected moved file in library: %v", err)
+	}
+	keyword, _ := catalog.GetKeywordByName("Studio")
+	if keyword == nil {
+		t.Fatal("Expected preset keyword to be created")
+	}
+	images, _ := catalog.GetKeywordImages(keyword.ID)
+	if len(images) != 1 {
+		t.Errorf("Expected 1 image with the preset keyword, got %d", len(images))
+	}
+}
+
+func TestWatcherImportsReusedNames(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	hot := t.TempDir()
+	library := t.TempDir()
+	w, err := catalog.newWatcher([]string{hot}, &WatchOptions{
+		Settle: -1,
+		Import: &ImportOptions{Mode: ImportModeMove, DestinationRoot: library, FolderTemplate: "incoming"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	writeTestFile(t, hot, "IMG_0001.jpg", []byte("first card"))
+	w.poll(time.Now())
+	w.poll(time.Now())
+	if len(w.handled) != 0 {
+		t.Errorf("Expected moved files to be forgotten, got %v", w.handled)
+	}
+
+	// The next card starts its numbering again
+	writeTestFile(t, hot, "IMG_0001.jpg", []byte("second card"))
+	w.poll(time.Now())
+	if count, _ := catalog.ImageCount(); count != 2 {
+		t.Errorf("Expected the second IMG_0001.jpg to be imported, got %d images", count)
+	}
+}
+
+func TestWatcherCopyModeRestart(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	hot := t.TempDir()
+	library := t.TempDir()
+	opts := &WatchOptions{
+		Settle: -1,
+		Import: &ImportOptions{Mode: ImportModeCopy, DestinationRoot: library, FolderTemplate: "incoming"},
+	}
+	w, err := catalog.newWatcher([]string{hot}, opts)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	writeTestFile(t, hot, "a.jpg", []byte("a"))
+	w.poll(time.Now())
+
+	// A restarted watcher recognizes the copy made before
+	w, err = catalog.newWatcher([]string{hot}, opts)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	writeTestFile(t, hot, "b.jpg", []byte("b"))
+	w.poll(time.Now())
+
+	if count, _ := catalog.ImageCount(); count != 2 {
+		t.Errorf("Expected only b.jpg to be imported after the restart, got %d images", count)
+	}
+	if _, err := os.Stat(filepath.Join(library, "incoming", "a-1.jpg")); !os.IsNotExist(err) {
+		t.Error("Expected a.jpg not to be copied again")
+	}
+}
+
+func TestWatcherRetriesFailedFiles(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	hot := t.TempDir()
+	library := t.TempDir()
+	w, err := catalog.newWatcher([]string{hot}, &WatchOptions{
+		Settle: -1,
+		Import: &ImportOptions{Mode: ImportModeCopy, DestinationRoot: library, FolderTemplate: "incoming", Collision: CollisionError},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+
+	// b.jpg collides with a file in the library, which fails the whole batch
+	writeTestFile(t, hot, "a.jpg", []byte("a"))
+	bad := writeTestFile(t, hot, "b.jpg", []byte("b"))
+	blocker := writeTestFile(t, library, "incoming/b.jpg", []byte("blocker"))
+	w.poll(time.Now())
+
+	if count, _ := catalog.ImageCount(); count != 1 {
+		t.Fatalf("Expected a.jpg to be imported despite b.jpg failing, got %d images", count)
+	}
+	select {
+	case err := <-w.errors:
+		if !strings.Contains(err.Error(), "b.jpg") {
+			t.Errorf("Expected the failure of b.jpg to be reported, got %v", err)
+		}
+	default:
+		t.Error("Expected the failure of b.jpg to be reported")
+	}
+
+	// An unchanged failed file is not retried
+	w.poll(time.Now())
+	if len(w.errors) != 0 {
+		t.Error("Expected the unchanged file not to be retried")
+	}
+
+	// Once the file changes it is imported
+	os.Remove(blocker)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(bad, later, later); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+	w.poll(time.Now())
+	if count, _ := catalog.ImageCount(); count != 2 {
+		t.Errorf("Expected b.jpg to be imported after it changed, got %d images", count)
+	}
+}
+
+func TestWatchStop(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	dir := t.TempDir()
+	imported := make(chan int, 1)
+	w, err := catalog.Watch([]string{dir}, &WatchOptions{
+		Interval: 10 * time.Millisecond,
+		Settle:   -1,
+		OnImport: func(session *ImportSession, images []*Image) {
+			imported <- len(images)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+
+	writeTestFile(t, dir, "IMG_001.jpg", []byte("data"))
+	select {
+	case n := <-imported:
+		if n != 1 {
+			t.Errorf("Expected 1 image, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for import")
+	}
+
+	w.Stop()
+	w.Stop()
+	if _, ok := <-w.Errors(); ok {
+		t.Error("Expected errors channel to be closed after Stop")
+	}
+}
+
+func TestWatchErrors(t *testing.T) {
+	catalog := createTestCatalog(t)
+	defer catalog.Close()
+
+	if _, err := catalog.Watch(nil, nil); err == nil {
+		t.Error("Expected error without directories")
+	}
+	if _, err := catalog.Watch([]string{filepath.Join(t.TempDir(), "missing")}, nil); err == nil {
+		t.Error("Expected error for missing directory")
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"compress/zlib"
 	"encoding/binary"
+	"encoding/xml"
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 )
 
 // XMPMetadata represents XMP metadata for an image
@@ -71,12 +74,17 @@ func DecompressXMP(data []byte) (string, error) {
 
 // SetXMP sets the XMP metadata for an image
 func (c *Catalog) SetXMP(imageID int64, xmp string) error {
+	return setXMP(c.db, imageID, xmp)
+}
+
+// setXMP sets the XMP metadata using the given executor
+func setXMP(db dbExecutor, imageID int64, xmp string) error {
 	compressed, err := CompressXMP(xmp)
 	if err != nil {
 		return fmt.Errorf("failed to compress XMP: %w", err)
 	}
 
-	_, err = c.db.Exec(
+	_, err = db.Exec(
 		`UPDATE Adobe_AdditionalMetadata SET xmp = ? WHERE image = ?`,
 		compressed, imageID,
 	)
@@ -89,8 +97,13 @@ func (c *Catalog) SetXMP(imageID int64, xmp string) error {
 
 // GetXMP retrieves the XMP metadata for an image
 func (c *Catalog) GetXMP(imageID int64) (string, error) {
+	return getXMP(c.db, imageID)
+}
+
+// getXMP retrieves the XMP metadata using the given executor
+func getXMP(db dbExecutor, imageID int64) (string, error) {
 	var data []byte
-	err := c.db.QueryRow(
+	err := db.QueryRow(
 		`SELECT xmp FROM Adobe_AdditionalMetadata WHERE image = ?`,
 		imageID,
 	).Scan(&data)
@@ -136,20 +149,250 @@ func GenerateBasicXMP(rating *int, colorLabel string, captureTime string) string
 </x:xmpmeta>`, ratingStr, labelStr, dateStr)
 }
 
-// ExtractXMPValue extracts a value from XMP content by key (e.g., "exif:DateTimeOriginal")
+// xmpNamespaces maps well-known XMP prefixes to their namespace URIs
+var xmpNamespaces = map[string]string{
+	"crs":       "http://ns.adobe.com/camera-raw-settings/1.0/",
+	"dc":        "http://purl.org/dc/elements/1.1/",
+	"exif":      "http://ns.adobe.com/exif/1.0/",
+	"lr":        "http://ns.adobe.com/lightroom/1.0/",
+	"photoshop": "http://ns.adobe.com/photoshop/1.0/",
+	"tiff":      "http://ns.adobe.com/tiff/1.0/",
+	"xmp":       "http://ns.adobe.com/xap/1.0/",
+}
+
+// SetXMPAttributes sets attributes (e.g. "crs:Exposure2012") on the first
+// rdf:Description element, replacing existing values and declaring any
+// well-known namespaces that are missing. Empty xmp starts from GenerateBasicXMP.
+func SetXMPAttributes(xmp string, attrs map[string]string) (string, error) {
+	if xmp == "" {
+		xmp = GenerateBasicXMP(nil, "", "")
+	}
+
+	start := strings.Index(xmp, "<rdf:Description")
+	if start == -1 {
+		return "", fmt.Errorf("XMP has no rdf:Description element")
+	}
+	end := strings.Index(xmp[start:], ">")
+	if end == -1 {
+		return "", fmt.Errorf("XMP rdf:Description element is not terminated")
+	}
+	end += start
+	selfClosing := xmp[end-1] == '/'
+	tagEnd := end
+	if selfClosing {
+		tagEnd--
+	}
+	tag := xmp[start:tagEnd]
+
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		tag = declareXMPNamespace(xmp, tag, key)
+	}
+
+	for _, key := range keys {
+		value := xmlAttrEscape(attrs[key])
+		if i := indexXMPAttribute(tag, key); i != -1 {
+			valueStart := i + len(key) + 2
+			valueEnd := strings.Index(tag[valueStart:], `"`)
+			if valueEnd == -1 {
+				return "", fmt.Errorf("XMP attribute %s is not terminated", key)
+			}
+			tag = tag[:valueStart] + value + tag[valueStart+valueEnd:]
+			continue
+		}
+		tag += fmt.Sprintf("\n   %s=\"%s\"", key, value)
+	}
+
+	return xmp[:start] + tag + xmp[tagEnd:], nil
+}
+
+// SetXMPBag sets an unordered array property (e.g. "dc:subject") on the first
+// rdf:Description element as an rdf:Bag of items, replacing any existing
+// value and declaring its namespace if it is well known. No items removes the
+// property. Empty xmp starts from GenerateBasicXMP unless there are no items.
+func SetXMPBag(xmp, key string, items []string) (string, error) {
+	if xmp == "" {
+		if len(items) == 0 {
+			return "", nil
+		}
+		xmp = GenerateBasicXMP(nil, "", "")
+	}
+
+	start := strings.Index(xmp, "<rdf:Description")
+	if start == -1 {
+		return "", fmt.Errorf("XMP has no rdf:Description element")
+	}
+	end := strings.Index(xmp[start:], ">")
+	if end == -1 {
+		return "", fmt.Errorf("XMP rdf:Description element is not terminated")
+	}
+	end += start
+	selfClosing := xmp[end-1] == '/'
+	tagEnd := end
+	if selfClosing {
+		tagEnd--
+	}
+	tag := xmp[start:tagEnd]
+
+	// Drop a value written in attribute form
+	if i := indexXMPAttribute(tag, key); i != -1 {
+		valueStart := i + len(key) + 2
+		valueEnd := strings.Index(tag[valueStart:], `"`)
+		if valueEnd == -1 {
+			return "", fmt.Errorf("XMP attribute %s is not terminated", key)
+		}
+		tag = strings.TrimRight(tag[:i], " \t\r\n") + tag[valueStart+valueEnd+1:]
+	}
+	if len(items) > 0 {
+		tag = declareXMPNamespace(xmp, tag, key)
+	}
+
+	var body, rest string
+	if selfClosing {
+		body, rest = "\n  ", "</rdf:Description>"+xmp[end+1:]
+	} else {
+		closeIdx := strings.Index(xmp[end:], "</rdf:Description>")
+		if closeIdx == -1 {
+			return "", fmt.Errorf("XMP rdf:Description element is not closed")
+		}
+		closeIdx += end
+		body, rest = xmp[end+1:closeIdx], xmp[closeIdx:]
+	}
+
+	// Drop existing elements, together with the whitespace before them
+	for _, form := range []struct{ open, close string }{
+		{"<" + key + ">", "</" + key + ">"},
+		{"<" + key + "/>", ""},
+	} {
+		for {
+			i := strings.Index(body, form.open)
+			if i == -1 {
+				break
+			}
+			j := i + len(form.open)
+			if form.close != "" {
+				k := strings.Index(body[j:], form.close)
+				if k == -1 {
+					return "", fmt.Errorf("XMP element %s is not closed", key)
+				}
+				j += k + len(form.close)
+			}
+			body = strings.TrimRight(body[:i], " \t\r\n") + body[j:]
+		}
+	}
+
+	if len(items) > 0 {
+		var sb strings.Builder
+		sb.WriteString(strings.TrimRight(body, " \t\r\n"))
+		fmt.Fprintf(&sb, "\n   <%s>\n    <rdf:Bag>\n", key)
+		for _, item := range items {
+			fmt.Fprintf(&sb, "     <rdf:li>%s</rdf:li>\n", xmlAttrEscape(item))
+		}
+		fmt.Fprintf(&sb, "    </rdf:Bag>\n   </%s>\n  ", key)
+		body = sb.String()
+	}
+
+	return xmp[:start] + tag + ">" + body + rest, nil
+}
+
+// ExtractXMPBag returns the items of an array property (e.g. "dc:subject")
+// written as an rdf:Bag, rdf:Seq or rdf:Alt, or nil if xmp has none
+func ExtractXMPBag(xmp, key string) []string {
+	start := strings.Index(xmp, "<"+key+">")
+	if start == -1 {
+		return nil
+	}
+	end := strings.Index(xmp[start:], "</"+key+">")
+	if end == -1 {
+		return nil
+	}
+	end += start + len("</"+key+">")
+
+	var property struct {
+		Bag []string `xml:"Bag>li"`
+		Seq []string `xml:"Seq>li"`
+		Alt []string `xml:"Alt>li"`
+	}
+	if err := xml.Unmarshal([]byte(xmp[start:end]), &property); err != nil {
+		return nil
+	}
+	items := append(append(property.Bag, property.Seq...), property.Alt...)
+	for i, item := range items {
+		items[i] = strings.TrimSpace(item)
+	}
+	return items
+}
+
+// declareXMPNamespace adds the declaration of a well-known namespace used by
+// key to an element tag if neither xmp nor the tag declares it yet
+func declareXMPNamespace(xmp, tag, key string) string {
+	prefix, _, ok := strings.Cut(key, ":")
+	if !ok {
+		return tag
+	}
+	if uri, known := xmpNamespaces[prefix]; known && !strings.Contains(xmp, "xmlns:"+prefix+"=") && !strings.Contains(tag, "xmlns:"+prefix+"=") {
+		tag += fmt.Sprintf("\n   xmlns:%s=\"%s\"", prefix, uri)
+	}
+	return tag
+}
+
+// indexXMPAttribute returns the index of key="..." within an element tag,
+// requiring the key to be preceded by whitespace
+func indexXMPAttribute(tag, key string) int {
+	search := key + `="`
+	offset := 0
+	for {
+		i := strings.Index(tag[offset:], search)
+		if i == -1 {
+			return -1
+		}
+		i += offset
+		if i > 0 && (tag[i-1] == ' ' || tag[i-1] == '\n' || tag[i-1] == '\t' || tag[i-1] == '\r') {
+			return i
+		}
+		offset = i + len(search)
+	}
+}
+
+// xmlAttrEscape escapes a string for use inside a double-quoted XML attribute
+func xmlAttrEscape(s string) string {
+	var sb strings.Builder
+	if err := xml.EscapeText(&sb, []byte(s)); err != nil {
+		return s
+	}
+	return sb.String()
+}
+
+// ExtractXMPValue extracts a value from XMP content by key (e.g., "exif:DateTimeOriginal").
+// Both the attribute form (key="value") and the element form (<key>value</key>) are supported.
 func ExtractXMPValue(xmp string, key string) string {
 	// Look for key="value" pattern
 	searchStr := key + `="`
-	startIdx := bytes.Index([]byte(xmp), []byte(searchStr))
+	startIdx := strings.Index(xmp, searchStr)
+	if startIdx != -1 {
+		startIdx += len(searchStr)
+		endIdx := strings.Index(xmp[startIdx:], `"`)
+		if endIdx == -1 {
+			return ""
+		}
+		return xmp[startIdx : startIdx+endIdx]
+	}
+
+	// Fall back to <key>value</key>
+	openTag := "<" + key + ">"
+	startIdx = strings.Index(xmp, openTag)
 	if startIdx == -1 {
 		return ""
 	}
-
-	startIdx += len(searchStr)
-	endIdx := bytes.Index([]byte(xmp[startIdx:]), []byte(`"`))
+	startIdx += len(openTag)
+	endIdx := strings.Index(xmp[startIdx:], "</"+key+">")
 	if endIdx == -1 {
 		return ""
 	}
-
-	return xmp[startIdx : startIdx+endIdx]
+	return strings.TrimSpace(xmp[startIdx : startIdx+endIdx])
 }
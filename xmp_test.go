@@ -1,6 +1,7 @@
 package lrcat
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -155,6 +156,23 @@ func TestExtractXMPValue(t *testing.T) {
 	}
 }
 
+func TestExtractXMPValueElementForm(t *testing.T) {
+	xmp := `<rdf:Description>
+   <exif:DateTimeOriginal>2024-06-15T14:30:00.25+02:00</exif:DateTimeOriginal>
+   <tiff:Orientation>6</tiff:Orientation>
+  </rdf:Description>`
+
+	date := ExtractXMPValue(xmp, "exif:DateTimeOriginal")
+	if date != "2024-06-15T14:30:00.25+02:00" {
+		t.Errorf("Expected element date, got '%s'", date)
+	}
+
+	orientation := ExtractXMPValue(xmp, "tiff:Orientation")
+	if orientation != "6" {
+		t.Errorf("Expected orientation '6', got '%s'", orientation)
+	}
+}
+
 func TestXMPRoundTrip(t *testing.T) {
 	catalog := createTestCatalog(t)
 	defer catalog.Close()
@@ -183,3 +201,86 @@ func TestXMPRoundTrip(t *testing.T) {
 		t.Error("XMP round-trip failed")
 	}
 }
+
+func TestSetXMPAttributes(t *testing.T) {
+	xmp := GenerateBasicXMP(nil, "", "")
+	updated, err := SetXMPAttributes(xmp, map[string]string{
+		"crs:Exposure2012":   "0.50",
+		"crs:ProcessVersion": "15.4",
+		"photoshop:City":     `Paris & "Co"`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set attributes: %v", err)
+	}
+
+	if v := ExtractXMPValue(updated, "crs:Exposure2012"); v != "0.50" {
+		t.Errorf("Expected crs:Exposure2012 0.50, got %q", v)
+	}
+	if v := ExtractXMPValue(updated, "crs:ProcessVersion"); v != "15.4" {
+		t.Errorf("Expected existing crs:ProcessVersion to be replaced, got %q", v)
+	}
+	if !strings.Contains(updated, `xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"`) {
+		t.Error("Expected photoshop namespace to be declared")
+	}
+	if !strings.Contains(updated, `photoshop:City="Paris &amp; &#34;Co&#34;"`) {
+		t.Errorf("Expected escaped attribute, got %s", updated)
+	}
+	if strings.Count(updated, "crs:ProcessVersion=") != 1 {
+		t.Error("Expected a single crs:ProcessVersion attribute")
+	}
+}
+
+func TestSetXMPBag(t *testing.T) {
+	xmp := GenerateBasicXMP(nil, "", "")
+	updated, err := SetXMPBag(xmp, "dc:subject", []string{"Paris", "Rock & Roll"})
+	if err != nil {
+		t.Fatalf("Failed to set bag: %v", err)
+	}
+	if !strings.Contains(updated, `xmlns:dc="http://purl.org/dc/elements/1.1/"`) {
+		t.Error("Expected dc namespace to be declared")
+	}
+	if items := ExtractXMPBag(updated, "dc:subject"); !reflect.DeepEqual(items, []string{"Paris", "Rock & Roll"}) {
+		t.Errorf("Unexpected items: %q", items)
+	}
+	if v := ExtractXMPValue(updated, "crs:Version"); v != "15.0" {
+		t.Errorf("Expected attributes to be kept, got %q", v)
+	}
+
+	// Replacing keeps a single element
+	updated, err = SetXMPBag(updated, "dc:subject", []string{"Lyon"})
+	if err != nil {
+		t.Fatalf("Failed to replace bag: %v", err)
+	}
+	if strings.Count(updated, "<dc:subject>") != 1 {
+		t.Errorf("Expected a single dc:subject element, got %s", updated)
+	}
+	if items := ExtractXMPBag(updated, "dc:subject"); !reflect.DeepEqual(items, []string{"Lyon"}) {
+		t.Errorf("Unexpected items after replacing: %q", items)
+	}
+
+	// No items removes the property
+	updated, err = SetXMPBag(updated, "dc:subject", nil)
+	if err != nil {
+		t.Fatalf("Failed to remove bag: %v", err)
+	}
+	if strings.Contains(updated, "dc:subject") {
+		t.Errorf("Expected dc:subject to be removed, got %s", updated)
+	}
+
+	// A self-closing description is opened up
+	selfClosing := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description rdf:about="" xmp:Rating="3"/></rdf:RDF></x:xmpmeta>`
+	updated, err = SetXMPBag(selfClosing, "lr:hierarchicalSubject", []string{"Places|France"})
+	if err != nil {
+		t.Fatalf("Failed to set bag on self-closing description: %v", err)
+	}
+	if items := ExtractXMPBag(updated, "lr:hierarchicalSubject"); !reflect.DeepEqual(items, []string{"Places|France"}) {
+		t.Errorf("Unexpected items: %q in %s", items, updated)
+	}
+	if v := ExtractXMPValue(updated, "xmp:Rating"); v != "3" {
+		t.Errorf("Expected xmp:Rating to be kept, got %q", v)
+	}
+
+	if empty, err := SetXMPBag("", "dc:subject", nil); empty != "" || err != nil {
+		t.Errorf("Expected empty XMP to stay empty, got %q %v", empty, err)
+	}
+}